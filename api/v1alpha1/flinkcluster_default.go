@@ -100,6 +100,9 @@ func _SetJobDefault(jobSpec *JobSpec) {
 	if jobSpec.RestartPolicy == nil {
 		jobSpec.RestartPolicy = new(corev1.RestartPolicy)
 		*jobSpec.RestartPolicy = corev1.RestartPolicyOnFailure
+		if jobSpec.IsRESTSubmission() {
+			*jobSpec.RestartPolicy = corev1.RestartPolicyNever
+		}
 	}
 	if jobSpec.CleanupPolicy == nil {
 		jobSpec.CleanupPolicy = &CleanupPolicy{
@@ -223,3 +223,15 @@ func TestSetNonDefault(t *testing.T) {
 
 	assert.DeepEqual(t, cluster, expectedCluster)
 }
+
+// Tests the default restart policy of a job submitted through the REST API.
+func TestSetRESTSubmissionDefault(t *testing.T) {
+	var submissionMode = JobSubmissionMode.REST
+	var cluster = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			Job: &JobSpec{SubmissionMode: &submissionMode},
+		},
+	}
+	_SetDefault(&cluster)
+	assert.Equal(t, *cluster.Spec.Job.RestartPolicy, corev1.RestartPolicyNever)
+}
@@ -55,22 +55,106 @@ var JobState = struct {
 	Running   string
 	Succeeded string
 	Failed    string
+	Cancelled string
 	Unknown   string
 }{
 	Pending:   "Pending",
 	Running:   "Running",
 	Succeeded: "Succeeded",
 	Failed:    "Failed",
+	Cancelled: "Cancelled",
 	Unknown:   "Unknown",
 }
 
+// JobConditionType defines types of job conditions.
+var JobConditionType = struct {
+	CheckpointStale string
+}{
+	CheckpointStale: "CheckpointStale",
+}
+
+// SavepointState defines states of a savepoint operation.
+var SavepointState = struct {
+	InProgress string
+	Succeeded  string
+	Failed     string
+}{
+	InProgress: "InProgress",
+	Succeeded:  "Succeeded",
+	Failed:     "Failed",
+}
+
+// SavepointType defines types of savepoints by what they are taken for.
+var SavepointType = struct {
+	Periodic string
+	Manual   string
+	Upgrade  string
+	Final    string
+}{
+	Periodic: "Periodic",
+	Manual:   "Manual",
+	Upgrade:  "Upgrade",
+	Final:    "Final",
+}
+
+// JobUpgradePhase defines phases of a stateful job upgrade, which is
+// triggered by changes of the job spec.
+var JobUpgradePhase = struct {
+	TakingSavepoint string
+	Resubmitting    string
+}{
+	TakingSavepoint: "TakingSavepoint",
+	Resubmitting:    "Resubmitting",
+}
+
+// JobStopPhase defines phases of stopping a job with a final savepoint, e.g.,
+// when the cluster is being deleted or the job is removed from the spec.
+var JobStopPhase = struct {
+	TakingSavepoint string
+	Stopped         string
+}{
+	TakingSavepoint: "TakingSavepoint",
+	Stopped:         "Stopped",
+}
+
 // JobRestartPolicy defines the policy for job restart.
 var JobRestartPolicy = struct {
-	OnFailure string
-	Never     string
+	OnFailure              string
+	Never                  string
+	FromSavepointOnFailure string
 }{
-	OnFailure: "OnFailure",
-	Never:     "Never",
+	OnFailure:              "OnFailure",
+	Never:                  "Never",
+	FromSavepointOnFailure: "FromSavepointOnFailure",
+}
+
+// JobSubmissionMode defines how the job is submitted to the cluster.
+var JobSubmissionMode = struct {
+	Submitter string
+	REST      string
+}{
+	Submitter: "Submitter",
+	REST:      "REST",
+}
+
+// DeploymentType defines the kinds of the workload resources which run the
+// pods of a cluster component.
+var DeploymentType = struct {
+	Deployment  string
+	StatefulSet string
+}{
+	Deployment:  "Deployment",
+	StatefulSet: "StatefulSet",
+}
+
+// HighAvailabilityMode defines the services which the JobManagers elect the
+// leader and persist the job metadata pointers with.
+var HighAvailabilityMode = struct {
+	Kubernetes string
+	ZooKeeper  string
+}{
+	Kubernetes: "Kubernetes",
+	ZooKeeper:  "ZooKeeper",
 }
 
 // AccessScope defines the access scope of JobManager service.
@@ -129,9 +213,19 @@ type JobManagerIngressSpec struct {
 
 // JobManagerSpec defines properties of JobManager.
 type JobManagerSpec struct {
-	// The number of replicas.
+	// The number of replicas, default: 1. Multiple replicas, of which one is
+	// the leader and the others are on standby, require high availability and
+	// are only supported in session clusters: the requests to the Flink REST
+	// API are not routed to the leader, but savepoints, rescalings and
+	// uploaded JAR files are only known to the JobManager which handled them.
 	Replicas *int32 `json:"replicas,omitempty"`
 
+	// Kind of the resource which runs the JobManager pods, "Deployment" or
+	// "StatefulSet", default: "Deployment". A StatefulSet gives the pods
+	// stable hostnames through a headless service and persistent volumes
+	// through the volume claim templates. It cannot be updated.
+	DeploymentType *string `json:"deploymentType,omitempty"`
+
 	// Access scope, enum("Cluster", "VPC", "External").
 	AccessScope string `json:"accessScope"`
 
@@ -143,7 +237,6 @@ type JobManagerSpec struct {
 
 	// Compute resources required by each JobManager container.
 	// If omitted, a default value will be used.
-	// Cannot be updated.
 	// More info: https://kubernetes.io/docs/concepts/configuration/manage-compute-resources-container/
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 
@@ -153,12 +246,24 @@ type JobManagerSpec struct {
 	// Volume mounts in the JobManager container.
 	Mounts []corev1.VolumeMount `json:"mounts,omitempty"`
 
+	// Volume claim templates of the JobManager StatefulSet, the volumes are
+	// mounted by the names of the claims. Only supported with the
+	// "StatefulSet" deployment type, and cannot be updated.
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+
 	// Selector which must match a node's labels for the JobManager pod to be
 	// scheduled on that node.
 	// More info: https://kubernetes.io/docs/concepts/configuration/assign-pod-node/
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
 }
 
+// IsStatefulSet checks whether the JobManager runs as a StatefulSet instead
+// of a Deployment.
+func (jmSpec *JobManagerSpec) IsStatefulSet() bool {
+	return jmSpec.DeploymentType != nil &&
+		*jmSpec.DeploymentType == DeploymentType.StatefulSet
+}
+
 // TaskManagerPorts defines ports of TaskManager.
 type TaskManagerPorts struct {
 	// Data port, default: 6121.
@@ -173,7 +278,8 @@ type TaskManagerPorts struct {
 
 // TaskManagerSpec defines properties of TaskManager.
 type TaskManagerSpec struct {
-	// The number of replicas.
+	// The number of replicas, which is also exposed through the scale
+	// subresource of the cluster, e.g., for HorizontalPodAutoscaler.
 	Replicas int32 `json:"replicas"`
 
 	// Ports.
@@ -181,7 +287,6 @@ type TaskManagerSpec struct {
 
 	// Compute resources required by each TaskManager container.
 	// If omitted, a default value will be used.
-	// Cannot be updated.
 	// More info: https://kubernetes.io/docs/concepts/configuration/manage-compute-resources-container/
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 
@@ -199,6 +304,15 @@ type TaskManagerSpec struct {
 	// Sidecar containers running alongside with the TaskManager container in the
 	// pod.
 	Sidecars []corev1.Container `json:"sidecars,omitempty"`
+
+	// Volume claim templates of the persistent volumes for the local state,
+	// e.g., of RocksDB, which survives the TaskManager restarts. If specified,
+	// the TaskManagers run as a StatefulSet with a headless service, the
+	// volumes are mounted at "/flink-local-state/<claim name>", and local
+	// recovery is enabled with the local state in the volumes. Each
+	// TaskManager keeps its resource ID, i.e., its pod name, and its working
+	// dir in the first volume across restarts. It cannot be updated.
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
 }
 
 // CleanupAction defines the action to take after job finishes.
@@ -235,6 +349,10 @@ type JobSpec struct {
 	// Savepoint where to restore the job from (e.g., gs://my-savepoint/1234).
 	Savepoint *string `json:"savepoint,omitempty"`
 
+	// FlinkSavepoint in the same namespace where to restore the job from, it
+	// is resolved to the savepoint location once the savepoint succeeds.
+	SavepointRef *corev1.LocalObjectReference `json:"savepointRef,omitempty"`
+
 	// Allow non-restored state, default: false.
 	AllowNonRestoredState *bool `json:"allowNonRestoredState,omitempty"`
 
@@ -244,7 +362,32 @@ type JobSpec struct {
 	// Savepoints dir where to store automatically taken savepoints.
 	SavepointsDir *string `json:"savepointsDir,omitempty"`
 
-	// Job parallelism, default: 1.
+	// Savepoint generation of the job, increasing it triggers a savepoint to
+	// the savepoints dir on demand.
+	SavepointGeneration int32 `json:"savepointGeneration,omitempty"`
+
+	// The maximum number of savepoints to keep, older savepoints are deleted
+	// from the storage. If unspecified, or if the storage is not supported by
+	// the operator, e.g., file locations without its --local-savepoint-dir
+	// flag, savepoints are never deleted, and the savepoint history in the
+	// status keeps the last 10 savepoints. A warning event lists the expired
+	// savepoints which cannot be deleted.
+	MaxSavepointsToKeep *int32 `json:"maxSavepointsToKeep,omitempty"`
+
+	// Timeout of the final savepoint which is taken before the job is stopped,
+	// the job is stopped without the savepoint after the timeout, default: 300.
+	FinalSavepointTimeoutSeconds *int32 `json:"finalSavepointTimeoutSeconds,omitempty"`
+
+	// The threshold after which the checkpoints of the running job are
+	// considered stale if none has completed, which raises the CheckpointStale
+	// condition in the job status. If unspecified, the condition is not
+	// reported.
+	CheckpointStaleThresholdSeconds *int32 `json:"checkpointStaleThresholdSeconds,omitempty"`
+
+	// Job parallelism, default: 1. Changing it rescales the running job
+	// through the Flink rescale API if the Flink version supports it,
+	// otherwise the job is resubmitted from a savepoint. The job is only
+	// rescaled up when the TaskManagers have enough task slots.
 	Parallelism *int32 `json:"parallelism,omitempty"`
 
 	// No logging output to STDOUT, default: false.
@@ -256,13 +399,100 @@ type JobSpec struct {
 	// Volume mounts in the Job container.
 	Mounts []corev1.VolumeMount `json:"mounts,omitempty"`
 
-	// Restart policy, "OnFailure" or "Never", default: "OnFailure".
+	// How the job is submitted, "Submitter" or "REST", default: "Submitter".
+	// With "Submitter", a Kubernetes job runs the Flink CLI in the Flink image
+	// to submit the job, and the JAR file may be a path in the Flink image.
+	// With "REST", the operator uploads the JAR file and runs it through the
+	// Flink REST API, so the JAR file must be a URL readable by the operator,
+	// e.g., an http(s) URL, or a file URL in the dir of the operator set with
+	// its --local-jar-dir flag; volumes and mounts are not supported. The job
+	// is upgraded through a savepoint when the job spec changes, as with
+	// "Submitter".
+	SubmissionMode *string `json:"submissionMode,omitempty"`
+
+	// Restart policy, "OnFailure", "Never" or "FromSavepointOnFailure",
+	// default: "OnFailure", or "Never" with the "REST" submission mode, which
+	// doesn't support "OnFailure". With "FromSavepointOnFailure", the operator
+	// resubmits the failed job from the latest savepoint or retained
+	// checkpoint.
 	RestartPolicy *corev1.RestartPolicy `json:"restartPolicy"`
 
+	// The maximum number of restarts of the failed job when the restart policy
+	// is "FromSavepointOnFailure", default: 3.
+	MaxRestarts *int32 `json:"maxRestarts,omitempty"`
+
 	// The action to take after job finishes.
 	CleanupPolicy *CleanupPolicy `json:"cleanupPolicy,omitempty"`
 }
 
+// IsRESTSubmission checks whether the job is submitted through the Flink REST
+// API instead of a job submitter.
+func (jobSpec *JobSpec) IsRESTSubmission() bool {
+	return jobSpec.SubmissionMode != nil &&
+		*jobSpec.SubmissionMode == JobSubmissionMode.REST
+}
+
+// RESTTLSSpec defines TLS of the Flink REST API. Flink serves the API with
+// the keystore, and the operator verifies it with the CA certificate.
+type RESTTLSSpec struct {
+	// Secret which contains the keystore "keystore.jks" of the REST API and
+	// the truststore "truststore.jks" of its clients, it is mounted in the
+	// JobManager and job submitter containers. Their passwords are set
+	// through the Flink properties "security.ssl.rest.keystore-password",
+	// "security.ssl.rest.key-password" and
+	// "security.ssl.rest.truststore-password".
+	KeystoreSecret string `json:"keystoreSecret"`
+
+	// Secret which contains the PEM encoded CA certificate "ca.crt" which the
+	// operator verifies the REST API with.
+	CASecret string `json:"caSecret"`
+
+	// (Optional) Secret which contains the PEM encoded client certificate
+	// "tls.crt" and key "tls.key" of the operator. If specified, the REST API
+	// requires mutual authentication, so the truststore must trust the client
+	// certificate.
+	ClientCertSecret *string `json:"clientCertSecret,omitempty"`
+}
+
+// RESTSecuritySpec defines the security of the Flink REST API.
+type RESTSecuritySpec struct {
+	// (Optional) TLS of the REST API.
+	TLS *RESTTLSSpec `json:"tls,omitempty"`
+
+	// (Optional) Secret whose entries are sent by the operator as HTTP headers
+	// with the requests to the REST API, e.g., "Authorization" when the API
+	// is behind an authenticating proxy.
+	AuthHeadersSecret *string `json:"authHeadersSecret,omitempty"`
+}
+
+// ZooKeeperHASpec defines the ZooKeeper of JobManager high availability.
+type ZooKeeperHASpec struct {
+	// ZooKeeper quorum, e.g., "zk-0.zk:2181,zk-1.zk:2181,zk-2.zk:2181".
+	Quorum string `json:"quorum"`
+
+	// (Optional) Root ZooKeeper node of the Flink clusters, default: "/flink".
+	RootPath *string `json:"rootPath,omitempty"`
+}
+
+// HighAvailabilitySpec defines JobManager high availability. The JobManager
+// persists the job metadata in the storage dir, so the jobs are recovered
+// after the JobManager restarts, and the standby JobManagers, if there are
+// multiple replicas, take over after the leader fails.
+type HighAvailabilitySpec struct {
+	// HA services, "Kubernetes" or "ZooKeeper". With "Kubernetes", the leader
+	// is elected with ConfigMaps, which requires Flink 1.12 or later, and the
+	// operator creates a service account for the cluster pods with a role to
+	// manage the ConfigMaps.
+	Mode string `json:"mode"`
+
+	// Storage dir where the JobManager metadata is persisted, e.g.,
+	// gs://my-bucket/flink-ha.
+	StorageDir string `json:"storageDir"`
+
+	// (Optional) ZooKeeper, required by "ZooKeeper".
+	ZooKeeper *ZooKeeperHASpec `json:"zookeeper,omitempty"`
+}
+
 // FlinkClusterSpec defines the desired state of FlinkCluster
 type FlinkClusterSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -288,6 +518,14 @@ type FlinkClusterSpec struct {
 	// Environment variables shared by all JobManager, TaskManager and job
 	// containers.
 	EnvVars []corev1.EnvVar `json:"envVars,omitempty"`
+
+	// (Optional) Security of the Flink REST API.
+	RESTSecurity *RESTSecuritySpec `json:"restSecurity,omitempty"`
+
+	// (Optional) JobManager high availability. Without it, the running jobs
+	// are lost when the JobManager restarts, and there must be exactly one
+	// JobManager replica.
+	HighAvailability *HighAvailabilitySpec `json:"highAvailability,omitempty"`
 }
 
 // FlinkClusterComponentState defines the observed state of a component
@@ -306,7 +544,8 @@ type FlinkClusterComponentsStatus struct {
 	// The state of configMap.
 	ConfigMap FlinkClusterComponentState `json:"configMap"`
 
-	// The state of JobManager deployment.
+	// The state of JobManager deployment, or StatefulSet with the
+	// "StatefulSet" deployment type.
 	JobManagerDeployment FlinkClusterComponentState `json:"jobManagerDeployment"`
 
 	// The state of JobManager service.
@@ -315,32 +554,256 @@ type FlinkClusterComponentsStatus struct {
 	// The state of JobManager ingress.
 	JobManagerIngress *JobManagerIngressStatus `json:"jobManagerIngress,omitempty"`
 
-	// The state of TaskManager deployment.
+	// The state of TaskManager deployment, or StatefulSet with the volume
+	// claim templates.
 	TaskManagerDeployment FlinkClusterComponentState `json:"taskManagerDeployment"`
 
 	// The status of the job, available only when JobSpec is provided.
 	Job *JobStatus `json:"job,omitempty"`
+
+	// The jobs in the cluster, available only for session clusters, i.e.,
+	// when JobSpec is not provided.
+	Jobs []JobInfo `json:"jobs,omitempty"`
+}
+
+// SavepointInfo defines a savepoint of a job.
+type SavepointInfo struct {
+	// Savepoint location.
+	Location string `json:"location"`
+
+	// Savepoint trigger ID.
+	TriggerID string `json:"triggerID,omitempty"`
+
+	// The time when the savepoint completed.
+	Time string `json:"time"`
+
+	// The type of the savepoint, Periodic, Manual, Upgrade or Final.
+	Type string `json:"type"`
+}
+
+// CompletedCheckpoint defines a completed checkpoint of a job.
+type CompletedCheckpoint struct {
+	// The ID of the checkpoint.
+	ID int64 `json:"id"`
+
+	// The external path of the checkpoint, empty if it is not retained.
+	Path string `json:"path,omitempty"`
+
+	// The time when the checkpoint completed.
+	Time string `json:"time"`
+
+	// The size of the checkpointed state in bytes.
+	StateSize int64 `json:"stateSize"`
+
+	// The end to end duration of the checkpoint.
+	Duration string `json:"duration"`
+}
+
+// CheckpointStatus defines the checkpoint statistics of a job. The time since
+// the last successful checkpoint is not recorded, as it would change the
+// status on every reconcile; consumers derive it from the time of the latest
+// completed checkpoint, or from the start time of the job if there is none.
+type CheckpointStatus struct {
+	// The latest completed checkpoint, nil if there is none. Its time is the
+	// time of the last successful checkpoint.
+	LatestCompleted *CompletedCheckpoint `json:"latestCompleted,omitempty"`
+
+	// The number of completed checkpoints.
+	CompletedCount int64 `json:"completedCount"`
+
+	// The number of failed checkpoints.
+	FailedCount int64 `json:"failedCount"`
+}
+
+// JobCondition defines a condition of a job.
+type JobCondition struct {
+	// The type of the condition, e.g., CheckpointStale.
+	Type string `json:"type"`
+
+	// The status of the condition, True, False or Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// The reason for the last transition of the condition.
+	Reason string `json:"reason,omitempty"`
+
+	// A human readable message about the last transition.
+	Message string `json:"message,omitempty"`
+
+	// The time when the condition last transitioned from one status to
+	// another.
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+// JobVertexStatus defines the status of a vertex of the job graph.
+type JobVertexStatus struct {
+	// The ID of the vertex.
+	ID string `json:"id"`
+
+	// The name of the vertex.
+	Name string `json:"name"`
+
+	// The parallelism of the vertex.
+	Parallelism int32 `json:"parallelism"`
 }
 
 // JobStatus defines the status of a job.
 type JobStatus struct {
-	// The name of the Kubernetes job resource.
+	// The name of the Kubernetes job resource, empty if the job was submitted
+	// through the Flink REST API.
 	Name string `json:"name"`
 
 	// The ID of the Flink job.
 	ID string `json:"id"`
 
-	// The state of the Kubernetes job.
+	// The state of the job, derived from the state of the Flink job if it is
+	// observed, otherwise from the state of the Kubernetes job.
 	State string `json:"state"`
 
+	// The state of the Flink job as reported by Flink, e.g., CREATED, RUNNING,
+	// FAILING, RESTARTING, CANCELED or FINISHED.
+	FlinkJobState string `json:"flinkJobState,omitempty"`
+
+	// The time when the Flink job started.
+	StartTime string `json:"startTime,omitempty"`
+
+	// The time when the Flink job ended, empty until it ends.
+	EndTime string `json:"endTime,omitempty"`
+
+	// The duration of the Flink job, set when the job has ended. The duration
+	// of a running job is the time since its start time.
+	Duration string `json:"duration,omitempty"`
+
+	// The number of times Flink restarted the job according to its restart
+	// strategy, which is not counted in RestartCount.
+	FlinkRestartCount int32 `json:"flinkRestartCount,omitempty"`
+
+	// The vertices of the job graph of the Flink job.
+	Vertices []JobVertexStatus `json:"vertices,omitempty"`
+
+	// The root exception of the last failure of the Flink job, truncated if
+	// it is too long.
+	FailureReason string `json:"failureReason,omitempty"`
+
+	// The time when the last failure of the Flink job occurred.
+	FailureTime string `json:"failureTime,omitempty"`
+
+	// The checkpoint statistics of the Flink job. The time since the last
+	// successful checkpoint is the time since the latest completed checkpoint,
+	// or since the start of the job if there is none.
+	Checkpoints *CheckpointStatus `json:"checkpoints,omitempty"`
+
+	// The conditions of the job.
+	Conditions []JobCondition `json:"conditions,omitempty"`
+
+	// Savepoint location which the current job was restored from. It takes
+	// precedence over the savepoint in the job spec when the job is
+	// resubmitted, e.g., after an upgrade.
+	FromSavepoint string `json:"fromSavepoint,omitempty"`
+
+	// The hash of the job spec which the job was submitted with through the
+	// Flink REST API, the job is upgraded when the hash of the job spec
+	// changes. The parallelism is not hashed, its change rescales the job.
+	SubmittedSpecHash string `json:"submittedSpecHash,omitempty"`
+
+	// The phase of the ongoing stateful upgrade, empty if there is none.
+	UpgradePhase string `json:"upgradePhase,omitempty"`
+
+	// The savepoints dir of the job spec, recorded so that the job is stopped
+	// with the final savepoint in the dir after it is removed from the spec.
+	SavepointsDir string `json:"savepointsDir,omitempty"`
+
+	// The timeout of the final savepoint of the job spec, recorded so that it
+	// applies after the job is removed from the spec.
+	FinalSavepointTimeoutSeconds *int32 `json:"finalSavepointTimeoutSeconds,omitempty"`
+
+	// The phase of stopping the job with a final savepoint, empty if the job
+	// is not being stopped.
+	StopPhase string `json:"stopPhase,omitempty"`
+
+	// The time when the job started to stop.
+	StopTime string `json:"stopTime,omitempty"`
+
+	// The parallelism which the job was submitted with or rescaled to, zero
+	// if it is the parallelism in the args of the job submitter.
+	Parallelism int32 `json:"parallelism,omitempty"`
+
+	// The trigger ID of the ongoing rescaling through the Flink rescale API,
+	// empty if there is none.
+	RescaleTriggerID string `json:"rescaleTriggerID,omitempty"`
+
+	// The parallelism which the ongoing rescaling rescales the job to.
+	RescaleParallelism int32 `json:"rescaleParallelism,omitempty"`
+
+	// The parallelism which the job is waiting to be rescaled to, e.g., until
+	// the TaskManagers have enough task slots.
+	PendingRescaleParallelism int32 `json:"pendingRescaleParallelism,omitempty"`
+
+	// The parallelism which the job could not be rescaled to, the job is not
+	// rescaled again until the parallelism of the job spec changes.
+	SkippedRescaleParallelism int32 `json:"skippedRescaleParallelism,omitempty"`
+
+	// The Flink version of the cluster which runs the job, it is fetched from
+	// the Flink API when the job is rescaled for the first time.
+	FlinkVersion string `json:"flinkVersion,omitempty"`
+
 	// Savepoint location.
 	SavepointLocation string `json:"savepointLocation,omitempty"`
 
 	// Last savepoint trigger ID.
 	LastSavepointTriggerID string `json:"lastSavepointTriggerID,omitempty"`
 
+	// Last savepoint trigger timestamp.
+	LastSavepointTriggerTime string `json:"lastSavepointTriggerTime,omitempty"`
+
+	// The type of the last savepoint, recorded when it is triggered.
+	LastSavepointType string `json:"lastSavepointType,omitempty"`
+
+	// The savepoint generation of the job spec when the last savepoint was
+	// triggered, the savepoint serves the requests up to the generation once
+	// it completes.
+	LastSavepointTriggerGeneration int32 `json:"lastSavepointTriggerGeneration,omitempty"`
+
+	// The state of the last savepoint operation.
+	LastSavepointState string `json:"lastSavepointState,omitempty"`
+
+	// The reason why the last savepoint operation failed.
+	LastSavepointFailureReason string `json:"lastSavepointFailureReason,omitempty"`
+
 	// Last successful or failed savepoint operation timestamp.
 	LastSavepointTime string `json:"lastSavepointTime,omitempty"`
+
+	// The savepoint generation of the job spec which the last savepoint was
+	// taken for.
+	SavepointGeneration int32 `json:"savepointGeneration,omitempty"`
+
+	// The history of the successful savepoints, the latest one is the last.
+	SavepointHistory []SavepointInfo `json:"savepointHistory,omitempty"`
+
+	// The number of times the operator restarted the failed job.
+	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// The time when the operator last restarted the failed job.
+	LastRestartTime string `json:"lastRestartTime,omitempty"`
+
+	// The time when the failed job is going to be restarted after the backoff,
+	// empty if there is no pending restart.
+	NextRestartTime string `json:"nextRestartTime,omitempty"`
+}
+
+// JobInfo defines a Flink job in a session cluster.
+type JobInfo struct {
+	// The ID of the Flink job.
+	ID string `json:"id"`
+
+	// The name of the Flink job.
+	Name string `json:"name"`
+
+	// The state of the Flink job as reported by Flink, e.g., RUNNING or
+	// FINISHED.
+	State string `json:"state"`
+
+	// The time when the Flink job started.
+	StartTime string `json:"startTime,omitempty"`
 }
 
 // JobManagerIngressStatus defines the status of a JobManager ingress.
@@ -368,9 +831,18 @@ type FlinkClusterStatus struct {
 
 	// Last update timestamp for this status.
 	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+
+	// The number of TaskManager replicas observed in the TaskManager
+	// deployment or StatefulSet, for the scale subresource.
+	TaskManagerReplicas int32 `json:"taskManagerReplicas,omitempty"`
+
+	// The label selector of the TaskManager pods in the string form, for the
+	// scale subresource, e.g., for HorizontalPodAutoscaler.
+	TaskManagerSelector string `json:"taskManagerSelector,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:scale:specpath=.spec.taskManager.replicas,statuspath=.status.taskManagerReplicas,selectorpath=.status.taskManagerSelector
 
 // FlinkCluster is the Schema for the flinkclusters API
 type FlinkCluster struct {
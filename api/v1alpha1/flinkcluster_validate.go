@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	"fmt"
+	"net/url"
 	"reflect"
 
 	corev1 "k8s.io/api/core/v1"
@@ -38,7 +39,8 @@ func (v *Validator) ValidateCreate(cluster *FlinkCluster) error {
 	if err != nil {
 		return err
 	}
-	err = v.validateJobManager(&cluster.Spec.JobManager)
+	err = v.validateJobManager(
+		&cluster.Spec.JobManager, cluster.Spec.HighAvailability, cluster.Spec.Job)
 	if err != nil {
 		return err
 	}
@@ -50,15 +52,71 @@ func (v *Validator) ValidateCreate(cluster *FlinkCluster) error {
 	if err != nil {
 		return err
 	}
+	err = v.validateRESTSecurity(cluster.Spec.RESTSecurity)
+	if err != nil {
+		return err
+	}
+	err = v.validateHighAvailability(cluster.Spec.HighAvailability)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
 // ValidateUpdate validates update request.
+//
+// Most of the spec (e.g., image, TaskManager replicas, resources,
+// flinkProperties, envVars and job args) can be updated in place, the changes
+// will be rolled out by the operator. Fields which cannot be changed once the
+// cluster is created (e.g., ports) are rejected.
 func (v *Validator) ValidateUpdate(old *FlinkCluster, new *FlinkCluster) error {
-	if !reflect.DeepEqual(new.Spec, old.Spec) {
+	// Status or metadata update.
+	if reflect.DeepEqual(new.Spec, old.Spec) {
+		return nil
+	}
+
+	var err = v.validateImmutableFields(&old.Spec, &new.Spec)
+	if err != nil {
+		return err
+	}
+
+	return v.ValidateCreate(new)
+}
+
+func (v *Validator) validateImmutableFields(
+	old *FlinkClusterSpec, new *FlinkClusterSpec) error {
+	var immutableFields = []struct {
+		name     string
+		oldValue interface{}
+		newValue interface{}
+	}{
+		{"jobManager.ports.rpc", old.JobManager.Ports.RPC, new.JobManager.Ports.RPC},
+		{"jobManager.ports.blob", old.JobManager.Ports.Blob, new.JobManager.Ports.Blob},
+		{"jobManager.ports.query", old.JobManager.Ports.Query, new.JobManager.Ports.Query},
+		{"jobManager.ports.ui", old.JobManager.Ports.UI, new.JobManager.Ports.UI},
+		{"jobManager.volumeClaimTemplates", old.JobManager.VolumeClaimTemplates, new.JobManager.VolumeClaimTemplates},
+		{"taskManager.ports.data", old.TaskManager.Ports.Data, new.TaskManager.Ports.Data},
+		{"taskManager.ports.rpc", old.TaskManager.Ports.RPC, new.TaskManager.Ports.RPC},
+		{"taskManager.ports.query", old.TaskManager.Ports.Query, new.TaskManager.Ports.Query},
+		{"taskManager.volumeClaimTemplates", old.TaskManager.VolumeClaimTemplates, new.TaskManager.VolumeClaimTemplates},
+	}
+	for _, field := range immutableFields {
+		if !reflect.DeepEqual(field.oldValue, field.newValue) {
+			return fmt.Errorf(
+				"updating %v is not allowed, please delete the resource and recreate",
+				field.name)
+		}
+	}
+	// Both the resources would run JobManagers while the kind is switched.
+	if old.JobManager.IsStatefulSet() != new.JobManager.IsStatefulSet() {
+		return fmt.Errorf(
+			"updating jobManager.deploymentType is not allowed, please delete the resource and recreate")
+	}
+	// The job submitted in one mode is not tracked in the other mode.
+	if old.Job != nil && new.Job != nil &&
+		old.Job.IsRESTSubmission() != new.Job.IsRESTSubmission() {
 		return fmt.Errorf(
-			"updating FlinkCluster spec is not allowed," +
-				" please delete the resouce and recreate")
+			"updating job.submissionMode is not allowed, please delete the resource and recreate")
 	}
 	return nil
 }
@@ -87,12 +145,39 @@ func (v *Validator) validateImage(imageSpec *ImageSpec) error {
 	return nil
 }
 
-func (v *Validator) validateJobManager(jmSpec *JobManagerSpec) error {
+func (v *Validator) validateJobManager(
+	jmSpec *JobManagerSpec, haSpec *HighAvailabilitySpec, jobSpec *JobSpec) error {
 	var err error
 
-	// Replicas.
-	if jmSpec.Replicas == nil || *jmSpec.Replicas != 1 {
-		return fmt.Errorf("invalid JobManager replicas, it must be 1")
+	// Replicas, the standby JobManagers require high availability. The
+	// operator doesn't route the requests to the Flink REST API to the leader,
+	// but the savepoints, rescalings and uploaded JAR files of the job are
+	// only known to the JobManager which the requests reach, so the job
+	// cluster must have a single JobManager.
+	if haSpec == nil {
+		if jmSpec.Replicas == nil || *jmSpec.Replicas != 1 {
+			return fmt.Errorf("invalid JobManager replicas, it must be 1")
+		}
+	} else if jmSpec.Replicas == nil || *jmSpec.Replicas < 1 {
+		return fmt.Errorf("invalid JobManager replicas, it must be >= 1")
+	} else if jobSpec != nil && *jmSpec.Replicas != 1 {
+		return fmt.Errorf(
+			"invalid JobManager replicas, it must be 1 for a job cluster")
+	}
+
+	// DeploymentType.
+	if jmSpec.DeploymentType != nil {
+		switch *jmSpec.DeploymentType {
+		case DeploymentType.Deployment:
+		case DeploymentType.StatefulSet:
+		default:
+			return fmt.Errorf(
+				"invalid JobManager deploymentType: %v", *jmSpec.DeploymentType)
+		}
+	}
+	if len(jmSpec.VolumeClaimTemplates) > 0 && !jmSpec.IsStatefulSet() {
+		return fmt.Errorf(
+			"JobManager volumeClaimTemplates are only supported with deploymentType StatefulSet")
 	}
 
 	// AccessScope.
@@ -165,15 +250,68 @@ func (v *Validator) validateJob(jobSpec *JobSpec) error {
 		return fmt.Errorf("job parallelism must be >= 1")
 	}
 
+	if jobSpec.Savepoint != nil && jobSpec.SavepointRef != nil {
+		return fmt.Errorf("job savepoint and savepointRef cannot be both specified")
+	}
+
+	if jobSpec.SavepointGeneration < 0 {
+		return fmt.Errorf("job savepointGeneration must be >= 0")
+	}
+	if jobSpec.SavepointGeneration > 0 && jobSpec.SavepointsDir == nil {
+		return fmt.Errorf(
+			"job savepointsDir is required for taking savepoints on demand")
+	}
+
+	if jobSpec.MaxSavepointsToKeep != nil && *jobSpec.MaxSavepointsToKeep < 1 {
+		return fmt.Errorf("job maxSavepointsToKeep must be >= 1")
+	}
+
+	if jobSpec.FinalSavepointTimeoutSeconds != nil &&
+		*jobSpec.FinalSavepointTimeoutSeconds < 1 {
+		return fmt.Errorf("job finalSavepointTimeoutSeconds must be >= 1")
+	}
+
+	if jobSpec.CheckpointStaleThresholdSeconds != nil &&
+		*jobSpec.CheckpointStaleThresholdSeconds < 1 {
+		return fmt.Errorf("job checkpointStaleThresholdSeconds must be >= 1")
+	}
+
+	if jobSpec.SubmissionMode != nil {
+		switch *jobSpec.SubmissionMode {
+		case JobSubmissionMode.Submitter:
+		case JobSubmissionMode.REST:
+			if len(jobSpec.Volumes) > 0 || len(jobSpec.Mounts) > 0 {
+				return fmt.Errorf(
+					"job volumes and mounts are not supported with submissionMode REST")
+			}
+			var jarURL, err = url.Parse(jobSpec.JarFile)
+			if err != nil || len(jarURL.Scheme) == 0 {
+				return fmt.Errorf(
+					"job jarFile must be a URL with submissionMode REST, e.g., https://example.com/myjob.jar")
+			}
+		default:
+			return fmt.Errorf(
+				"invalid job submissionMode: %v", *jobSpec.SubmissionMode)
+		}
+	}
+
 	if jobSpec.RestartPolicy == nil {
 		return fmt.Errorf("job restartPolicy is unspecified")
 	}
 	switch *jobSpec.RestartPolicy {
 	case corev1.RestartPolicyNever:
 	case corev1.RestartPolicyOnFailure:
+		if jobSpec.IsRESTSubmission() {
+			return fmt.Errorf(
+				"job restartPolicy OnFailure is not supported with submissionMode REST")
+		}
+	case corev1.RestartPolicy(JobRestartPolicy.FromSavepointOnFailure):
 	default:
 		return fmt.Errorf("invalid job restartPolicy: %v", *jobSpec.RestartPolicy)
 	}
+	if jobSpec.MaxRestarts != nil && *jobSpec.MaxRestarts < 0 {
+		return fmt.Errorf("job maxRestarts must be >= 0")
+	}
 
 	if jobSpec.CleanupPolicy == nil {
 		return fmt.Errorf("job cleanupPolicy is unspecified")
@@ -192,6 +330,48 @@ func (v *Validator) validateJob(jobSpec *JobSpec) error {
 	return nil
 }
 
+func (v *Validator) validateRESTSecurity(securitySpec *RESTSecuritySpec) error {
+	if securitySpec == nil {
+		return nil
+	}
+	if securitySpec.TLS != nil {
+		if len(securitySpec.TLS.KeystoreSecret) == 0 {
+			return fmt.Errorf("restSecurity tls keystoreSecret is unspecified")
+		}
+		if len(securitySpec.TLS.CASecret) == 0 {
+			return fmt.Errorf("restSecurity tls caSecret is unspecified")
+		}
+		if securitySpec.TLS.ClientCertSecret != nil &&
+			len(*securitySpec.TLS.ClientCertSecret) == 0 {
+			return fmt.Errorf("restSecurity tls clientCertSecret is empty")
+		}
+	}
+	if securitySpec.AuthHeadersSecret != nil &&
+		len(*securitySpec.AuthHeadersSecret) == 0 {
+		return fmt.Errorf("restSecurity authHeadersSecret is empty")
+	}
+	return nil
+}
+
+func (v *Validator) validateHighAvailability(haSpec *HighAvailabilitySpec) error {
+	if haSpec == nil {
+		return nil
+	}
+	switch haSpec.Mode {
+	case HighAvailabilityMode.Kubernetes:
+	case HighAvailabilityMode.ZooKeeper:
+		if haSpec.ZooKeeper == nil || len(haSpec.ZooKeeper.Quorum) == 0 {
+			return fmt.Errorf("highAvailability zookeeper quorum is unspecified")
+		}
+	default:
+		return fmt.Errorf("invalid highAvailability mode: %v", haSpec.Mode)
+	}
+	if len(haSpec.StorageDir) == 0 {
+		return fmt.Errorf("highAvailability storageDir is unspecified")
+	}
+	return nil
+}
+
 func (v *Validator) validatePort(
 	port *int32, name string, component string) error {
 	if port == nil {
@@ -443,6 +443,235 @@ func TestInvalidJobSpec(t *testing.T) {
 	assert.Equal(t, err.Error(), expectedErr)
 }
 
+func TestInvalidMaxSavepointsToKeep(t *testing.T) {
+	var maxSavepointsToKeep int32 = 0
+	var cluster = getValidFlinkCluster()
+	cluster.Spec.Job.MaxSavepointsToKeep = &maxSavepointsToKeep
+	var validator = &Validator{}
+	var err = validator.ValidateCreate(&cluster)
+	var expectedErr = "job maxSavepointsToKeep must be >= 1"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidFinalSavepointTimeout(t *testing.T) {
+	var timeout int32 = 0
+	var cluster = getValidFlinkCluster()
+	cluster.Spec.Job.FinalSavepointTimeoutSeconds = &timeout
+	var validator = &Validator{}
+	var err = validator.ValidateCreate(&cluster)
+	var expectedErr = "job finalSavepointTimeoutSeconds must be >= 1"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidCheckpointStaleThreshold(t *testing.T) {
+	var threshold int32 = 0
+	var cluster = getValidFlinkCluster()
+	cluster.Spec.Job.CheckpointStaleThresholdSeconds = &threshold
+	var validator = &Validator{}
+	var err = validator.ValidateCreate(&cluster)
+	var expectedErr = "job checkpointStaleThresholdSeconds must be >= 1"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidSavepointRef(t *testing.T) {
+	var savepoint = "gs://my-bucket/savepoint-1234"
+	var cluster = getValidFlinkCluster()
+	cluster.Spec.Job.Savepoint = &savepoint
+	cluster.Spec.Job.SavepointRef = &corev1.LocalObjectReference{
+		Name: "my-savepoint"}
+	var validator = &Validator{}
+	var err = validator.ValidateCreate(&cluster)
+	var expectedErr = "job savepoint and savepointRef cannot be both specified"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidSavepointGeneration(t *testing.T) {
+	var validator = &Validator{}
+	var cluster = getValidFlinkCluster()
+	cluster.Spec.Job.SavepointGeneration = -1
+	var err = validator.ValidateCreate(&cluster)
+	var expectedErr = "job savepointGeneration must be >= 0"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster.Spec.Job.SavepointGeneration = 1
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "job savepointsDir is required for taking savepoints on demand"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestFromSavepointOnFailureRestartPolicy(t *testing.T) {
+	var restartPolicy = corev1.RestartPolicy(
+		JobRestartPolicy.FromSavepointOnFailure)
+	var maxRestarts int32 = 5
+	var validator = &Validator{}
+	var cluster = getValidFlinkCluster()
+	cluster.Spec.Job.RestartPolicy = &restartPolicy
+	cluster.Spec.Job.MaxRestarts = &maxRestarts
+	var err = validator.ValidateCreate(&cluster)
+	assert.NilError(t, err)
+
+	maxRestarts = -1
+	err = validator.ValidateCreate(&cluster)
+	var expectedErr = "job maxRestarts must be >= 0"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestRESTSubmissionMode(t *testing.T) {
+	var submissionMode = JobSubmissionMode.REST
+	var restartPolicy = corev1.RestartPolicyNever
+	var validator = &Validator{}
+	var cluster = getValidFlinkCluster()
+	cluster.Spec.Job.SubmissionMode = &submissionMode
+	cluster.Spec.Job.RestartPolicy = &restartPolicy
+	var err = validator.ValidateCreate(&cluster)
+	assert.NilError(t, err)
+
+	cluster.Spec.Job.Mounts = []corev1.VolumeMount{
+		{Name: "cache", MountPath: "/cache"}}
+	err = validator.ValidateCreate(&cluster)
+	var expectedErr = "job volumes and mounts are not supported with submissionMode REST"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster = getValidFlinkCluster()
+	cluster.Spec.Job.SubmissionMode = &submissionMode
+	cluster.Spec.Job.RestartPolicy = &restartPolicy
+	cluster.Spec.Job.JarFile = "/opt/flink/examples/streaming/WordCount.jar"
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "job jarFile must be a URL with submissionMode REST, e.g., https://example.com/myjob.jar"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster = getValidFlinkCluster()
+	cluster.Spec.Job.SubmissionMode = &submissionMode
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "job restartPolicy OnFailure is not supported with submissionMode REST"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	submissionMode = "XXX"
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "invalid job submissionMode: XXX"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidRESTSecurity(t *testing.T) {
+	var validator = &Validator{}
+	var cluster = getValidFlinkCluster()
+	var clientCertSecret = "operator-cert"
+	cluster.Spec.RESTSecurity = &RESTSecuritySpec{
+		TLS: &RESTTLSSpec{
+			KeystoreSecret:   "rest-keystore",
+			CASecret:         "rest-ca",
+			ClientCertSecret: &clientCertSecret,
+		},
+	}
+	var err = validator.ValidateCreate(&cluster)
+	assert.NilError(t, err)
+
+	cluster.Spec.RESTSecurity.TLS.CASecret = ""
+	err = validator.ValidateCreate(&cluster)
+	var expectedErr = "restSecurity tls caSecret is unspecified"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster.Spec.RESTSecurity.TLS.KeystoreSecret = ""
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "restSecurity tls keystoreSecret is unspecified"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	var authHeadersSecret = ""
+	cluster.Spec.RESTSecurity = &RESTSecuritySpec{
+		AuthHeadersSecret: &authHeadersSecret}
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "restSecurity authHeadersSecret is empty"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestHighAvailability(t *testing.T) {
+	var validator = &Validator{}
+	var cluster = getValidFlinkCluster()
+	var jmReplicas int32 = 2
+	cluster.Spec.JobManager.Replicas = &jmReplicas
+	var err = validator.ValidateCreate(&cluster)
+	var expectedErr = "invalid JobManager replicas, it must be 1"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	// Standby JobManagers are allowed with high availability, but only in a
+	// session cluster.
+	cluster.Spec.HighAvailability = &HighAvailabilitySpec{
+		Mode:       HighAvailabilityMode.Kubernetes,
+		StorageDir: "gs://my-bucket/flink-ha",
+	}
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "invalid JobManager replicas, it must be 1 for a job cluster"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster.Spec.Job = nil
+	err = validator.ValidateCreate(&cluster)
+	assert.NilError(t, err)
+
+	jmReplicas = 0
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "invalid JobManager replicas, it must be >= 1"
+	assert.Equal(t, err.Error(), expectedErr)
+	jmReplicas = 2
+
+	cluster.Spec.HighAvailability.StorageDir = ""
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "highAvailability storageDir is unspecified"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster.Spec.HighAvailability = &HighAvailabilitySpec{
+		Mode:       HighAvailabilityMode.ZooKeeper,
+		StorageDir: "gs://my-bucket/flink-ha",
+	}
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "highAvailability zookeeper quorum is unspecified"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster.Spec.HighAvailability.ZooKeeper = &ZooKeeperHASpec{
+		Quorum: "zk-0.zk:2181,zk-1.zk:2181,zk-2.zk:2181"}
+	err = validator.ValidateCreate(&cluster)
+	assert.NilError(t, err)
+
+	cluster.Spec.HighAvailability.Mode = "XXX"
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "invalid highAvailability mode: XXX"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestJobManagerDeploymentType(t *testing.T) {
+	var validator = &Validator{}
+	var cluster = getValidFlinkCluster()
+	var deploymentType = "XXX"
+	cluster.Spec.JobManager.DeploymentType = &deploymentType
+	var err = validator.ValidateCreate(&cluster)
+	var expectedErr = "invalid JobManager deploymentType: XXX"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	deploymentType = DeploymentType.Deployment
+	cluster.Spec.JobManager.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		{ObjectMeta: metav1.ObjectMeta{Name: "jobmanager-data"}}}
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "JobManager volumeClaimTemplates are only supported" +
+		" with deploymentType StatefulSet"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	deploymentType = DeploymentType.StatefulSet
+	err = validator.ValidateCreate(&cluster)
+	assert.NilError(t, err)
+
+	// Neither the kind nor the claims can be updated.
+	var oldCluster = getValidFlinkCluster()
+	err = validator.ValidateUpdate(&oldCluster, &cluster)
+	expectedErr = "updating jobManager.volumeClaimTemplates is not allowed," +
+		" please delete the resource and recreate"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster.Spec.JobManager.VolumeClaimTemplates = nil
+	err = validator.ValidateUpdate(&oldCluster, &cluster)
+	expectedErr = "updating jobManager.deploymentType is not allowed," +
+		" please delete the resource and recreate"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
 func TestUpdateStatusAllowed(t *testing.T) {
 	var oldCluster = FlinkCluster{Status: FlinkClusterStatus{State: "NoReady"}}
 	var newCluster = FlinkCluster{Status: FlinkClusterStatus{State: "Running"}}
@@ -451,12 +680,114 @@ func TestUpdateStatusAllowed(t *testing.T) {
 	assert.NilError(t, err, "updating status failed unexpectedly")
 }
 
-func TestUpdateSpecNotAllowed(t *testing.T) {
-	var oldCluster = FlinkCluster{Spec: FlinkClusterSpec{Image: ImageSpec{Name: "flink:1.8.1"}}}
-	var newCluster = FlinkCluster{Spec: FlinkClusterSpec{Image: ImageSpec{Name: "flink:1.9.0"}}}
+func TestUpdateMutableSpecAllowed(t *testing.T) {
+	var oldCluster = getValidFlinkCluster()
+	var newCluster = getValidFlinkCluster()
+	newCluster.Spec.Image.Name = "flink:1.9.0"
+	newCluster.Spec.TaskManager.Replicas = 5
+	newCluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "2"}
+	newCluster.Spec.EnvVars = []corev1.EnvVar{{Name: "FOO", Value: "bar"}}
+	newCluster.Spec.Job.Args = []string{"--input", "./README.txt"}
 	var validator = &Validator{}
 	var err = validator.ValidateUpdate(&oldCluster, &newCluster)
-	var expectedErr = "updating FlinkCluster spec is not allowed," +
-		" please delete the resouce and recreate"
+	assert.NilError(t, err, "updating mutable fields failed unexpectedly")
+}
+
+func TestUpdateImmutableSpecNotAllowed(t *testing.T) {
+	var validator = &Validator{}
+	var newPort int32 = 9000
+
+	var oldCluster = getValidFlinkCluster()
+	var newCluster = getValidFlinkCluster()
+	newCluster.Spec.JobManager.Ports.UI = &newPort
+	var err = validator.ValidateUpdate(&oldCluster, &newCluster)
+	var expectedErr = "updating jobManager.ports.ui is not allowed," +
+		" please delete the resource and recreate"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	newCluster = getValidFlinkCluster()
+	newCluster.Spec.TaskManager.Ports.Data = &newPort
+	err = validator.ValidateUpdate(&oldCluster, &newCluster)
+	expectedErr = "updating taskManager.ports.data is not allowed," +
+		" please delete the resource and recreate"
 	assert.Equal(t, err.Error(), expectedErr)
+
+	newCluster = getValidFlinkCluster()
+	newCluster.Spec.TaskManager.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		{ObjectMeta: metav1.ObjectMeta{Name: "local-state"}}}
+	err = validator.ValidateUpdate(&oldCluster, &newCluster)
+	expectedErr = "updating taskManager.volumeClaimTemplates is not allowed," +
+		" please delete the resource and recreate"
+	assert.Equal(t, err.Error(), expectedErr)
+
+	var submissionMode = JobSubmissionMode.REST
+	var restartPolicy = corev1.RestartPolicyNever
+	newCluster = getValidFlinkCluster()
+	newCluster.Spec.Job.SubmissionMode = &submissionMode
+	newCluster.Spec.Job.RestartPolicy = &restartPolicy
+	err = validator.ValidateUpdate(&oldCluster, &newCluster)
+	expectedErr = "updating job.submissionMode is not allowed," +
+		" please delete the resource and recreate"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestUpdateInvalidSpecNotAllowed(t *testing.T) {
+	var oldCluster = getValidFlinkCluster()
+	var newCluster = getValidFlinkCluster()
+	newCluster.Spec.TaskManager.Replicas = 0
+	var validator = &Validator{}
+	var err = validator.ValidateUpdate(&oldCluster, &newCluster)
+	var expectedErr = "invalid TaskManager replicas, it must >= 1"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func getValidFlinkCluster() FlinkCluster {
+	var jmReplicas int32 = 1
+	var rpcPort int32 = 8001
+	var blobPort int32 = 8002
+	var queryPort int32 = 8003
+	var uiPort int32 = 8004
+	var dataPort int32 = 8005
+	var parallelism int32 = 2
+	var restartPolicy = corev1.RestartPolicyOnFailure
+	return FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mycluster",
+			Namespace: "default",
+		},
+		Spec: FlinkClusterSpec{
+			Image: ImageSpec{
+				Name:       "flink:1.8.1",
+				PullPolicy: corev1.PullPolicy("Always"),
+			},
+			JobManager: JobManagerSpec{
+				Replicas:    &jmReplicas,
+				AccessScope: AccessScope.VPC,
+				Ports: JobManagerPorts{
+					RPC:   &rpcPort,
+					Blob:  &blobPort,
+					Query: &queryPort,
+					UI:    &uiPort,
+				},
+			},
+			TaskManager: TaskManagerSpec{
+				Replicas: 3,
+				Ports: TaskManagerPorts{
+					RPC:   &rpcPort,
+					Data:  &dataPort,
+					Query: &queryPort,
+				},
+			},
+			Job: &JobSpec{
+				JarFile:       "gs://my-bucket/myjob.jar",
+				Parallelism:   &parallelism,
+				RestartPolicy: &restartPolicy,
+				CleanupPolicy: &CleanupPolicy{
+					AfterJobSucceeds: CleanupActionKeepCluster,
+					AfterJobFails:    CleanupActionDeleteTaskManager,
+				},
+			},
+		},
+	}
 }
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FlinkSavepointState defines states of a FlinkSavepoint.
+var FlinkSavepointState = struct {
+	Pending    string
+	InProgress string
+	Succeeded  string
+	Failed     string
+}{
+	Pending:    "Pending",
+	InProgress: "InProgress",
+	Succeeded:  "Succeeded",
+	Failed:     "Failed",
+}
+
+// FlinkSavepointSpec defines the desired state of FlinkSavepoint
+type FlinkSavepointSpec struct {
+	// The name of the FlinkCluster in the same namespace, whose job to take
+	// the savepoint of.
+	ClusterName string `json:"clusterName"`
+
+	// Savepoints dir where to store the savepoint, default: the savepoints dir
+	// of the job.
+	SavepointsDir *string `json:"savepointsDir,omitempty"`
+}
+
+// FlinkSavepointStatus defines the observed state of FlinkSavepoint
+type FlinkSavepointStatus struct {
+	// The state of the savepoint.
+	State string `json:"state"`
+
+	// The ID of the Flink job which the savepoint is taken of.
+	JobID string `json:"jobID,omitempty"`
+
+	// Savepoint trigger ID.
+	TriggerID string `json:"triggerID,omitempty"`
+
+	// Savepoint trigger timestamp.
+	TriggerTime string `json:"triggerTime,omitempty"`
+
+	// Savepoint location, available when the savepoint succeeded.
+	Location string `json:"location,omitempty"`
+
+	// The reason why the savepoint failed or is pending.
+	Reason string `json:"reason,omitempty"`
+
+	// Last update timestamp for this status.
+	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="Location",type="string",JSONPath=".status.location"
+
+// FlinkSavepoint is the Schema for the flinksavepoints API
+type FlinkSavepoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FlinkSavepointSpec   `json:"spec"`
+	Status FlinkSavepointStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// FlinkSavepointList contains a list of FlinkSavepoint
+type FlinkSavepointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FlinkSavepoint `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FlinkSavepoint{}, &FlinkSavepointList{})
+}
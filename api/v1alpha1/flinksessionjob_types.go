@@ -0,0 +1,142 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FlinkSessionJobSpec defines the desired state of FlinkSessionJob
+type FlinkSessionJobSpec struct {
+	// The name of the FlinkCluster in the same namespace which the job is
+	// submitted to, it must be a session cluster.
+	ClusterName string `json:"clusterName"`
+
+	// JAR file of the job, which the operator uploads to the cluster through
+	// the Flink REST API, so it must be readable by the operator, e.g., an
+	// http(s) URL.
+	JarFile string `json:"jarFile"`
+
+	// Fully qualified Java class name of the job.
+	ClassName *string `json:"className,omitempty"`
+
+	// Args of the job.
+	Args []string `json:"args,omitempty"`
+
+	// Savepoint where to restore the job from (e.g., gs://my-savepoint/1234).
+	Savepoint *string `json:"savepoint,omitempty"`
+
+	// Allow non-restored state, default: false.
+	AllowNonRestoredState *bool `json:"allowNonRestoredState,omitempty"`
+
+	// Job parallelism, default: the default parallelism of the cluster.
+	Parallelism *int32 `json:"parallelism,omitempty"`
+
+	// Savepoints dir where to store the savepoints of the job. It is required
+	// for taking savepoints on demand, and the job is cancelled with a final
+	// savepoint to it when the resource is deleted.
+	SavepointsDir *string `json:"savepointsDir,omitempty"`
+
+	// Timeout of cancelling the job when the resource is deleted, including
+	// the final savepoint, default: 300. The job is cancelled without the
+	// savepoint after the timeout, and the resource is deleted even if the
+	// job cannot be cancelled.
+	FinalSavepointTimeoutSeconds *int32 `json:"finalSavepointTimeoutSeconds,omitempty"`
+
+	// Savepoint generation of the job, increasing it triggers a savepoint to
+	// the savepoints dir on demand.
+	SavepointGeneration int32 `json:"savepointGeneration,omitempty"`
+}
+
+// FlinkSessionJobStatus defines the observed state of FlinkSessionJob
+type FlinkSessionJobStatus struct {
+	// The state of the job, Pending, Running, Succeeded, Failed or Cancelled.
+	State string `json:"state"`
+
+	// The reason why the job is pending or has failed.
+	Reason string `json:"reason,omitempty"`
+
+	// The time when the job was submitted. The job is submitted only once, so
+	// the submission is recorded before the job is run.
+	SubmitTime string `json:"submitTime,omitempty"`
+
+	// The ID of the Flink job.
+	ID string `json:"id,omitempty"`
+
+	// The state of the Flink job as reported by Flink, e.g., RUNNING or
+	// FINISHED.
+	FlinkJobState string `json:"flinkJobState,omitempty"`
+
+	// The time when the Flink job started.
+	StartTime string `json:"startTime,omitempty"`
+
+	// Last savepoint trigger ID.
+	LastSavepointTriggerID string `json:"lastSavepointTriggerID,omitempty"`
+
+	// Last savepoint trigger timestamp.
+	LastSavepointTriggerTime string `json:"lastSavepointTriggerTime,omitempty"`
+
+	// The state of the last savepoint operation.
+	LastSavepointState string `json:"lastSavepointState,omitempty"`
+
+	// The reason why the last savepoint operation failed.
+	LastSavepointFailureReason string `json:"lastSavepointFailureReason,omitempty"`
+
+	// Last successful or failed savepoint operation timestamp.
+	LastSavepointTime string `json:"lastSavepointTime,omitempty"`
+
+	// Whether the last savepoint cancels the job, i.e., it is the final
+	// savepoint taken when the FlinkSessionJob is deleted.
+	LastSavepointCancelsJob bool `json:"lastSavepointCancelsJob,omitempty"`
+
+	// The location of the last successful savepoint.
+	SavepointLocation string `json:"savepointLocation,omitempty"`
+
+	// The savepoint generation of the job spec which the last savepoint was
+	// taken for.
+	SavepointGeneration int32 `json:"savepointGeneration,omitempty"`
+
+	// Last update timestamp for this status.
+	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="Job ID",type="string",JSONPath=".status.id"
+
+// FlinkSessionJob is the Schema for the flinksessionjobs API
+type FlinkSessionJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FlinkSessionJobSpec   `json:"spec"`
+	Status FlinkSessionJobStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// FlinkSessionJobList contains a list of FlinkSessionJob
+type FlinkSessionJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FlinkSessionJob `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FlinkSessionJob{}, &FlinkSessionJobList{})
+}
@@ -25,6 +25,26 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointStatus) DeepCopyInto(out *CheckpointStatus) {
+	*out = *in
+	if in.LatestCompleted != nil {
+		in, out := &in.LatestCompleted, &out.LatestCompleted
+		*out = new(CompletedCheckpoint)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointStatus.
+func (in *CheckpointStatus) DeepCopy() *CheckpointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CleanupPolicy) DeepCopyInto(out *CleanupPolicy) {
 	*out = *in
@@ -40,6 +60,21 @@ func (in *CleanupPolicy) DeepCopy() *CleanupPolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompletedCheckpoint) DeepCopyInto(out *CompletedCheckpoint) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompletedCheckpoint.
+func (in *CompletedCheckpoint) DeepCopy() *CompletedCheckpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(CompletedCheckpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FlinkCluster) DeepCopyInto(out *FlinkCluster) {
 	*out = *in
@@ -97,7 +132,12 @@ func (in *FlinkClusterComponentsStatus) DeepCopyInto(out *FlinkClusterComponents
 	if in.Job != nil {
 		in, out := &in.Job, &out.Job
 		*out = new(JobStatus)
-		**out = **in
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Jobs != nil {
+		in, out := &in.Jobs, &out.Jobs
+		*out = make([]JobInfo, len(*in))
+		copy(*out, *in)
 	}
 }
 
@@ -168,6 +208,16 @@ func (in *FlinkClusterSpec) DeepCopyInto(out *FlinkClusterSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RESTSecurity != nil {
+		in, out := &in.RESTSecurity, &out.RESTSecurity
+		*out = new(RESTSecuritySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HighAvailability != nil {
+		in, out := &in.HighAvailability, &out.HighAvailability
+		*out = new(HighAvailabilitySpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkClusterSpec.
@@ -196,6 +246,244 @@ func (in *FlinkClusterStatus) DeepCopy() *FlinkClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkSavepoint) DeepCopyInto(out *FlinkSavepoint) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkSavepoint.
+func (in *FlinkSavepoint) DeepCopy() *FlinkSavepoint {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkSavepoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FlinkSavepoint) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkSavepointList) DeepCopyInto(out *FlinkSavepointList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]FlinkSavepoint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkSavepointList.
+func (in *FlinkSavepointList) DeepCopy() *FlinkSavepointList {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkSavepointList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FlinkSavepointList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkSavepointSpec) DeepCopyInto(out *FlinkSavepointSpec) {
+	*out = *in
+	if in.SavepointsDir != nil {
+		in, out := &in.SavepointsDir, &out.SavepointsDir
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkSavepointSpec.
+func (in *FlinkSavepointSpec) DeepCopy() *FlinkSavepointSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkSavepointSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkSavepointStatus) DeepCopyInto(out *FlinkSavepointStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkSavepointStatus.
+func (in *FlinkSavepointStatus) DeepCopy() *FlinkSavepointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkSavepointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkSessionJob) DeepCopyInto(out *FlinkSessionJob) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkSessionJob.
+func (in *FlinkSessionJob) DeepCopy() *FlinkSessionJob {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkSessionJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FlinkSessionJob) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkSessionJobList) DeepCopyInto(out *FlinkSessionJobList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]FlinkSessionJob, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkSessionJobList.
+func (in *FlinkSessionJobList) DeepCopy() *FlinkSessionJobList {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkSessionJobList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FlinkSessionJobList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkSessionJobSpec) DeepCopyInto(out *FlinkSessionJobSpec) {
+	*out = *in
+	if in.ClassName != nil {
+		in, out := &in.ClassName, &out.ClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Savepoint != nil {
+		in, out := &in.Savepoint, &out.Savepoint
+		*out = new(string)
+		**out = **in
+	}
+	if in.AllowNonRestoredState != nil {
+		in, out := &in.AllowNonRestoredState, &out.AllowNonRestoredState
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Parallelism != nil {
+		in, out := &in.Parallelism, &out.Parallelism
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SavepointsDir != nil {
+		in, out := &in.SavepointsDir, &out.SavepointsDir
+		*out = new(string)
+		**out = **in
+	}
+	if in.FinalSavepointTimeoutSeconds != nil {
+		in, out := &in.FinalSavepointTimeoutSeconds, &out.FinalSavepointTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkSessionJobSpec.
+func (in *FlinkSessionJobSpec) DeepCopy() *FlinkSessionJobSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkSessionJobSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkSessionJobStatus) DeepCopyInto(out *FlinkSessionJobStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkSessionJobStatus.
+func (in *FlinkSessionJobStatus) DeepCopy() *FlinkSessionJobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkSessionJobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HighAvailabilitySpec) DeepCopyInto(out *HighAvailabilitySpec) {
+	*out = *in
+	if in.ZooKeeper != nil {
+		in, out := &in.ZooKeeper, &out.ZooKeeper
+		*out = new(ZooKeeperHASpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HighAvailabilitySpec.
+func (in *HighAvailabilitySpec) DeepCopy() *HighAvailabilitySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HighAvailabilitySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageSpec) DeepCopyInto(out *ImageSpec) {
 	*out = *in
@@ -216,6 +504,36 @@ func (in *ImageSpec) DeepCopy() *ImageSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobCondition) DeepCopyInto(out *JobCondition) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobCondition.
+func (in *JobCondition) DeepCopy() *JobCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(JobCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobInfo) DeepCopyInto(out *JobInfo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobInfo.
+func (in *JobInfo) DeepCopy() *JobInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(JobInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JobManagerIngressSpec) DeepCopyInto(out *JobManagerIngressSpec) {
 	*out = *in
@@ -316,6 +634,11 @@ func (in *JobManagerSpec) DeepCopyInto(out *JobManagerSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.DeploymentType != nil {
+		in, out := &in.DeploymentType, &out.DeploymentType
+		*out = new(string)
+		**out = **in
+	}
 	if in.Ingress != nil {
 		in, out := &in.Ingress, &out.Ingress
 		*out = new(JobManagerIngressSpec)
@@ -337,6 +660,13 @@ func (in *JobManagerSpec) DeepCopyInto(out *JobManagerSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.VolumeClaimTemplates != nil {
+		in, out := &in.VolumeClaimTemplates, &out.VolumeClaimTemplates
+		*out = make([]v1.PersistentVolumeClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.NodeSelector != nil {
 		in, out := &in.NodeSelector, &out.NodeSelector
 		*out = make(map[string]string, len(*in))
@@ -374,6 +704,11 @@ func (in *JobSpec) DeepCopyInto(out *JobSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.SavepointRef != nil {
+		in, out := &in.SavepointRef, &out.SavepointRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
 	if in.AllowNonRestoredState != nil {
 		in, out := &in.AllowNonRestoredState, &out.AllowNonRestoredState
 		*out = new(bool)
@@ -389,6 +724,21 @@ func (in *JobSpec) DeepCopyInto(out *JobSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.MaxSavepointsToKeep != nil {
+		in, out := &in.MaxSavepointsToKeep, &out.MaxSavepointsToKeep
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FinalSavepointTimeoutSeconds != nil {
+		in, out := &in.FinalSavepointTimeoutSeconds, &out.FinalSavepointTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CheckpointStaleThresholdSeconds != nil {
+		in, out := &in.CheckpointStaleThresholdSeconds, &out.CheckpointStaleThresholdSeconds
+		*out = new(int32)
+		**out = **in
+	}
 	if in.Parallelism != nil {
 		in, out := &in.Parallelism, &out.Parallelism
 		*out = new(int32)
@@ -413,11 +763,21 @@ func (in *JobSpec) DeepCopyInto(out *JobSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.SubmissionMode != nil {
+		in, out := &in.SubmissionMode, &out.SubmissionMode
+		*out = new(string)
+		**out = **in
+	}
 	if in.RestartPolicy != nil {
 		in, out := &in.RestartPolicy, &out.RestartPolicy
 		*out = new(v1.RestartPolicy)
 		**out = **in
 	}
+	if in.MaxRestarts != nil {
+		in, out := &in.MaxRestarts, &out.MaxRestarts
+		*out = new(int32)
+		**out = **in
+	}
 	if in.CleanupPolicy != nil {
 		in, out := &in.CleanupPolicy, &out.CleanupPolicy
 		*out = new(CleanupPolicy)
@@ -438,6 +798,31 @@ func (in *JobSpec) DeepCopy() *JobSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JobStatus) DeepCopyInto(out *JobStatus) {
 	*out = *in
+	if in.Vertices != nil {
+		in, out := &in.Vertices, &out.Vertices
+		*out = make([]JobVertexStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Checkpoints != nil {
+		in, out := &in.Checkpoints, &out.Checkpoints
+		*out = new(CheckpointStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]JobCondition, len(*in))
+		copy(*out, *in)
+	}
+	if in.FinalSavepointTimeoutSeconds != nil {
+		in, out := &in.FinalSavepointTimeoutSeconds, &out.FinalSavepointTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SavepointHistory != nil {
+		in, out := &in.SavepointHistory, &out.SavepointHistory
+		*out = make([]SavepointInfo, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobStatus.
@@ -450,6 +835,81 @@ func (in *JobStatus) DeepCopy() *JobStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobVertexStatus) DeepCopyInto(out *JobVertexStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobVertexStatus.
+func (in *JobVertexStatus) DeepCopy() *JobVertexStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(JobVertexStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RESTSecuritySpec) DeepCopyInto(out *RESTSecuritySpec) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(RESTTLSSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AuthHeadersSecret != nil {
+		in, out := &in.AuthHeadersSecret, &out.AuthHeadersSecret
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RESTSecuritySpec.
+func (in *RESTSecuritySpec) DeepCopy() *RESTSecuritySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RESTSecuritySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RESTTLSSpec) DeepCopyInto(out *RESTTLSSpec) {
+	*out = *in
+	if in.ClientCertSecret != nil {
+		in, out := &in.ClientCertSecret, &out.ClientCertSecret
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RESTTLSSpec.
+func (in *RESTTLSSpec) DeepCopy() *RESTTLSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RESTTLSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SavepointInfo) DeepCopyInto(out *SavepointInfo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SavepointInfo.
+func (in *SavepointInfo) DeepCopy() *SavepointInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(SavepointInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TaskManagerPorts) DeepCopyInto(out *TaskManagerPorts) {
 	*out = *in
@@ -513,6 +973,13 @@ func (in *TaskManagerSpec) DeepCopyInto(out *TaskManagerSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.VolumeClaimTemplates != nil {
+		in, out := &in.VolumeClaimTemplates, &out.VolumeClaimTemplates
+		*out = make([]v1.PersistentVolumeClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TaskManagerSpec.
@@ -539,3 +1006,23 @@ func (in *Validator) DeepCopy() *Validator {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ZooKeeperHASpec) DeepCopyInto(out *ZooKeeperHASpec) {
+	*out = *in
+	if in.RootPath != nil {
+		in, out := &in.RootPath, &out.RootPath
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ZooKeeperHASpec.
+func (in *ZooKeeperHASpec) DeepCopy() *ZooKeeperHASpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ZooKeeperHASpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+)
+
+// Client is a Flink API client which sends all requests to the fake server
+// at URL, regardless of the API base URL of the cluster.
+type Client struct {
+	flinkclient.RESTClient
+	URL string
+}
+
+var _ flinkclient.FlinkClient = &Client{}
+
+// GetJobStatusList gets Flink job status list.
+func (c *Client) GetJobStatusList(
+	ctx context.Context,
+	apiBaseURL string, jobStatusList *flinkclient.JobStatusList) error {
+	return c.RESTClient.GetJobStatusList(ctx, c.URL, jobStatusList)
+}
+
+// GetJobsOverview gets the overview of all jobs in the cluster.
+func (c *Client) GetJobsOverview(
+	ctx context.Context, apiBaseURL string) (flinkclient.JobsOverview, error) {
+	return c.RESTClient.GetJobsOverview(ctx, c.URL)
+}
+
+// GetJobDetails gets the details of a job.
+func (c *Client) GetJobDetails(
+	ctx context.Context,
+	apiBaseURL string, jobID string) (flinkclient.JobDetails, error) {
+	return c.RESTClient.GetJobDetails(ctx, c.URL, jobID)
+}
+
+// GetJobMetrics gets the values of the given metrics of a job.
+func (c *Client) GetJobMetrics(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	names []string) (map[string]string, error) {
+	return c.RESTClient.GetJobMetrics(ctx, c.URL, jobID, names)
+}
+
+// GetJobExceptions gets the exceptions of a job.
+func (c *Client) GetJobExceptions(
+	ctx context.Context,
+	apiBaseURL string, jobID string) (flinkclient.JobExceptions, error) {
+	return c.RESTClient.GetJobExceptions(ctx, c.URL, jobID)
+}
+
+// TriggerSavepoint triggers an async savepoint operation.
+func (c *Client) TriggerSavepoint(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	dir string,
+	cancel bool) (flinkclient.SavepointTriggerID, error) {
+	return c.RESTClient.TriggerSavepoint(ctx, c.URL, jobID, dir, cancel)
+}
+
+// GetSavepointStatus returns savepoint status.
+func (c *Client) GetSavepointStatus(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	triggerID string) (flinkclient.SavepointStatus, error) {
+	return c.RESTClient.GetSavepointStatus(ctx, c.URL, jobID, triggerID)
+}
+
+// GetJobCheckpoints gets the checkpoint statistics of a job.
+func (c *Client) GetJobCheckpoints(
+	ctx context.Context,
+	apiBaseURL string, jobID string) (flinkclient.JobCheckpoints, error) {
+	return c.RESTClient.GetJobCheckpoints(ctx, c.URL, jobID)
+}
+
+// CancelJob cancels a job without taking a savepoint.
+func (c *Client) CancelJob(
+	ctx context.Context, apiBaseURL string, jobID string) error {
+	return c.RESTClient.CancelJob(ctx, c.URL, jobID)
+}
+
+// StopJobWithSavepoint triggers an async stop-with-savepoint operation.
+func (c *Client) StopJobWithSavepoint(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	dir string,
+	drain bool) (flinkclient.SavepointTriggerID, error) {
+	return c.RESTClient.StopJobWithSavepoint(ctx, c.URL, jobID, dir, drain)
+}
+
+// UploadJar uploads a JAR file to the cluster and returns its ID.
+func (c *Client) UploadJar(
+	ctx context.Context,
+	apiBaseURL string, fileName string, jar []byte) (string, error) {
+	return c.RESTClient.UploadJar(ctx, c.URL, fileName, jar)
+}
+
+// RunJar runs an uploaded JAR file and returns the ID of the job.
+func (c *Client) RunJar(
+	ctx context.Context,
+	apiBaseURL string,
+	jarID string,
+	request flinkclient.JarRunRequest) (string, error) {
+	return c.RESTClient.RunJar(ctx, c.URL, jarID, request)
+}
+
+// DeleteJar deletes an uploaded JAR file.
+func (c *Client) DeleteJar(
+	ctx context.Context, apiBaseURL string, jarID string) error {
+	return c.RESTClient.DeleteJar(ctx, c.URL, jarID)
+}
+
+// GetFlinkVersion gets the Flink version of the cluster.
+func (c *Client) GetFlinkVersion(
+	ctx context.Context, apiBaseURL string) (string, error) {
+	return c.RESTClient.GetFlinkVersion(ctx, c.URL)
+}
+
+// TriggerRescaling triggers an async rescaling operation.
+func (c *Client) TriggerRescaling(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	parallelism int32) (flinkclient.RescalingTriggerID, error) {
+	return c.RESTClient.TriggerRescaling(ctx, c.URL, jobID, parallelism)
+}
+
+// GetRescalingStatus returns rescaling status.
+func (c *Client) GetRescalingStatus(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	triggerID string) (flinkclient.RescalingStatus, error) {
+	return c.RESTClient.GetRescalingStatus(ctx, c.URL, jobID, triggerID)
+}
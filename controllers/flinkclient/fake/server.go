@@ -0,0 +1,669 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides an in-memory stand-in of the Flink REST API server
+// for testing.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Flink job states.
+const (
+	JobStateCreated    = "CREATED"
+	JobStateRunning    = "RUNNING"
+	JobStateFailing    = "FAILING"
+	JobStateRestarting = "RESTARTING"
+	JobStateFinished   = "FINISHED"
+	JobStateFailed     = "FAILED"
+	JobStateCanceled   = "CANCELED"
+)
+
+type job struct {
+	name  string
+	state string
+	// Unix timestamps in milliseconds, the end time is -1 until the job ends.
+	startTime int64
+	endTime   int64
+	restarts  int
+	vertices  []flinkclient.JobVertex
+	// The root exception of the last failure and when it occurred.
+	rootException string
+	exceptionTime int64
+}
+
+type savepoint struct {
+	jobID string
+	dir   string
+	// The state of the job after the savepoint succeeds, empty if the job
+	// keeps running.
+	jobState  string
+	completed bool
+	location  string
+	failed    bool
+}
+
+type rescaling struct {
+	jobID       string
+	parallelism int32
+	completed   bool
+	failed      bool
+}
+
+// Server is an in-memory Flink REST API server. It serves the job list and
+// overview, the details, metrics, exceptions, cancel, stop, savepoint, rescaling and checkpoint APIs of jobs, the
+// JAR upload, run and delete APIs and the cluster overview and config. Triggered savepoints and rescalings are in progress until their status is queried
+// for the first time, then they complete, and the job is cancelled, stopped or
+// rescaled if it was requested. Running a JAR starts a new running job.
+type Server struct {
+	// Makes the savepoints which are triggered afterwards fail.
+	FailSavepoints bool
+
+	// Makes the rescalings which are triggered afterwards fail, like Flink
+	// 1.9 and later, which have disabled rescaling.
+	FailRescalings bool
+
+	// The Flink version of the cluster, default: "1.9.1".
+	FlinkVersion string
+
+	// Makes the JARs which are run afterwards fail with the error, e.g., an
+	// exception in the main method of the program.
+	JarRunError string
+
+	// The number of TaskManagers and task slots in the cluster overview.
+	TaskManagers int
+	Slots        int
+
+	server      *httptest.Server
+	lock        sync.Mutex
+	jobs        map[string]*job
+	jobOrder    []string
+	savepoints  map[string]*savepoint
+	rescalings  map[string]*rescaling
+	checkpoints map[string]*flinkclient.JobCheckpoints
+	// The uploaded JARs by ID and the requests to run them.
+	jars       map[string][]byte
+	jarUploads int
+	jarRuns    []flinkclient.JarRunRequest
+}
+
+// NewServer starts a new fake Flink REST API server, the caller should close it
+// after use.
+func NewServer() *Server {
+	var s = &Server{
+		TaskManagers: 1,
+		Slots:        1,
+		FlinkVersion: "1.9.1",
+		jobs:         map[string]*job{},
+		savepoints:   map[string]*savepoint{},
+		rescalings:   map[string]*rescaling{},
+		checkpoints:  map[string]*flinkclient.JobCheckpoints{},
+		jars:         map[string][]byte{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns a Flink API client which sends all requests to this server,
+// regardless of the API base URL of the cluster.
+func (s *Server) Client() flinkclient.FlinkClient {
+	return &Client{
+		RESTClient: flinkclient.RESTClient{
+			Log:        log.Log,
+			HTTPClient: flinkclient.HTTPClient{Log: log.Log},
+		},
+		URL: s.URL(),
+	}
+}
+
+// SetJob adds a job to the cluster or updates the state of the job. A new job
+// starts now and has a single vertex with parallelism 1.
+func (s *Server) SetJob(jobID string, state string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.setJob(jobID, state)
+}
+
+func (s *Server) setJob(jobID string, state string) {
+	if _, ok := s.jobs[jobID]; !ok {
+		s.jobOrder = append(s.jobOrder, jobID)
+		s.jobs[jobID] = &job{
+			name:      jobID,
+			startTime: now(),
+			endTime:   -1,
+			vertices: []flinkclient.JobVertex{{
+				ID:          jobID + "-vertex-1",
+				Name:        "Source: Custom Source -> Sink: Print to Std. Out",
+				Parallelism: 1,
+			}},
+		}
+	}
+	s.setJobState(jobID, state)
+}
+
+// GetJob returns the state of the job, empty if the job is not found.
+func (s *Server) GetJob(jobID string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if job, ok := s.jobs[jobID]; ok {
+		return job.state
+	}
+	return ""
+}
+
+// SetJobName sets the name of the job, which is the job ID by default.
+func (s *Server) SetJobName(jobID string, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.jobs[jobID].name = name
+}
+
+// SetJobRestarts sets the number of times Flink restarted the job.
+func (s *Server) SetJobRestarts(jobID string, restarts int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.jobs[jobID].restarts = restarts
+}
+
+// SetJobException sets the root exception of the last failure of the job,
+// which occurs now.
+func (s *Server) SetJobException(jobID string, rootException string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.jobs[jobID].rootException = rootException
+	s.jobs[jobID].exceptionTime = now()
+}
+
+// SetJobVertices sets the vertices of the job graph of the job.
+func (s *Server) SetJobVertices(
+	jobID string, vertices []flinkclient.JobVertex) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.jobs[jobID].vertices = vertices
+}
+
+// SetLatestCheckpoint sets the latest completed checkpoint of the job, which
+// is counted as a new completed checkpoint.
+func (s *Server) SetLatestCheckpoint(
+	jobID string, checkpoint flinkclient.CheckpointInfo) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var checkpoints = s.getJobCheckpoints(jobID)
+	checkpoints.Latest.Completed = &checkpoint
+	checkpoints.Counts.Completed++
+	checkpoints.Counts.Total++
+}
+
+// AddFailedCheckpoint counts a new failed checkpoint of the job.
+func (s *Server) AddFailedCheckpoint(jobID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var checkpoints = s.getJobCheckpoints(jobID)
+	checkpoints.Counts.Failed++
+	checkpoints.Counts.Total++
+}
+
+func (s *Server) getJobCheckpoints(jobID string) *flinkclient.JobCheckpoints {
+	if _, ok := s.checkpoints[jobID]; !ok {
+		s.checkpoints[jobID] = &flinkclient.JobCheckpoints{}
+	}
+	return s.checkpoints[jobID]
+}
+
+// GetJobParallelism returns the parallelism of the vertices of the job, which
+// are rescaled together.
+func (s *Server) GetJobParallelism(jobID string) int32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.jobs[jobID].vertices[0].Parallelism
+}
+
+// GetSavepointLocations returns the locations of the succeeded savepoints of
+// the job.
+func (s *Server) GetSavepointLocations(jobID string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var locations = []string{}
+	for i := 1; i <= len(s.savepoints); i++ {
+		var sp = s.savepoints[fmt.Sprintf("trigger-%d", i)]
+		if sp.jobID == jobID && sp.completed && !sp.failed {
+			locations = append(locations, sp.location)
+		}
+	}
+	return locations
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var parts = strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == "GET" && len(parts) == 1 && parts[0] == "overview":
+		s.getOverview(w)
+	case r.Method == "GET" && len(parts) == 1 && parts[0] == "config":
+		s.getConfig(w)
+	case r.Method == "GET" && len(parts) == 1 && parts[0] == "jobs":
+		s.getJobs(w)
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "jobs" &&
+		parts[1] == "overview":
+		s.getJobsOverview(w)
+	case r.Method == "POST" && len(parts) == 2 && parts[0] == "jars" &&
+		parts[1] == "upload":
+		s.uploadJar(w, r)
+	case len(parts) >= 2 && parts[0] == "jars" && s.jars[parts[1]] == nil:
+		writeError(w, http.StatusNotFound, "Jar file could not be found.")
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "jars" &&
+		parts[2] == "run":
+		s.runJar(w, r, parts[1])
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "jars":
+		s.deleteJar(w, parts[1])
+	case len(parts) >= 2 && parts[0] == "jobs" && s.jobs[parts[1]] == nil:
+		writeError(w, http.StatusNotFound, "Job could not be found.")
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "jobs":
+		s.getJobDetails(w, parts[1])
+	case r.Method == "GET" && len(parts) == 3 && parts[2] == "metrics":
+		s.getJobMetrics(w, r, parts[1])
+	case r.Method == "GET" && len(parts) == 3 && parts[2] == "exceptions":
+		s.getJobExceptions(w, parts[1])
+	case r.Method == "PATCH" && len(parts) == 2 && parts[0] == "jobs":
+		s.cancelJob(w, r, parts[1])
+	case r.Method == "POST" && len(parts) == 3 && parts[2] == "savepoints":
+		s.triggerSavepoint(w, r, parts[1])
+	case r.Method == "POST" && len(parts) == 3 && parts[2] == "stop":
+		s.stopJob(w, r, parts[1])
+	case r.Method == "GET" && len(parts) == 4 && parts[2] == "savepoints":
+		s.getSavepoint(w, parts[1], parts[3])
+	case r.Method == "PATCH" && len(parts) == 3 && parts[2] == "rescaling":
+		s.triggerRescaling(w, r, parts[1])
+	case r.Method == "GET" && len(parts) == 4 && parts[2] == "rescaling":
+		s.getRescaling(w, parts[1], parts[3])
+	case r.Method == "GET" && len(parts) == 3 && parts[2] == "checkpoints":
+		s.getCheckpoints(w, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+func (s *Server) getOverview(w http.ResponseWriter) {
+	var counts = map[string]int{}
+	for _, job := range s.jobs {
+		counts[job.state]++
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"taskmanagers":    s.TaskManagers,
+		"slots-total":     s.Slots,
+		"slots-available": s.Slots - counts[JobStateRunning],
+		"jobs-running":    counts[JobStateRunning],
+		"jobs-finished":   counts[JobStateFinished],
+		"jobs-cancelled":  counts[JobStateCanceled],
+		"jobs-failed":     counts[JobStateFailed],
+		"flink-version":   s.FlinkVersion,
+	})
+}
+
+func (s *Server) getConfig(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"refresh-interval": 3000,
+		"timezone-name":    "Coordinated Universal Time",
+		"timezone-offset":  0,
+		"flink-version":    s.FlinkVersion,
+		"flink-revision":   "unknown",
+	})
+}
+
+func (s *Server) getJobs(w http.ResponseWriter) {
+	var jobs = []map[string]string{}
+	for _, id := range s.jobOrder {
+		jobs = append(
+			jobs, map[string]string{"id": id, "status": s.jobs[id].state})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
+
+func (s *Server) getJobsOverview(w http.ResponseWriter) {
+	var jobs = []flinkclient.JobOverview{}
+	for _, id := range s.jobOrder {
+		var job = s.jobs[id]
+		jobs = append(jobs, flinkclient.JobOverview{
+			ID:        id,
+			Name:      job.name,
+			State:     job.state,
+			StartTime: job.startTime,
+			EndTime:   job.endTime,
+		})
+	}
+	writeJSON(w, http.StatusOK, flinkclient.JobsOverview{Jobs: jobs})
+}
+
+func (s *Server) getJobDetails(w http.ResponseWriter, jobID string) {
+	var job = s.jobs[jobID]
+	var duration = job.endTime - job.startTime
+	if job.endTime < 0 {
+		duration = now() - job.startTime
+	}
+	var vertices = []flinkclient.JobVertex{}
+	for _, vertex := range job.vertices {
+		vertex.Status = job.state
+		vertices = append(vertices, vertex)
+	}
+	writeJSON(w, http.StatusOK, flinkclient.JobDetails{
+		ID:        jobID,
+		Name:      job.name,
+		State:     job.state,
+		StartTime: job.startTime,
+		EndTime:   job.endTime,
+		Duration:  duration,
+		Vertices:  vertices,
+	})
+}
+
+func (s *Server) getJobMetrics(
+	w http.ResponseWriter, r *http.Request, jobID string) {
+	var metrics = []flinkclient.JobMetric{}
+	for _, name := range strings.Split(r.URL.Query().Get("get"), ",") {
+		if name == "numRestarts" || name == "fullRestarts" {
+			metrics = append(metrics, flinkclient.JobMetric{
+				ID:    name,
+				Value: fmt.Sprint(s.jobs[jobID].restarts),
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, metrics)
+}
+
+func (s *Server) getJobExceptions(w http.ResponseWriter, jobID string) {
+	var job = s.jobs[jobID]
+	var exceptions = map[string]interface{}{
+		"all-exceptions": []interface{}{},
+		"truncated":      false,
+	}
+	if len(job.rootException) > 0 {
+		exceptions["root-exception"] = job.rootException
+		exceptions["timestamp"] = job.exceptionTime
+	}
+	writeJSON(w, http.StatusOK, exceptions)
+}
+
+func (s *Server) triggerSavepoint(
+	w http.ResponseWriter, r *http.Request, jobID string) {
+	var request struct {
+		TargetDirectory string `json:"target-directory"`
+		CancelJob       bool   `json:"cancel-job"`
+	}
+	var err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var jobState = ""
+	if request.CancelJob {
+		jobState = JobStateCanceled
+	}
+	s.addSavepoint(w, jobID, request.TargetDirectory, jobState)
+}
+
+func (s *Server) cancelJob(
+	w http.ResponseWriter, r *http.Request, jobID string) {
+	if r.URL.Query().Get("mode") != "cancel" {
+		writeError(w, http.StatusBadRequest, "Unsupported mode.")
+		return
+	}
+	if s.jobs[jobID].state != JobStateRunning {
+		writeError(w, http.StatusConflict, "Job is not running.")
+		return
+	}
+	s.setJobState(jobID, JobStateCanceled)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) stopJob(
+	w http.ResponseWriter, r *http.Request, jobID string) {
+	var request struct {
+		TargetDirectory string `json:"targetDirectory"`
+		Drain           bool   `json:"drain"`
+	}
+	var err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.addSavepoint(w, jobID, request.TargetDirectory, JobStateFinished)
+}
+
+func (s *Server) addSavepoint(
+	w http.ResponseWriter, jobID string, dir string, jobState string) {
+	var triggerID = fmt.Sprintf("trigger-%d", len(s.savepoints)+1)
+	s.savepoints[triggerID] = &savepoint{
+		jobID:    jobID,
+		dir:      dir,
+		jobState: jobState,
+		failed:   s.FailSavepoints,
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"request-id": triggerID})
+}
+
+func (s *Server) getSavepoint(
+	w http.ResponseWriter, jobID string, triggerID string) {
+	var sp, ok = s.savepoints[triggerID]
+	if !ok || sp.jobID != jobID {
+		writeError(w, http.StatusNotFound, "Operation not found.")
+		return
+	}
+
+	// The savepoint is in progress when its status is queried for the first
+	// time.
+	if !sp.completed {
+		sp.completed = true
+		if !sp.failed {
+			sp.location = fmt.Sprintf(
+				"%v/savepoint-%v", strings.TrimRight(sp.dir, "/"), triggerID)
+			if len(sp.jobState) > 0 {
+				s.setJobState(jobID, sp.jobState)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": map[string]string{"id": "IN_PROGRESS"},
+		})
+		return
+	}
+
+	var operation = map[string]interface{}{}
+	if sp.failed {
+		operation["failure-cause"] = map[string]string{
+			"class":       "java.util.concurrent.CompletionException",
+			"stack-trace": "java.util.concurrent.CompletionException: savepoint failed",
+		}
+	} else {
+		operation["location"] = sp.location
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    map[string]string{"id": "COMPLETED"},
+		"operation": operation,
+	})
+}
+
+func (s *Server) triggerRescaling(
+	w http.ResponseWriter, r *http.Request, jobID string) {
+	var parallelism int32
+	var _, err = fmt.Sscan(r.URL.Query().Get("parallelism"), &parallelism)
+	if err != nil || parallelism < 1 {
+		writeError(w, http.StatusBadRequest, "Invalid parallelism.")
+		return
+	}
+	var triggerID = fmt.Sprintf("rescaling-%d", len(s.rescalings)+1)
+	s.rescalings[triggerID] = &rescaling{
+		jobID:       jobID,
+		parallelism: parallelism,
+		failed:      s.FailRescalings,
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"request-id": triggerID})
+}
+
+func (s *Server) getRescaling(
+	w http.ResponseWriter, jobID string, triggerID string) {
+	var rs, ok = s.rescalings[triggerID]
+	if !ok || rs.jobID != jobID {
+		writeError(w, http.StatusNotFound, "Operation not found.")
+		return
+	}
+
+	// The rescaling is in progress when its status is queried for the first
+	// time.
+	if !rs.completed {
+		rs.completed = true
+		if !rs.failed {
+			var job = s.jobs[jobID]
+			for i := range job.vertices {
+				job.vertices[i].Parallelism = rs.parallelism
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": map[string]string{"id": "IN_PROGRESS"},
+		})
+		return
+	}
+
+	var operation = map[string]interface{}{}
+	if rs.failed {
+		operation["failure-cause"] = map[string]string{
+			"class": "org.apache.flink.runtime.rest.handler.RestHandlerException",
+			"stack-trace": "org.apache.flink.runtime.rest.handler.RestHandlerException: " +
+				"Rescaling is temporarily disabled. See FLINK-12312.",
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    map[string]string{"id": "COMPLETED"},
+		"operation": operation,
+	})
+}
+
+// GetJars returns the IDs of the uploaded JARs which have not been deleted.
+func (s *Server) GetJars() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var ids = []string{}
+	for id := range s.jars {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetJarRuns returns the requests to run JARs.
+func (s *Server) GetJarRuns() []flinkclient.JarRunRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]flinkclient.JarRunRequest{}, s.jarRuns...)
+}
+
+func (s *Server) uploadJar(w http.ResponseWriter, r *http.Request) {
+	var file, header, err = r.FormFile("jarfile")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.jarUploads++
+	var jarID = fmt.Sprintf("jar-%d_%s", s.jarUploads, header.Filename)
+	s.jars[jarID] = content
+	writeJSON(w, http.StatusOK, map[string]string{
+		"filename": "/tmp/flink-web-upload/" + jarID,
+		"status":   "success",
+	})
+}
+
+func (s *Server) runJar(
+	w http.ResponseWriter, r *http.Request, jarID string) {
+	var request flinkclient.JarRunRequest
+	var err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.jarRuns = append(s.jarRuns, request)
+	if len(s.JarRunError) > 0 {
+		writeError(w, http.StatusInternalServerError, s.JarRunError)
+		return
+	}
+	var jobID = fmt.Sprintf("jar-job-%d", len(s.jarRuns))
+	s.setJob(jobID, JobStateRunning)
+	writeJSON(w, http.StatusOK, map[string]string{"jobid": jobID})
+}
+
+func (s *Server) deleteJar(w http.ResponseWriter, jarID string) {
+	delete(s.jars, jarID)
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func (s *Server) getCheckpoints(w http.ResponseWriter, jobID string) {
+	writeJSON(w, http.StatusOK, s.getJobCheckpoints(jobID))
+}
+
+// Sets the state of the job and ends the job if the state is terminal.
+func (s *Server) setJobState(jobID string, state string) {
+	var job = s.jobs[jobID]
+	job.state = state
+	switch state {
+	case JobStateFinished, JobStateFailed, JobStateCanceled:
+		if job.endTime < 0 {
+			job.endTime = now()
+		}
+	default:
+		job.endTime = -1
+	}
+}
+
+func now() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string][]string{"errors": {message}})
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"gotest.tools/assert"
+)
+
+func TestJobStatusList(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+
+	server.SetJob("job-1", JobStateCanceled)
+	server.SetJob("job-2", JobStateRunning)
+
+	var jobList = flinkclient.JobStatusList{}
+	var err = client.GetJobStatusList(ctx, "http://unused", &jobList)
+	assert.NilError(t, err)
+	assert.DeepEqual(
+		t,
+		jobList.Jobs,
+		[]flinkclient.JobStatus{
+			{ID: "job-1", Status: JobStateCanceled},
+			{ID: "job-2", Status: JobStateRunning},
+		})
+}
+
+func TestJobsOverview(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateFinished)
+	server.SetJob("job-2", JobStateRunning)
+	server.SetJobName("job-2", "word count")
+
+	var overview, err = client.GetJobsOverview(ctx, "http://unused")
+	assert.NilError(t, err)
+	assert.Equal(t, len(overview.Jobs), 2)
+	assert.Equal(t, overview.Jobs[0].ID, "job-1")
+	assert.Equal(t, overview.Jobs[0].State, JobStateFinished)
+	assert.Assert(t, overview.Jobs[0].EndTime >= overview.Jobs[0].StartTime)
+	assert.Equal(t, overview.Jobs[1].ID, "job-2")
+	assert.Equal(t, overview.Jobs[1].Name, "word count")
+	assert.Equal(t, overview.Jobs[1].State, JobStateRunning)
+	assert.Equal(t, overview.Jobs[1].EndTime, int64(-1))
+}
+
+func TestJobDetails(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+	server.SetJobVertices("job-1", []flinkclient.JobVertex{
+		{ID: "vertex-1", Name: "Source", Parallelism: 2},
+		{ID: "vertex-2", Name: "Sink", Parallelism: 1},
+	})
+
+	var details, err = client.GetJobDetails(ctx, "http://unused", "job-1")
+	assert.NilError(t, err)
+	assert.Equal(t, details.ID, "job-1")
+	assert.Equal(t, details.State, JobStateRunning)
+	assert.Assert(t, details.StartTime > 0)
+	assert.Equal(t, details.EndTime, int64(-1))
+	assert.DeepEqual(
+		t,
+		details.Vertices,
+		[]flinkclient.JobVertex{
+			{ID: "vertex-1", Name: "Source", Parallelism: 2, Status: JobStateRunning},
+			{ID: "vertex-2", Name: "Sink", Parallelism: 1, Status: JobStateRunning},
+		})
+
+	server.SetJob("job-1", JobStateFailed)
+	details, err = client.GetJobDetails(ctx, "http://unused", "job-1")
+	assert.NilError(t, err)
+	assert.Equal(t, details.State, JobStateFailed)
+	assert.Assert(t, details.EndTime >= details.StartTime)
+	assert.Equal(t, details.Duration, details.EndTime-details.StartTime)
+
+	_, err = client.GetJobDetails(ctx, "http://unused", "job-2")
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestJobMetrics(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRestarting)
+	server.SetJobRestarts("job-1", 3)
+
+	var metrics, err = client.GetJobMetrics(
+		ctx, "http://unused", "job-1", []string{"numRestarts", "uptime"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, metrics, map[string]string{"numRestarts": "3"})
+}
+
+func TestJobExceptions(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+
+	var exceptions, err = client.GetJobExceptions(ctx, "http://unused", "job-1")
+	assert.NilError(t, err)
+	assert.Equal(t, exceptions.RootException, "")
+
+	server.SetJob("job-1", JobStateFailing)
+	server.SetJobException("job-1", "java.lang.RuntimeException: boom")
+	exceptions, err = client.GetJobExceptions(ctx, "http://unused", "job-1")
+	assert.NilError(t, err)
+	assert.Equal(
+		t, exceptions.RootException, "java.lang.RuntimeException: boom")
+	assert.Assert(t, exceptions.Timestamp > 0)
+}
+
+func TestSavepointWithCancel(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+
+	var triggerID, err = client.TriggerSavepoint(
+		ctx, "http://unused", "job-1", "gs://my-bucket/savepoints/", true)
+	assert.NilError(t, err)
+	assert.Equal(t, triggerID.RequestID, "trigger-1")
+
+	status, err := client.GetSavepointStatus(
+		ctx, "http://unused", "job-1", triggerID.RequestID)
+	assert.NilError(t, err)
+	assert.Assert(t, !status.Completed)
+
+	status, err = client.GetSavepointStatus(
+		ctx, "http://unused", "job-1", triggerID.RequestID)
+	assert.NilError(t, err)
+	assert.Assert(t, status.Completed)
+	assert.Equal(t, status.Location, "gs://my-bucket/savepoints/savepoint-trigger-1")
+	assert.Equal(t, server.GetJob("job-1"), JobStateCanceled)
+	assert.DeepEqual(
+		t,
+		server.GetSavepointLocations("job-1"),
+		[]string{"gs://my-bucket/savepoints/savepoint-trigger-1"})
+}
+
+func TestSavepointFailure(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+	server.FailSavepoints = true
+
+	var triggerID, err = client.TriggerSavepoint(
+		ctx, "http://unused", "job-1", "gs://my-bucket/savepoints", true)
+	assert.NilError(t, err)
+	client.GetSavepointStatus(ctx, "http://unused", "job-1", triggerID.RequestID)
+	status, err := client.GetSavepointStatus(
+		ctx, "http://unused", "job-1", triggerID.RequestID)
+	assert.NilError(t, err)
+	assert.Assert(t, status.Completed)
+	assert.Equal(t, status.Location, "")
+	assert.Equal(
+		t,
+		status.FailureCause.ExceptionClass,
+		"java.util.concurrent.CompletionException")
+	assert.Equal(t, server.GetJob("job-1"), JobStateRunning)
+}
+
+func TestRescaling(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+	server.FlinkVersion = "1.8.3"
+
+	var version, err = client.GetFlinkVersion(ctx, "http://unused")
+	assert.NilError(t, err)
+	assert.Equal(t, version, "1.8.3")
+
+	triggerID, err := client.TriggerRescaling(ctx, "http://unused", "job-1", 4)
+	assert.NilError(t, err)
+	status, err := client.GetRescalingStatus(
+		ctx, "http://unused", "job-1", triggerID.RequestID)
+	assert.NilError(t, err)
+	assert.Assert(t, !status.Completed)
+	status, err = client.GetRescalingStatus(
+		ctx, "http://unused", "job-1", triggerID.RequestID)
+	assert.NilError(t, err)
+	assert.Assert(t, status.Completed)
+	assert.Assert(t, !status.IsFailed())
+	assert.Equal(t, server.GetJobParallelism("job-1"), int32(4))
+	assert.Equal(t, server.GetJob("job-1"), JobStateRunning)
+}
+
+func TestRescalingFailure(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+	server.FailRescalings = true
+
+	var triggerID, err = client.TriggerRescaling(ctx, "http://unused", "job-1", 4)
+	assert.NilError(t, err)
+	client.GetRescalingStatus(ctx, "http://unused", "job-1", triggerID.RequestID)
+	status, err := client.GetRescalingStatus(
+		ctx, "http://unused", "job-1", triggerID.RequestID)
+	assert.NilError(t, err)
+	assert.Assert(t, status.IsFailed())
+	assert.Equal(
+		t,
+		status.FailureCause.ExceptionClass,
+		"org.apache.flink.runtime.rest.handler.RestHandlerException")
+	assert.Equal(t, server.GetJobParallelism("job-1"), int32(1))
+}
+
+func TestJobCheckpoints(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+
+	var checkpoints, err = client.GetJobCheckpoints(ctx, "http://unused", "job-1")
+	assert.NilError(t, err)
+	assert.Assert(t, checkpoints.Latest.Completed == nil)
+
+	server.AddFailedCheckpoint("job-1")
+	server.SetLatestCheckpoint("job-1", flinkclient.CheckpointInfo{
+		ID:                 3,
+		ExternalPath:       "gs://my-bucket/checkpoints/chk-3",
+		LatestAckTimestamp: 1572602400000,
+		StateSize:          1024,
+	})
+	checkpoints, err = client.GetJobCheckpoints(ctx, "http://unused", "job-1")
+	assert.NilError(t, err)
+	assert.DeepEqual(
+		t,
+		*checkpoints.Latest.Completed,
+		flinkclient.CheckpointInfo{
+			ID:                 3,
+			ExternalPath:       "gs://my-bucket/checkpoints/chk-3",
+			LatestAckTimestamp: 1572602400000,
+			StateSize:          1024,
+		})
+	assert.DeepEqual(
+		t,
+		checkpoints.Counts,
+		flinkclient.CheckpointCounts{Total: 2, Completed: 1, Failed: 1})
+}
+
+func TestCancelJob(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+
+	var err = client.CancelJob(ctx, "http://unused", "job-1")
+	assert.NilError(t, err)
+	assert.Equal(t, server.GetJob("job-1"), JobStateCanceled)
+
+	err = client.CancelJob(ctx, "http://unused", "job-1")
+	assert.ErrorContains(t, err, "409 Conflict")
+
+	err = client.CancelJob(ctx, "http://unused", "job-2")
+	assert.ErrorContains(t, err, "404 Not Found")
+}
+
+func TestStopJobWithSavepoint(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+	server.SetJob("job-1", JobStateRunning)
+
+	var triggerID, err = client.StopJobWithSavepoint(
+		ctx, "http://unused", "job-1", "gs://my-bucket/savepoints", false)
+	assert.NilError(t, err)
+	client.GetSavepointStatus(ctx, "http://unused", "job-1", triggerID.RequestID)
+	status, err := client.GetSavepointStatus(
+		ctx, "http://unused", "job-1", triggerID.RequestID)
+	assert.NilError(t, err)
+	assert.Assert(t, status.Completed)
+	assert.Equal(t, status.Location, "gs://my-bucket/savepoints/savepoint-trigger-1")
+	assert.Equal(t, server.GetJob("job-1"), JobStateFinished)
+}
+
+func TestRunJar(t *testing.T) {
+	var server = NewServer()
+	defer server.Close()
+	var client = server.Client()
+	var ctx = context.Background()
+
+	var jarID, err = client.UploadJar(
+		ctx, "http://unused", "WordCount.jar", []byte("jar content"))
+	assert.NilError(t, err)
+	assert.Equal(t, jarID, "jar-1_WordCount.jar")
+	assert.Equal(t, string(server.jars[jarID]), "jar content")
+
+	var parallelism int32 = 2
+	var request = flinkclient.JarRunRequest{
+		EntryClass:      "org.apache.flink.examples.java.wordcount.WordCount",
+		ProgramArgsList: []string{"--input", "./README.txt"},
+		Parallelism:     &parallelism,
+		SavepointPath:   "gs://my-bucket/savepoint-1",
+	}
+	jobID, err := client.RunJar(ctx, "http://unused", jarID, request)
+	assert.NilError(t, err)
+	assert.Equal(t, jobID, "jar-job-1")
+	assert.Equal(t, server.GetJob(jobID), JobStateRunning)
+	assert.DeepEqual(t, server.GetJarRuns(), []flinkclient.JarRunRequest{request})
+
+	server.JarRunError = "The main method caused an error."
+	_, err = client.RunJar(ctx, "http://unused", jarID, request)
+	assert.ErrorContains(t, err, "The main method caused an error.")
+
+	assert.NilError(t, client.DeleteJar(ctx, "http://unused", jarID))
+	assert.DeepEqual(t, server.GetJars(), []string{})
+	_, err = client.RunJar(ctx, "http://unused", jarID, request)
+	assert.ErrorContains(t, err, "404")
+}
@@ -17,9 +17,11 @@ limitations under the License.
 package flinkclient
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"time"
+	"path"
+	"strings"
 
 	"github.com/go-logr/logr"
 )
@@ -29,12 +31,101 @@ const (
 	savepointStateCompleted  = "COMPLETED"
 )
 
-// FlinkClient - Flink API client.
-type FlinkClient struct {
+// FlinkClient - Flink API client interface.
+type FlinkClient interface {
+	// GetJobStatusList gets Flink job status list.
+	GetJobStatusList(
+		ctx context.Context, apiBaseURL string, jobStatusList *JobStatusList) error
+
+	// GetJobsOverview gets the overview of all jobs in the cluster.
+	GetJobsOverview(ctx context.Context, apiBaseURL string) (JobsOverview, error)
+
+	// GetJobDetails gets the details of a job.
+	GetJobDetails(
+		ctx context.Context, apiBaseURL string, jobID string) (JobDetails, error)
+
+	// GetJobMetrics gets the values of the given metrics of a job.
+	GetJobMetrics(
+		ctx context.Context,
+		apiBaseURL string,
+		jobID string,
+		names []string) (map[string]string, error)
+
+	// GetJobExceptions gets the exceptions of a job.
+	GetJobExceptions(
+		ctx context.Context, apiBaseURL string, jobID string) (JobExceptions, error)
+
+	// TriggerSavepoint triggers an async savepoint operation.
+	TriggerSavepoint(
+		ctx context.Context,
+		apiBaseURL string,
+		jobID string,
+		dir string,
+		cancel bool) (SavepointTriggerID, error)
+
+	// GetSavepointStatus returns savepoint status.
+	GetSavepointStatus(
+		ctx context.Context,
+		apiBaseURL string,
+		jobID string,
+		triggerID string) (SavepointStatus, error)
+
+	// GetJobCheckpoints gets the checkpoint statistics of a job.
+	GetJobCheckpoints(
+		ctx context.Context, apiBaseURL string, jobID string) (JobCheckpoints, error)
+
+	// CancelJob cancels a job without taking a savepoint.
+	CancelJob(ctx context.Context, apiBaseURL string, jobID string) error
+
+	// StopJobWithSavepoint triggers an async stop-with-savepoint operation.
+	StopJobWithSavepoint(
+		ctx context.Context,
+		apiBaseURL string,
+		jobID string,
+		dir string,
+		drain bool) (SavepointTriggerID, error)
+
+	// UploadJar uploads a JAR file to the cluster and returns its ID.
+	UploadJar(
+		ctx context.Context,
+		apiBaseURL string,
+		fileName string,
+		jar []byte) (string, error)
+
+	// RunJar runs an uploaded JAR file and returns the ID of the job.
+	RunJar(
+		ctx context.Context,
+		apiBaseURL string,
+		jarID string,
+		request JarRunRequest) (string, error)
+
+	// DeleteJar deletes an uploaded JAR file.
+	DeleteJar(ctx context.Context, apiBaseURL string, jarID string) error
+
+	// GetFlinkVersion gets the Flink version of the cluster.
+	GetFlinkVersion(ctx context.Context, apiBaseURL string) (string, error)
+
+	// TriggerRescaling triggers an async rescaling operation.
+	TriggerRescaling(
+		ctx context.Context,
+		apiBaseURL string,
+		jobID string,
+		parallelism int32) (RescalingTriggerID, error)
+
+	// GetRescalingStatus returns rescaling status.
+	GetRescalingStatus(
+		ctx context.Context,
+		apiBaseURL string, jobID string, triggerID string) (RescalingStatus, error)
+}
+
+// RESTClient - Flink API client which talks to the Flink REST API server.
+type RESTClient struct {
 	Log        logr.Logger
 	HTTPClient HTTPClient
 }
 
+var _ FlinkClient = &RESTClient{}
+
 // JobStatus defines Flink job status.
 type JobStatus struct {
 	ID     string
@@ -46,6 +137,55 @@ type JobStatusList struct {
 	Jobs []JobStatus
 }
 
+// JobOverview defines the overview of a Flink job. Times are Unix timestamps
+// in milliseconds, the end time is -1 while the job has not ended.
+type JobOverview struct {
+	ID        string `json:"jid"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	StartTime int64  `json:"start-time"`
+	EndTime   int64  `json:"end-time"`
+}
+
+// JobsOverview defines the overview of all jobs in a Flink cluster.
+type JobsOverview struct {
+	Jobs []JobOverview `json:"jobs"`
+}
+
+// JobVertex defines a vertex of the job graph of a Flink job.
+type JobVertex struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Parallelism int32  `json:"parallelism"`
+	Status      string `json:"status"`
+}
+
+// JobDetails defines the details of a Flink job. Times are Unix timestamps in
+// milliseconds, the end time is -1 while the job has not ended.
+type JobDetails struct {
+	ID        string      `json:"jid"`
+	Name      string      `json:"name"`
+	State     string      `json:"state"`
+	StartTime int64       `json:"start-time"`
+	EndTime   int64       `json:"end-time"`
+	Duration  int64       `json:"duration"`
+	Vertices  []JobVertex `json:"vertices"`
+}
+
+// JobExceptions defines the exceptions of a Flink job. The timestamp is the
+// Unix timestamp in milliseconds when the root exception occurred.
+type JobExceptions struct {
+	RootException string `json:"root-exception"`
+	Timestamp     int64  `json:"timestamp"`
+	Truncated     bool   `json:"truncated"`
+}
+
+// JobMetric defines the value of a job metric.
+type JobMetric struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+}
+
 // SavepointTriggerID defines trigger ID of an async savepoint operation.
 type SavepointTriggerID struct {
 	RequestID string `json:"request-id"`
@@ -76,22 +216,197 @@ type SavepointStatus struct {
 	FailureCause SavepointFailureCause
 }
 
+// CheckpointInfo defines a checkpoint of a job. Timestamps are Unix timestamps
+// in milliseconds, the state size is in bytes and the duration is in
+// milliseconds.
+type CheckpointInfo struct {
+	ID                 int64  `json:"id"`
+	ExternalPath       string `json:"external_path"`
+	TriggerTimestamp   int64  `json:"trigger_timestamp"`
+	LatestAckTimestamp int64  `json:"latest_ack_timestamp"`
+	StateSize          int64  `json:"state_size"`
+	EndToEndDuration   int64  `json:"end_to_end_duration"`
+}
+
+// CheckpointCounts defines the numbers of checkpoints of a job.
+type CheckpointCounts struct {
+	Restored   int64 `json:"restored"`
+	Total      int64 `json:"total"`
+	InProgress int64 `json:"in_progress"`
+	Completed  int64 `json:"completed"`
+	Failed     int64 `json:"failed"`
+}
+
+// LatestCheckpoints defines the latest checkpoints of a job.
+type LatestCheckpoints struct {
+	Completed *CheckpointInfo `json:"completed"`
+}
+
+// JobCheckpoints defines the checkpoint statistics of a job.
+type JobCheckpoints struct {
+	Counts CheckpointCounts  `json:"counts"`
+	Latest LatestCheckpoints `json:"latest"`
+}
+
+// ClusterConfig defines the configuration of a Flink cluster.
+type ClusterConfig struct {
+	FlinkVersion  string `json:"flink-version"`
+	FlinkRevision string `json:"flink-revision"`
+}
+
+// RescalingTriggerID defines trigger ID of an async rescaling operation.
+type RescalingTriggerID struct {
+	RequestID string `json:"request-id"`
+}
+
+// RescalingStatus defines rescaling status of a job.
+type RescalingStatus struct {
+	// Flink job ID.
+	JobID string
+	// Rescaling operation trigger ID.
+	TriggerID string
+	// Completed or not.
+	Completed bool
+	// Cause of the failure, non-empty when rescaling failed.
+	FailureCause SavepointFailureCause
+}
+
+// IsFailed checks whether the rescaling has completed with a failure.
+func (s RescalingStatus) IsFailed() bool {
+	return s.Completed && (len(s.FailureCause.ExceptionClass) > 0 ||
+		len(s.FailureCause.StackTrace) > 0)
+}
+
+// JarUploadResponse defines the response of a JAR upload, the file name is
+// the path of the uploaded JAR on the JobManager.
+type JarUploadResponse struct {
+	FileName string `json:"filename"`
+	Status   string `json:"status"`
+}
+
+// JarRunRequest defines the request to run an uploaded JAR.
+type JarRunRequest struct {
+	EntryClass            string   `json:"entryClass,omitempty"`
+	ProgramArgsList       []string `json:"programArgsList,omitempty"`
+	Parallelism           *int32   `json:"parallelism,omitempty"`
+	SavepointPath         string   `json:"savepointPath,omitempty"`
+	AllowNonRestoredState bool     `json:"allowNonRestoredState,omitempty"`
+}
+
+// JarRunResponse defines the response of running an uploaded JAR.
+type JarRunResponse struct {
+	JobID string `json:"jobid"`
+}
+
 // GetJobStatusList gets Flink job status list.
-func (c *FlinkClient) GetJobStatusList(
+func (c *RESTClient) GetJobStatusList(
+	ctx context.Context,
 	apiBaseURL string, jobStatusList *JobStatusList) error {
-	return c.HTTPClient.Get(apiBaseURL+"/jobs", jobStatusList)
+	return c.HTTPClient.Get(ctx, apiBaseURL+"/jobs", jobStatusList)
+}
+
+// GetJobsOverview gets the overview of all jobs in the cluster, including
+// finished jobs which have not expired from the job store.
+func (c *RESTClient) GetJobsOverview(
+	ctx context.Context, apiBaseURL string) (JobsOverview, error) {
+	var overview = JobsOverview{}
+	var err = c.HTTPClient.Get(ctx, apiBaseURL+"/jobs/overview", &overview)
+	return overview, err
+}
+
+// GetJobDetails gets the details of a job, including its state, times and
+// the parallelism of its vertices.
+func (c *RESTClient) GetJobDetails(
+	ctx context.Context,
+	apiBaseURL string, jobID string) (JobDetails, error) {
+	var url = fmt.Sprintf("%s/jobs/%s", apiBaseURL, jobID)
+	var details = JobDetails{}
+	var err = c.HTTPClient.Get(ctx, url, &details)
+	return details, err
 }
 
-// TriggerSavepoint triggers an async savepoint operation.
-func (c *FlinkClient) TriggerSavepoint(
-	apiBaseURL string, jobID string, dir string) (SavepointTriggerID, error) {
+// GetJobMetrics gets the values of the given metrics of a job, keyed by the
+// metric names. Metrics which are not available are not in the result.
+//
+// Flink API response example:
+//
+// [{"id":"numRestarts","value":"2"}]
+func (c *RESTClient) GetJobMetrics(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	names []string) (map[string]string, error) {
+	var url = fmt.Sprintf(
+		"%s/jobs/%s/metrics?get=%s", apiBaseURL, jobID, strings.Join(names, ","))
+	var metricList = []JobMetric{}
+	var err = c.HTTPClient.Get(ctx, url, &metricList)
+	if err != nil {
+		return nil, err
+	}
+	var metrics = make(map[string]string)
+	for _, metric := range metricList {
+		metrics[metric.ID] = metric.Value
+	}
+	return metrics, nil
+}
+
+// GetJobExceptions gets the exceptions of a job, the root exception is the
+// stack trace of the cause of the last failure, empty if the job has not
+// failed.
+func (c *RESTClient) GetJobExceptions(
+	ctx context.Context,
+	apiBaseURL string, jobID string) (JobExceptions, error) {
+	var url = fmt.Sprintf("%s/jobs/%s/exceptions", apiBaseURL, jobID)
+	var exceptions = JobExceptions{}
+	var err = c.HTTPClient.Get(ctx, url, &exceptions)
+	return exceptions, err
+}
+
+// TriggerSavepoint triggers an async savepoint operation, the job will be
+// cancelled after the savepoint succeeds if cancel is true.
+func (c *RESTClient) TriggerSavepoint(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	dir string,
+	cancel bool) (SavepointTriggerID, error) {
 	var url = fmt.Sprintf("%s/jobs/%s/savepoints", apiBaseURL, jobID)
 	var jsonStr = fmt.Sprintf(`{
 		"target-directory" : "%s",
-		"cancel-job" : false
-	}`, dir)
+		"cancel-job" : %t
+	}`, dir, cancel)
 	var triggerID = SavepointTriggerID{}
-	var err = c.HTTPClient.Post(url, []byte(jsonStr), &triggerID)
+	var err = c.HTTPClient.Post(ctx, url, []byte(jsonStr), &triggerID)
+	return triggerID, err
+}
+
+// CancelJob cancels a job without taking a savepoint, the job is cancelled
+// asynchronously after the request is accepted.
+func (c *RESTClient) CancelJob(
+	ctx context.Context, apiBaseURL string, jobID string) error {
+	var url = fmt.Sprintf("%s/jobs/%s?mode=cancel", apiBaseURL, jobID)
+	return c.HTTPClient.Patch(ctx, url, nil, nil)
+}
+
+// StopJobWithSavepoint triggers an async stop-with-savepoint operation. The
+// sources are suspended before the savepoint so that no data is processed
+// after it, and the job finishes when the savepoint succeeds. If drain is true,
+// MAX_WATERMARK is emitted before the savepoint to fire all event time timers,
+// which is only suitable when the job is terminated permanently. The operation
+// is polled with GetSavepointStatus and the returned trigger ID.
+func (c *RESTClient) StopJobWithSavepoint(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	dir string,
+	drain bool) (SavepointTriggerID, error) {
+	var url = fmt.Sprintf("%s/jobs/%s/stop", apiBaseURL, jobID)
+	var jsonStr = fmt.Sprintf(`{
+		"targetDirectory" : "%s",
+		"drain" : %t
+	}`, dir, drain)
+	var triggerID = SavepointTriggerID{}
+	var err = c.HTTPClient.Post(ctx, url, []byte(jsonStr), &triggerID)
 	return triggerID, err
 }
 
@@ -119,7 +434,8 @@ func (c *FlinkClient) TriggerSavepoint(
 //      }
 //    }
 // }
-func (c *FlinkClient) GetSavepointStatus(
+func (c *RESTClient) GetSavepointStatus(
+	ctx context.Context,
 	apiBaseURL string, jobID string, triggerID string) (SavepointStatus, error) {
 	var url = fmt.Sprintf(
 		"%s/jobs/%s/savepoints/%s", apiBaseURL, jobID, triggerID)
@@ -127,7 +443,7 @@ func (c *FlinkClient) GetSavepointStatus(
 	var rootJSON map[string]*json.RawMessage
 	var stateID SavepointStateID
 	var opJSON map[string]*json.RawMessage
-	var err = c.HTTPClient.Get(url, &rootJSON)
+	var err = c.HTTPClient.Get(ctx, url, &rootJSON)
 	if err != nil {
 		return status, err
 	}
@@ -166,25 +482,133 @@ func (c *FlinkClient) GetSavepointStatus(
 	return status, err
 }
 
-// TakeSavepoint takes savepoint, blocks until it suceeds or fails.
-func (c *FlinkClient) TakeSavepoint(
-	apiBaseURL string, jobID string, dir string) (SavepointStatus, error) {
-	var triggerID = SavepointTriggerID{}
-	var status = SavepointStatus{JobID: jobID}
-	var err error
+// GetJobCheckpoints gets the checkpoint statistics of a job.
+func (c *RESTClient) GetJobCheckpoints(
+	ctx context.Context,
+	apiBaseURL string, jobID string) (JobCheckpoints, error) {
+	var url = fmt.Sprintf("%s/jobs/%s/checkpoints", apiBaseURL, jobID)
+	var checkpoints = JobCheckpoints{}
+	var err = c.HTTPClient.Get(ctx, url, &checkpoints)
+	return checkpoints, err
+}
 
-	triggerID, err = c.TriggerSavepoint(apiBaseURL, jobID, dir)
+// UploadJar uploads a JAR file to the cluster, the ID of the uploaded JAR is
+// the base name of the file on the JobManager, e.g.,
+// "d1f5e4b2-7c1e-4b8a-9d49-3a6d8f6b1c2e_WordCount.jar".
+func (c *RESTClient) UploadJar(
+	ctx context.Context,
+	apiBaseURL string, fileName string, jar []byte) (string, error) {
+	var url = apiBaseURL + "/jars/upload"
+	var response = JarUploadResponse{}
+	var err = c.HTTPClient.PostFile(
+		ctx, url, "jarfile", fileName, "application/x-java-archive", jar, &response)
 	if err != nil {
-		return SavepointStatus{}, err
+		return "", err
+	}
+	if len(response.FileName) == 0 {
+		return "", fmt.Errorf("no file name in JAR upload response")
 	}
+	return path.Base(response.FileName), nil
+}
 
-	for i := 0; i < 12; i++ {
-		status, err = c.GetSavepointStatus(apiBaseURL, jobID, triggerID.RequestID)
-		if err == nil && status.Completed {
-			return status, nil
-		}
-		time.Sleep(5 * time.Second)
+// RunJar runs an uploaded JAR file. The job is submitted when the main method
+// of the program executes it, errors of the program, e.g., an exception in the
+// main method, are returned in the error.
+func (c *RESTClient) RunJar(
+	ctx context.Context,
+	apiBaseURL string, jarID string, request JarRunRequest) (string, error) {
+	var url = fmt.Sprintf("%s/jars/%s/run", apiBaseURL, jarID)
+	var body, err = json.Marshal(request)
+	if err != nil {
+		return "", err
 	}
+	var response = JarRunResponse{}
+	err = c.HTTPClient.Post(ctx, url, body, &response)
+	if err != nil {
+		return "", err
+	}
+	if len(response.JobID) == 0 {
+		return "", fmt.Errorf("no job ID in JAR run response")
+	}
+	return response.JobID, nil
+}
 
-	return status, err
+// DeleteJar deletes an uploaded JAR file, the jobs submitted from it are not
+// affected.
+func (c *RESTClient) DeleteJar(
+	ctx context.Context, apiBaseURL string, jarID string) error {
+	var url = fmt.Sprintf("%s/jars/%s", apiBaseURL, jarID)
+	return c.HTTPClient.Delete(ctx, url, nil)
+}
+
+// GetFlinkVersion gets the Flink version of the cluster, e.g., "1.8.3".
+func (c *RESTClient) GetFlinkVersion(
+	ctx context.Context, apiBaseURL string) (string, error) {
+	var config = ClusterConfig{}
+	var err = c.HTTPClient.Get(ctx, apiBaseURL+"/config", &config)
+	return config.FlinkVersion, err
+}
+
+// TriggerRescaling triggers an async rescaling operation, which rescales all
+// vertices of the job to the parallelism through a savepoint taken by Flink.
+// The operation is polled with GetRescalingStatus and the returned trigger
+// ID. Flink has disabled rescaling since 1.9, the operation fails there.
+func (c *RESTClient) TriggerRescaling(
+	ctx context.Context,
+	apiBaseURL string,
+	jobID string,
+	parallelism int32) (RescalingTriggerID, error) {
+	var url = fmt.Sprintf(
+		"%s/jobs/%s/rescaling?parallelism=%d", apiBaseURL, jobID, parallelism)
+	var triggerID = RescalingTriggerID{}
+	var err = c.HTTPClient.Patch(ctx, url, nil, &triggerID)
+	if err == nil && len(triggerID.RequestID) == 0 {
+		err = fmt.Errorf("no request ID in rescaling response")
+	}
+	return triggerID, err
+}
+
+// GetRescalingStatus returns rescaling status.
+//
+// Flink API response examples:
+//
+// 1) success:
+//
+// {
+//    "status":{"id":"COMPLETED"},
+//    "operation":{}
+// }
+//
+// 2) failure:
+//
+// {
+//    "status":{"id":"COMPLETED"},
+//    "operation":{
+//      "failure-cause":{
+//        "class": "org.apache.flink.runtime.rest.handler.RestHandlerException",
+//        "stack-trace": "..."
+//      }
+//    }
+// }
+func (c *RESTClient) GetRescalingStatus(
+	ctx context.Context,
+	apiBaseURL string, jobID string, triggerID string) (RescalingStatus, error) {
+	var url = fmt.Sprintf(
+		"%s/jobs/%s/rescaling/%s", apiBaseURL, jobID, triggerID)
+	var status = RescalingStatus{JobID: jobID, TriggerID: triggerID}
+	var response struct {
+		Status    SavepointStateID `json:"status"`
+		Operation *struct {
+			FailureCause *SavepointFailureCause `json:"failure-cause"`
+		} `json:"operation"`
+	}
+	var err = c.HTTPClient.Get(ctx, url, &response)
+	if err != nil {
+		return status, err
+	}
+	status.Completed = response.Status.ID == savepointStateCompleted
+	if response.Operation != nil && response.Operation.FailureCause != nil {
+		status.FailureCause = *response.Operation.FailureCause
+	}
+	return status, nil
 }
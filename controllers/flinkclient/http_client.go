@@ -18,55 +18,357 @@ package flinkclient
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 )
 
-// HTTPClient - HTTP client.
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultMaxRetries   = 2
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+// The maximum number of cached TLS transports, the cache is reset when it is
+// full, e.g., after many certificate rotations.
+const maxTLSTransports = 100
+
+// The transport shared by all clients which don't specify one, it pools the
+// connections to the JobManagers across requests and reconciles.
+var sharedTransport = newTransport()
+
+// The TLS transports by the hash of their certificates.
+var tlsTransports = struct {
+	sync.Mutex
+	transports map[[sha256.Size]byte]*http.Transport
+}{transports: map[[sha256.Size]byte]*http.Transport{}}
+
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// GetTLSTransport returns a transport which verifies the server with the PEM
+// encoded CA certificate, and authenticates with the PEM encoded client
+// certificate and key if they are given. The transports are cached by their
+// certificates, so that the connections are pooled across requests.
+func GetTLSTransport(
+	caCert []byte, clientCert []byte, clientKey []byte) (*http.Transport, error) {
+	var hash = sha256.New()
+	for _, data := range [][]byte{caCert, clientCert, clientKey} {
+		fmt.Fprintf(hash, "%d:", len(data))
+		hash.Write(data)
+	}
+	var key [sha256.Size]byte
+	copy(key[:], hash.Sum(nil))
+
+	tlsTransports.Lock()
+	defer tlsTransports.Unlock()
+	if transport, ok := tlsTransports.transports[key]; ok {
+		return transport, nil
+	}
+
+	var rootCAs = x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no valid PEM encoded CA certificate")
+	}
+	var config = &tls.Config{RootCAs: rootCAs}
+	if len(clientCert) > 0 || len(clientKey) > 0 {
+		var cert, err = tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	var transport = newTransport()
+	transport.TLSClientConfig = config
+
+	if len(tlsTransports.transports) >= maxTLSTransports {
+		for _, old := range tlsTransports.transports {
+			old.CloseIdleConnections()
+		}
+		tlsTransports.transports = map[[sha256.Size]byte]*http.Transport{}
+	}
+	tlsTransports.transports[key] = transport
+	return transport, nil
+}
+
+// HTTPClient - HTTP client. The zero value is ready to use with the default
+// timeout and retries, and the shared transport.
 type HTTPClient struct {
 	Log logr.Logger
+
+	// Transport of the requests, default: a transport shared by all clients
+	// which pools the connections.
+	Transport http.RoundTripper
+
+	// Headers sent with every request, e.g., "Authorization".
+	Headers map[string]string
+
+	// Timeout of each attempt of a request, including reading the response
+	// body, default: 10s.
+	Timeout time.Duration
+
+	// The maximum number of retries of a GET request which failed with a
+	// network error or a 5xx or 429 response, default: 2, negative for no
+	// retries. Other requests are not idempotent and never retried.
+	MaxRetries int
+
+	// Backoff before the first retry, doubled for each subsequent retry,
+	// default: 500ms.
+	RetryBackoff time.Duration
+}
+
+// APIError - the error of a request which got a non-2xx response.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	// The error messages in the "errors" array of the Flink error response.
+	Errors []string
+	// The response body if it is not a Flink error response.
+	Body string
+}
+
+func (e *APIError) Error() string {
+	var message = e.Body
+	if len(e.Errors) > 0 {
+		message = strings.Join(e.Errors, "; ")
+	}
+	return fmt.Sprintf("%v %v: %v: %v", e.Method, e.URL, e.Status, message)
+}
+
+// IsNotFound checks whether the error is a 404 response.
+func IsNotFound(err error) bool {
+	var apiErr, ok = err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
 }
 
-// Get - HTTP GET.
-func (c *HTTPClient) Get(url string, outStructPtr interface{}) error {
-	return c.doHTTP("GET", url, nil, outStructPtr)
+// Get - HTTP GET which is cancelled with the context, including the backoff
+// between retries.
+func (c *HTTPClient) Get(
+	ctx context.Context, url string, outStructPtr interface{}) error {
+	return c.doHTTP(ctx, "GET", url, nil, outStructPtr)
 }
 
 // Post - HTTP POST.
 func (c *HTTPClient) Post(
-	url string, body []byte, outStructPtr interface{}) error {
-	return c.doHTTP("POST", url, body, outStructPtr)
+	ctx context.Context,
+	url string,
+	body []byte,
+	outStructPtr interface{}) error {
+	return c.doHTTP(ctx, "POST", url, body, outStructPtr)
+}
+
+// Patch - HTTP PATCH.
+func (c *HTTPClient) Patch(
+	ctx context.Context,
+	url string,
+	body []byte,
+	outStructPtr interface{}) error {
+	return c.doHTTP(ctx, "PATCH", url, body, outStructPtr)
+}
+
+// Delete - HTTP DELETE.
+func (c *HTTPClient) Delete(
+	ctx context.Context, url string, outStructPtr interface{}) error {
+	return c.doHTTP(ctx, "DELETE", url, nil, outStructPtr)
+}
+
+// PostFile - HTTP POST of a file as a multipart form field.
+func (c *HTTPClient) PostFile(
+	ctx context.Context,
+	url string,
+	fieldName string,
+	fileName string,
+	contentType string,
+	content []byte,
+	outStructPtr interface{}) error {
+	var body = &bytes.Buffer{}
+	var writer = multipart.NewWriter(body)
+	var header = textproto.MIMEHeader{}
+	header.Set(
+		"Content-Disposition",
+		fmt.Sprintf(`form-data; name="%s"; filename="%s"`, fieldName, fileName))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(content)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.doRequest(
+		ctx,
+		"POST",
+		url,
+		body.Bytes(),
+		writer.FormDataContentType(),
+		outStructPtr)
 }
 
 func (c *HTTPClient) doHTTP(
-	method string, url string, body []byte, outStructPtr interface{}) error {
-	httpClient := &http.Client{Timeout: 30 * time.Second}
-	req, err := c.createRequest(method, url, body)
-	resp, err := httpClient.Do(req)
+	ctx context.Context,
+	method string,
+	url string,
+	body []byte,
+	outStructPtr interface{}) error {
+	var contentType string
+	if body != nil {
+		contentType = "application/json"
+	}
+	if method != "GET" {
+		return c.doRequest(ctx, method, url, body, contentType, outStructPtr)
+	}
+
+	var maxRetries = c.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	var backoff = c.RetryBackoff
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = c.doRequest(ctx, method, url, body, contentType, outStructPtr)
+		if err == nil || attempt >= maxRetries || !isRetryable(err) {
+			return err
+		}
+		if c.Log != nil {
+			c.Log.Info(
+				"Retrying request", "url", url, "backoff", backoff, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Sends a single request and reads the response within the timeout.
+func (c *HTTPClient) doRequest(
+	ctx context.Context,
+	method string,
+	url string,
+	body []byte,
+	contentType string,
+	outStructPtr interface{}) error {
+	var timeout = c.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := c.createRequest(ctx, method, url, body)
 	if err != nil {
 		return err
 	}
-	return c.readResponse(resp, outStructPtr)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	var transport = c.Transport
+	if transport == nil {
+		transport = sharedTransport
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	return c.readResponse(req, resp, outStructPtr)
 }
 
 func (c *HTTPClient) createRequest(
-	method, url string, body []byte) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	ctx context.Context,
+	method string,
+	url string,
+	body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", "flink-operator")
-	return req, err
+	return req, nil
 }
 
 func (c *HTTPClient) readResponse(
-	resp *http.Response, out interface{}) error {
+	req *http.Request, resp *http.Response, out interface{}) error {
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
-	if err == nil {
-		err = json.Unmarshal(body, out)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr = &APIError{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+		var errorResponse struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(body, &errorResponse) == nil &&
+			len(errorResponse.Errors) > 0 {
+			apiErr.Errors = errorResponse.Errors
+		} else {
+			apiErr.Body = string(body)
+		}
+		return apiErr
+	}
+	// Some operations, e.g., cancelling a job, have no response body.
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+// Checks whether the failed request can be retried, i.e., it failed with a
+// network error, including a timeout, or with a transient server error.
+func isRetryable(err error) bool {
+	var apiErr, ok = err.(*APIError)
+	if !ok {
+		_, ok = err.(net.Error)
+		return ok
 	}
-	return err
+	return apiErr.StatusCode >= 500 ||
+		apiErr.StatusCode == http.StatusTooManyRequests
 }
@@ -0,0 +1,146 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flinkclient
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+// Starts a server which responds with the given status codes in order, and
+// then with 200 and an empty job list. Returns the server and a pointer to
+// the number of received requests.
+func newTestServer(codes ...int) (*httptest.Server, *int32) {
+	var requests int32
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var request = int(atomic.AddInt32(&requests, 1))
+			if request <= len(codes) {
+				w.WriteHeader(codes[request-1])
+				w.Write([]byte(`{"errors": ["Service temporarily unavailable."]}`))
+				return
+			}
+			w.Write([]byte(`{"jobs": []}`))
+		}))
+	return server, &requests
+}
+
+func TestAPIError(t *testing.T) {
+	var server, _ = newTestServer(http.StatusNotFound)
+	defer server.Close()
+	var client = &HTTPClient{}
+
+	var err = client.Get(context.Background(), server.URL+"/jobs/1", nil)
+	var apiErr, ok = err.(*APIError)
+	assert.Assert(t, ok)
+	assert.Equal(t, apiErr.StatusCode, http.StatusNotFound)
+	assert.DeepEqual(t, apiErr.Errors, []string{"Service temporarily unavailable."})
+	assert.Assert(t, IsNotFound(err))
+	assert.Equal(
+		t,
+		err.Error(),
+		"GET "+server.URL+"/jobs/1: 404 Not Found: Service temporarily unavailable.")
+}
+
+func TestRetryGet(t *testing.T) {
+	var server, requests = newTestServer(
+		http.StatusServiceUnavailable, http.StatusInternalServerError)
+	defer server.Close()
+	var client = &HTTPClient{RetryBackoff: time.Millisecond}
+
+	var jobStatusList JobStatusList
+	var err = client.Get(context.Background(), server.URL+"/jobs", &jobStatusList)
+	assert.NilError(t, err)
+	assert.Equal(t, atomic.LoadInt32(requests), int32(3))
+}
+
+func TestRetryGetExhausted(t *testing.T) {
+	var server, requests = newTestServer(
+		http.StatusServiceUnavailable,
+		http.StatusServiceUnavailable,
+		http.StatusServiceUnavailable)
+	defer server.Close()
+	var client = &HTTPClient{MaxRetries: 1, RetryBackoff: time.Millisecond}
+
+	var err = client.Get(context.Background(), server.URL+"/jobs", nil)
+	assert.ErrorContains(t, err, "503 Service Unavailable")
+	assert.Equal(t, atomic.LoadInt32(requests), int32(2))
+}
+
+func TestNoRetryPost(t *testing.T) {
+	var server, requests = newTestServer(http.StatusServiceUnavailable)
+	defer server.Close()
+	var client = &HTTPClient{RetryBackoff: time.Millisecond}
+
+	var err = client.Post(
+		context.Background(), server.URL+"/jobs/1/savepoints", []byte("{}"), nil)
+	assert.ErrorContains(t, err, "503 Service Unavailable")
+	assert.Equal(t, atomic.LoadInt32(requests), int32(1))
+}
+
+func TestGetTimeout(t *testing.T) {
+	var unblock = make(chan struct{})
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			<-unblock
+		}))
+	defer server.Close()
+	defer close(unblock)
+	var client = &HTTPClient{Timeout: 10 * time.Millisecond, MaxRetries: -1}
+
+	var err = client.Get(context.Background(), server.URL+"/jobs", nil)
+	assert.ErrorContains(t, err, "deadline exceeded")
+}
+
+func TestGetCancelled(t *testing.T) {
+	var server, requests = newTestServer(
+		http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer server.Close()
+	var client = &HTTPClient{RetryBackoff: time.Hour}
+	var ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	var err = client.Get(ctx, server.URL+"/jobs", nil)
+	assert.ErrorContains(t, err, "503 Service Unavailable")
+	assert.Equal(t, atomic.LoadInt32(requests), int32(1))
+}
+
+func TestGetTLSTransport(t *testing.T) {
+	var server = httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	var caCert = pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	var transport, err = GetTLSTransport(caCert, nil, nil)
+	assert.NilError(t, err)
+	cachedTransport, err := GetTLSTransport(caCert, nil, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, transport == cachedTransport)
+
+	_, err = GetTLSTransport([]byte("invalid"), nil, nil)
+	assert.ErrorContains(t, err, "no valid PEM encoded CA certificate")
+	_, err = GetTLSTransport(caCert, []byte("invalid"), []byte("invalid"))
+	assert.ErrorContains(t, err, "invalid client certificate")
+}
@@ -23,9 +23,13 @@ import (
 	"github.com/go-logr/logr"
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
 	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"github.com/googlecloudplatform/flink-operator/controllers/jarstorage"
+	"github.com/googlecloudplatform/flink-operator/controllers/savepointstorage"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -36,19 +40,37 @@ type FlinkClusterReconciler struct {
 	Client client.Client
 	Log    logr.Logger
 	Mgr    ctrl.Manager
+	// Storages where expired savepoints are deleted from, the default
+	// storages are used if it is nil.
+	SavepointStorage *savepointstorage.Registry
+	// Storages where the JAR files of jobs submitted through the Flink REST
+	// API are read from, the default storages are used if it is nil.
+	JarStorage *jarstorage.Registry
+	// Flink API client, a client of the Flink REST API is created for each
+	// request if it is nil.
+	FlinkClient flinkclient.FlinkClient
+	// How the Flink API of the clusters is reached.
+	FlinkAPIAccess FlinkAPIAccess
 }
 
 // +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinkclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinkclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=pods/status,verbs=get
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=services/proxy,verbs=get;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events/status,verbs=get
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get
 // +kubebuilder:rbac:groups=extensions,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
@@ -59,45 +81,66 @@ func (reconciler *FlinkClusterReconciler) Reconcile(
 	request ctrl.Request) (ctrl.Result, error) {
 	var log = reconciler.Log.WithValues(
 		"cluster", request.NamespacedName)
+	var flinkClient = reconciler.FlinkClient
+	if flinkClient == nil {
+		flinkClient = reconciler.FlinkAPIAccess.newFlinkClient(log)
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
 	var handler = FlinkClusterHandler{
-		k8sClient: reconciler.Client,
-		flinkClient: flinkclient.FlinkClient{
-			Log:        log,
-			HTTPClient: flinkclient.HTTPClient{Log: log},
-		},
-		request:  request,
-		context:  context.Background(),
-		log:      log,
-		recorder: reconciler.Mgr.GetEventRecorderFor("FlinkOperator"),
-		observed: ObservedClusterState{},
+		k8sClient:        reconciler.Client,
+		flinkClient:      flinkClient,
+		savepointStorage: reconciler.SavepointStorage,
+		jarStorage:       reconciler.JarStorage,
+		flinkAPIAccess:   reconciler.FlinkAPIAccess,
+		request:          request,
+		context:          ctx,
+		log:              log,
+		recorder:         reconciler.Mgr.GetEventRecorderFor("FlinkOperator"),
+		observed:         ObservedClusterState{},
 	}
 	return handler.reconcile(request)
 }
 
 // SetupWithManager registers this reconciler with the controller manager and
-// starts watching FlinkCluster, Deployment and Service resources.
+// starts watching FlinkCluster and its child resources.
 func (reconciler *FlinkClusterReconciler) SetupWithManager(
 	mgr ctrl.Manager) error {
 	reconciler.Mgr = mgr
+	if reconciler.SavepointStorage == nil {
+		reconciler.SavepointStorage = savepointstorage.NewRegistry()
+	}
+	if reconciler.JarStorage == nil {
+		reconciler.JarStorage = jarstorage.NewRegistry(jarstorage.DefaultMaxJarSize)
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.FlinkCluster{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&extensionsv1beta1.Ingress{}).
 		Owns(&batchv1.Job{}).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&rbacv1.Role{}).
+		Owns(&rbacv1.RoleBinding{}).
 		Complete(reconciler)
 }
 
 // FlinkClusterHandler holds the context and state for a
 // reconcile request.
 type FlinkClusterHandler struct {
-	k8sClient   client.Client
-	flinkClient flinkclient.FlinkClient
-	request     ctrl.Request
-	context     context.Context
-	log         logr.Logger
-	recorder    record.EventRecorder
-	observed    ObservedClusterState
-	desired     DesiredClusterState
+	k8sClient        client.Client
+	flinkClient      flinkclient.FlinkClient
+	savepointStorage *savepointstorage.Registry
+	jarStorage       *jarstorage.Registry
+	flinkAPIAccess   FlinkAPIAccess
+	request          ctrl.Request
+	context          context.Context
+	log              logr.Logger
+	recorder         record.EventRecorder
+	observed         ObservedClusterState
+	desired          DesiredClusterState
 }
 
 func (handler *FlinkClusterHandler) reconcile(
@@ -115,11 +158,12 @@ func (handler *FlinkClusterHandler) reconcile(
 	log.Info("---------- 1. Observe the current state ----------")
 
 	var observer = ClusterStateObserver{
-		k8sClient:   k8sClient,
-		flinkClient: flinkClient,
-		request:     request,
-		context:     context,
-		log:         log,
+		k8sClient:      k8sClient,
+		flinkClient:    flinkClient,
+		request:        request,
+		context:        context,
+		log:            log,
+		flinkAPIAccess: handler.flinkAPIAccess,
 	}
 	err = observer.observe(observed)
 	if err != nil {
@@ -153,7 +197,7 @@ func (handler *FlinkClusterHandler) reconcile(
 
 	log.Info("---------- 3. Compute the desired state ----------")
 
-	*desired = getDesiredClusterState(observed.cluster, time.Now())
+	*desired = getDesiredClusterState(observed, time.Now())
 	if desired.ConfigMap != nil {
 		log.Info("Desired state", "ConfigMap", *desired.ConfigMap)
 	} else {
@@ -164,11 +208,24 @@ func (handler *FlinkClusterHandler) reconcile(
 	} else {
 		log.Info("Desired state", "JobManager deployment", "nil")
 	}
+	if desired.JmStatefulSet != nil {
+		log.Info("Desired state", "JobManager StatefulSet", *desired.JmStatefulSet)
+	} else {
+		log.Info("Desired state", "JobManager StatefulSet", "nil")
+	}
 	if desired.JmService != nil {
 		log.Info("Desired state", "JobManager service", *desired.JmService)
 	} else {
 		log.Info("Desired state", "JobManager service", "nil")
 	}
+	if desired.JmHeadlessService != nil {
+		log.Info(
+			"Desired state",
+			"JobManager headless service",
+			*desired.JmHeadlessService)
+	} else {
+		log.Info("Desired state", "JobManager headless service", "nil")
+	}
 	if desired.JmIngress != nil {
 		log.Info("Desired state", "JobManager ingress", *desired.JmIngress)
 	} else {
@@ -179,6 +236,19 @@ func (handler *FlinkClusterHandler) reconcile(
 	} else {
 		log.Info("Desired state", "TaskManager deployment", "nil")
 	}
+	if desired.TmStatefulSet != nil {
+		log.Info("Desired state", "TaskManager StatefulSet", *desired.TmStatefulSet)
+	} else {
+		log.Info("Desired state", "TaskManager StatefulSet", "nil")
+	}
+	if desired.TmHeadlessService != nil {
+		log.Info(
+			"Desired state",
+			"TaskManager headless service",
+			*desired.TmHeadlessService)
+	} else {
+		log.Info("Desired state", "TaskManager headless service", "nil")
+	}
 	if desired.Job != nil {
 		log.Info("Desired state", "Job", *desired.Job)
 	} else {
@@ -188,12 +258,15 @@ func (handler *FlinkClusterHandler) reconcile(
 	log.Info("---------- 4. Take actions ----------")
 
 	var reconciler = ClusterReconciler{
-		k8sClient:   handler.k8sClient,
-		flinkClient: flinkClient,
-		context:     handler.context,
-		log:         handler.log,
-		observed:    handler.observed,
-		desired:     handler.desired,
+		k8sClient:        handler.k8sClient,
+		flinkClient:      flinkClient,
+		savepointStorage: handler.savepointStorage,
+		jarStorage:       handler.jarStorage,
+		context:          handler.context,
+		log:              handler.log,
+		recorder:         handler.recorder,
+		observed:         handler.observed,
+		desired:          handler.desired,
 	}
 	result, err := reconciler.reconcile()
 	if err != nil {
@@ -0,0 +1,1236 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient/fake"
+	"github.com/googlecloudplatform/flink-operator/controllers/jarstorage"
+	"github.com/googlecloudplatform/flink-operator/controllers/savepointstorage"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	k8sfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Drives a FlinkCluster through its lifecycle with a fake Kubernetes API
+// server and a fake Flink REST API server. The Kubernetes controllers, e.g.,
+// the deployment and job controllers, are simulated by updating the status of
+// the child resources.
+type clusterLifecycleTest struct {
+	t           *testing.T
+	k8sClient   client.Client
+	flinkServer *fake.Server
+	recorder    *record.FakeRecorder
+	name        types.NamespacedName
+}
+
+func newClusterLifecycleTest(
+	t *testing.T, cluster *v1alpha1.FlinkCluster) *clusterLifecycleTest {
+	var clientScheme = runtime.NewScheme()
+	scheme.AddToScheme(clientScheme)
+	v1alpha1.AddToScheme(clientScheme)
+	cluster.Default()
+	return &clusterLifecycleTest{
+		t:           t,
+		k8sClient:   k8sfake.NewFakeClientWithScheme(clientScheme, cluster),
+		flinkServer: fake.NewServer(),
+		recorder:    record.NewFakeRecorder(1000),
+		name: types.NamespacedName{
+			Namespace: cluster.ObjectMeta.Namespace,
+			Name:      cluster.ObjectMeta.Name,
+		},
+	}
+}
+
+func (test *clusterLifecycleTest) close() {
+	test.flinkServer.Close()
+}
+
+func (test *clusterLifecycleTest) reconcile() ctrl.Result {
+	var handler = FlinkClusterHandler{
+		k8sClient:        test.k8sClient,
+		flinkClient:      test.flinkServer.Client(),
+		savepointStorage: savepointstorage.NewRegistry(),
+		jarStorage:       getTestJarStorage(),
+		request:          ctrl.Request{NamespacedName: test.name},
+		context:          context.Background(),
+		log:              log.Log,
+		recorder:         test.recorder,
+	}
+	var result, err = handler.reconcile(handler.request)
+	assert.NilError(test.t, err)
+	return result
+}
+
+// Reconciles the cluster until the condition is met.
+func (test *clusterLifecycleTest) reconcileUntil(
+	description string, condition func(cluster *v1alpha1.FlinkCluster) bool) {
+	for i := 0; i < 30; i++ {
+		test.simulateKubernetes()
+		if condition(test.getCluster()) {
+			return
+		}
+		test.reconcile()
+	}
+	test.t.Fatalf(
+		"Condition is not met: %v, job status: %+v",
+		description,
+		test.getCluster().Status.Components.Job)
+}
+
+func (test *clusterLifecycleTest) getCluster() *v1alpha1.FlinkCluster {
+	var cluster = &v1alpha1.FlinkCluster{}
+	var err = test.k8sClient.Get(context.Background(), test.name, cluster)
+	assert.NilError(test.t, err)
+	return cluster
+}
+
+func (test *clusterLifecycleTest) updateCluster(
+	update func(cluster *v1alpha1.FlinkCluster)) {
+	var cluster = test.getCluster()
+	update(cluster)
+	var err = test.k8sClient.Update(context.Background(), cluster)
+	assert.NilError(test.t, err)
+}
+
+func (test *clusterLifecycleTest) getJob() *batchv1.Job {
+	var job = &batchv1.Job{}
+	var err = test.k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{
+			Namespace: test.name.Namespace,
+			Name:      getJobName(test.name.Name),
+		},
+		job)
+	if err != nil {
+		return nil
+	}
+	return job
+}
+
+// Sets the status of the job submitter, e.g., when the job fails.
+func (test *clusterLifecycleTest) setJobStatus(status batchv1.JobStatus) {
+	var job = test.getJob()
+	assert.Assert(test.t, job != nil)
+	job.Status = status
+	var err = test.k8sClient.Update(context.Background(), job)
+	assert.NilError(test.t, err)
+}
+
+// Gets the events recorded since the last call.
+func (test *clusterLifecycleTest) getEvents() []string {
+	var events = []string{}
+	for {
+		select {
+		case event := <-test.recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// Simulates the Kubernetes controllers which make the deployments and the
+// StatefulSets available, allocate cluster IPs for services and start the
+// job submitter pods.
+func (test *clusterLifecycleTest) simulateKubernetes() {
+	var ctx = context.Background()
+
+	var deployments = &appsv1.DeploymentList{}
+	assert.NilError(test.t, test.k8sClient.List(ctx, deployments))
+	for i := range deployments.Items {
+		var deployment = &deployments.Items[i]
+		deployment.Status.Replicas = *deployment.Spec.Replicas
+		deployment.Status.AvailableReplicas = *deployment.Spec.Replicas
+		assert.NilError(test.t, test.k8sClient.Update(ctx, deployment))
+	}
+
+	var statefulSets = &appsv1.StatefulSetList{}
+	assert.NilError(test.t, test.k8sClient.List(ctx, statefulSets))
+	for i := range statefulSets.Items {
+		var statefulSet = &statefulSets.Items[i]
+		statefulSet.Status.Replicas = *statefulSet.Spec.Replicas
+		statefulSet.Status.ReadyReplicas = *statefulSet.Spec.Replicas
+		assert.NilError(test.t, test.k8sClient.Update(ctx, statefulSet))
+	}
+
+	var services = &corev1.ServiceList{}
+	assert.NilError(test.t, test.k8sClient.List(ctx, services))
+	for i := range services.Items {
+		var service = &services.Items[i]
+		if len(service.Spec.ClusterIP) == 0 {
+			service.Spec.ClusterIP = "10.0.0.1"
+			assert.NilError(test.t, test.k8sClient.Update(ctx, service))
+		}
+	}
+
+	var jobs = &batchv1.JobList{}
+	assert.NilError(test.t, test.k8sClient.List(ctx, jobs))
+	for i := range jobs.Items {
+		var job = &jobs.Items[i]
+		if job.ObjectMeta.CreationTimestamp.IsZero() {
+			job.ObjectMeta.CreationTimestamp = metav1.Now()
+			job.Status.Active = 1
+			assert.NilError(test.t, test.k8sClient.Update(ctx, job))
+		}
+	}
+}
+
+func getTestJobCluster() *v1alpha1.FlinkCluster {
+	var className = "org.apache.flink.examples.java.wordcount.WordCount"
+	var savepointsDir = "gs://my-bucket/savepoints"
+	return &v1alpha1.FlinkCluster{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "FlinkCluster",
+			APIVersion: "flinkoperator.k8s.io/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mycluster",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.FlinkClusterSpec{
+			Image: v1alpha1.ImageSpec{Name: "flink:1.8.1"},
+			JobManager: v1alpha1.JobManagerSpec{
+				AccessScope: v1alpha1.AccessScope.Cluster,
+			},
+			TaskManager: v1alpha1.TaskManagerSpec{Replicas: 2},
+			Job: &v1alpha1.JobSpec{
+				JarFile:       "./examples/streaming/WordCount.jar",
+				ClassName:     &className,
+				SavepointsDir: &savepointsDir,
+			},
+		},
+	}
+}
+
+func isJobRunning(jobID string) func(*v1alpha1.FlinkCluster) bool {
+	return func(cluster *v1alpha1.FlinkCluster) bool {
+		var jobStatus = cluster.Status.Components.Job
+		return jobStatus != nil && jobStatus.ID == jobID &&
+			jobStatus.State == v1alpha1.JobState.Running
+	}
+}
+
+func TestJobClusterLifecycle(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	var cluster = test.getCluster()
+	assert.Equal(t, cluster.Status.State, v1alpha1.ClusterState.Running)
+	assert.Assert(
+		t, hasFinalizer(cluster.ObjectMeta.Finalizers, finalSavepointFinalizer))
+
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+
+	// Take a savepoint on demand.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job.SavepointGeneration = 1
+	})
+	test.reconcileUntil(
+		"savepoint taken", func(cluster *v1alpha1.FlinkCluster) bool {
+			return len(cluster.Status.Components.Job.SavepointHistory) == 1
+		})
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.SavepointGeneration, int32(1))
+	assert.DeepEqual(
+		t,
+		jobStatus.SavepointHistory[0].Location,
+		"gs://my-bucket/savepoints/savepoint-trigger-1")
+	assert.Equal(
+		t, jobStatus.SavepointHistory[0].Type, v1alpha1.SavepointType.Manual)
+
+	// The job succeeds, the cluster is deleted by the default cleanup policy.
+	test.flinkServer.SetJob("job-1", fake.JobStateFinished)
+	test.setJobStatus(batchv1.JobStatus{Succeeded: 1})
+	test.reconcileUntil("cluster stopped", func(cluster *v1alpha1.FlinkCluster) bool {
+		return cluster.Status.State == v1alpha1.ClusterState.Stopped
+	})
+	assert.Equal(
+		t,
+		test.getCluster().Status.Components.Job.State,
+		v1alpha1.JobState.Succeeded)
+}
+
+func TestJobClusterFlinkJobStatus(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateCreated)
+	test.flinkServer.SetJobVertices("job-1", []flinkclient.JobVertex{
+		{ID: "vertex-1", Name: "Source", Parallelism: 2},
+		{ID: "vertex-2", Name: "Sink", Parallelism: 1},
+	})
+	test.reconcileUntil("job created", func(cluster *v1alpha1.FlinkCluster) bool {
+		var jobStatus = cluster.Status.Components.Job
+		return jobStatus != nil && jobStatus.FlinkJobState == fake.JobStateCreated
+	})
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.ID, "job-1")
+	assert.Equal(t, jobStatus.State, v1alpha1.JobState.Pending)
+	assert.Assert(t, len(jobStatus.StartTime) > 0)
+	assert.Equal(t, jobStatus.EndTime, "")
+	assert.DeepEqual(
+		t,
+		jobStatus.Vertices,
+		[]v1alpha1.JobVertexStatus{
+			{ID: "vertex-1", Name: "Source", Parallelism: 2},
+			{ID: "vertex-2", Name: "Sink", Parallelism: 1},
+		})
+
+	// Flink restarts the job by its restart strategy after a failure.
+	test.getEvents()
+	test.flinkServer.SetJob("job-1", fake.JobStateRestarting)
+	test.flinkServer.SetJobRestarts("job-1", 2)
+	test.flinkServer.SetJobException(
+		"job-1",
+		"java.lang.RuntimeException: boom\n\tat Job.main(Job.java:1)\n"+
+			strings.Repeat("\tat Job.run(Job.java:2)\n", 100))
+	test.reconcileUntil(
+		"job restarting", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.FlinkRestartCount == 2
+		})
+	jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.FlinkJobState, fake.JobStateRestarting)
+	assert.Equal(t, jobStatus.State, v1alpha1.JobState.Running)
+	assert.Equal(t, jobStatus.RestartCount, int32(0))
+	assert.Assert(t, len(jobStatus.FailureTime) > 0)
+	assert.Equal(t, len(jobStatus.FailureReason), maxFailureReasonLength)
+	assert.Assert(t, strings.HasPrefix(
+		jobStatus.FailureReason, "java.lang.RuntimeException: boom\n"))
+	var failureEvents = 0
+	for _, event := range test.getEvents() {
+		if strings.HasPrefix(event, "Warning JobFailure Flink job job-1 failed: "+
+			"java.lang.RuntimeException: boom") {
+			failureEvents++
+		}
+	}
+	assert.Equal(t, failureEvents, 1)
+
+	// The last failure is kept after the job recovers.
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil(
+		"job recovered", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.FlinkJobState ==
+				fake.JobStateRunning
+		})
+	assert.Equal(
+		t,
+		test.getCluster().Status.Components.Job.FailureTime,
+		jobStatus.FailureTime)
+
+	// The job is cancelled outside of the operator, the job submitter fails.
+	test.flinkServer.SetJob("job-1", fake.JobStateCanceled)
+	test.setJobStatus(batchv1.JobStatus{Failed: 1})
+	test.reconcileUntil(
+		"job cancelled", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.State ==
+				v1alpha1.JobState.Cancelled
+		})
+	var cluster = test.getCluster()
+	jobStatus = cluster.Status.Components.Job
+	assert.Equal(t, jobStatus.FlinkJobState, fake.JobStateCanceled)
+	assert.Assert(t, len(jobStatus.EndTime) > 0)
+	assert.Assert(t, len(jobStatus.Duration) > 0)
+	assert.Equal(t, cluster.Status.State, v1alpha1.ClusterState.Running)
+}
+
+func TestJobClusterCheckpointStatus(t *testing.T) {
+	var cluster = getTestJobCluster()
+	var threshold int32 = 600
+	cluster.Spec.Job.CheckpointStaleThresholdSeconds = &threshold
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, len(jobStatus.Conditions), 1)
+	assert.Equal(t, jobStatus.Conditions[0].Status, corev1.ConditionFalse)
+
+	// The latest checkpoint is older than the threshold.
+	var oldTime = time.Now().Add(-time.Hour)
+	test.flinkServer.AddFailedCheckpoint("job-1")
+	test.flinkServer.SetLatestCheckpoint("job-1", flinkclient.CheckpointInfo{
+		ID:                 1,
+		ExternalPath:       "gs://my-bucket/checkpoints/chk-1",
+		LatestAckTimestamp: oldTime.UnixNano() / int64(time.Millisecond),
+		StateSize:          1024,
+		EndToEndDuration:   1500,
+	})
+	test.reconcileUntil(
+		"checkpoint stale", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.Conditions[0].Status ==
+				corev1.ConditionTrue
+		})
+	jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(
+		t,
+		jobStatus.Conditions[0].Type,
+		v1alpha1.JobConditionType.CheckpointStale)
+	assert.DeepEqual(
+		t,
+		*jobStatus.Checkpoints,
+		v1alpha1.CheckpointStatus{
+			LatestCompleted: &v1alpha1.CompletedCheckpoint{
+				ID:        1,
+				Path:      "gs://my-bucket/checkpoints/chk-1",
+				Time:      oldTime.Format(time.RFC3339),
+				StateSize: 1024,
+				Duration:  "1.5s",
+			},
+			CompletedCount: 1,
+			FailedCount:    1,
+		})
+
+	// A new checkpoint completes.
+	test.flinkServer.SetLatestCheckpoint("job-1", flinkclient.CheckpointInfo{
+		ID:                 2,
+		LatestAckTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	test.reconcileUntil(
+		"checkpoint completed", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.Conditions[0].Status ==
+				corev1.ConditionFalse
+		})
+	assert.Equal(
+		t, test.getCluster().Status.Components.Job.Checkpoints.CompletedCount,
+		int64(2))
+}
+
+func TestSessionClusterJobs(t *testing.T) {
+	var cluster = getTestJobCluster()
+	cluster.Spec.Job = nil
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil(
+		"cluster running", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.State == v1alpha1.ClusterState.Running
+		})
+
+	// Several jobs are submitted to the session cluster.
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.flinkServer.SetJobName("job-1", "word count")
+	test.flinkServer.SetJob("job-2", fake.JobStateRunning)
+	test.flinkServer.SetJobName("job-2", "page rank")
+	test.reconcileUntil("jobs observed", func(cluster *v1alpha1.FlinkCluster) bool {
+		return len(cluster.Status.Components.Jobs) == 2
+	})
+	var status = test.getCluster().Status
+	assert.Assert(t, status.Components.Job == nil)
+	assert.Equal(t, status.State, v1alpha1.ClusterState.Running)
+	var jobs = status.Components.Jobs
+	assert.Equal(t, jobs[0].ID, "job-1")
+	assert.Equal(t, jobs[0].Name, "word count")
+	assert.Equal(t, jobs[0].State, fake.JobStateRunning)
+	assert.Assert(t, len(jobs[0].StartTime) > 0)
+	assert.Equal(t, jobs[1].ID, "job-2")
+	assert.Equal(t, jobs[1].Name, "page rank")
+
+	test.flinkServer.SetJob("job-1", fake.JobStateFinished)
+	test.reconcileUntil("job finished", func(cluster *v1alpha1.FlinkCluster) bool {
+		return cluster.Status.Components.Jobs[0].State == fake.JobStateFinished
+	})
+	assert.Equal(
+		t,
+		test.getCluster().Status.Components.Jobs[1].State,
+		fake.JobStateRunning)
+}
+
+func TestSessionClusterHighAvailability(t *testing.T) {
+	var jmReplicas int32 = 2
+	var cluster = getTestJobCluster()
+	cluster.Spec.Job = nil
+	cluster.Spec.JobManager.Replicas = &jmReplicas
+	cluster.Spec.HighAvailability = &v1alpha1.HighAvailabilitySpec{
+		Mode:       v1alpha1.HighAvailabilityMode.Kubernetes,
+		StorageDir: "gs://my-bucket/flink-ha",
+	}
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil(
+		"cluster running", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.State == v1alpha1.ClusterState.Running
+		})
+	var haResourceName = types.NamespacedName{
+		Namespace: "default",
+		Name:      "mycluster-ha",
+	}
+	var ctx = context.Background()
+	assert.NilError(
+		t, test.k8sClient.Get(ctx, haResourceName, &corev1.ServiceAccount{}))
+	assert.NilError(t, test.k8sClient.Get(ctx, haResourceName, &rbacv1.Role{}))
+	assert.NilError(
+		t, test.k8sClient.Get(ctx, haResourceName, &rbacv1.RoleBinding{}))
+
+	// The resources are deleted once HA is disabled.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.HighAvailability = nil
+		*cluster.Spec.JobManager.Replicas = 1
+	})
+	test.reconcile()
+	var err = test.k8sClient.Get(ctx, haResourceName, &corev1.ServiceAccount{})
+	assert.Assert(t, errors.IsNotFound(err))
+	err = test.k8sClient.Get(ctx, haResourceName, &rbacv1.Role{})
+	assert.Assert(t, errors.IsNotFound(err))
+	err = test.k8sClient.Get(ctx, haResourceName, &rbacv1.RoleBinding{})
+	assert.Assert(t, errors.IsNotFound(err))
+}
+
+func TestJobManagerStatefulSet(t *testing.T) {
+	var deploymentType = v1alpha1.DeploymentType.StatefulSet
+	var cluster = getTestJobCluster()
+	cluster.Spec.JobManager.DeploymentType = &deploymentType
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+	var status = test.getCluster().Status
+	assert.Equal(t, status.State, v1alpha1.ClusterState.Running)
+	assert.DeepEqual(
+		t,
+		status.Components.JobManagerDeployment,
+		v1alpha1.FlinkClusterComponentState{
+			Name:  "mycluster-jobmanager",
+			State: v1alpha1.ComponentState.Ready,
+		})
+
+	var ctx = context.Background()
+	var err = test.k8sClient.Get(
+		ctx,
+		types.NamespacedName{Namespace: "default", Name: "mycluster-jobmanager"},
+		&appsv1.Deployment{})
+	assert.Assert(t, errors.IsNotFound(err))
+	err = test.k8sClient.Get(
+		ctx,
+		types.NamespacedName{
+			Namespace: "default",
+			Name:      "mycluster-jobmanager-headless",
+		},
+		&corev1.Service{})
+	assert.NilError(t, err)
+}
+
+func TestTaskManagerScaling(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+	var status = test.getCluster().Status
+	assert.Equal(t, status.TaskManagerReplicas, int32(2))
+	assert.Equal(
+		t,
+		status.TaskManagerSelector,
+		"app=flink,cluster=mycluster,component=taskmanager")
+
+	// Changing the replicas, e.g., through the scale subresource, scales the
+	// TaskManager deployment without touching the job.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.TaskManager.Replicas = 4
+	})
+	test.reconcileUntil(
+		"TaskManagers scaled", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.TaskManagerReplicas == 4
+		})
+	var deployment = &appsv1.Deployment{}
+	var err = test.k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: "default", Name: "mycluster-taskmanager"},
+		deployment)
+	assert.NilError(t, err)
+	assert.Equal(t, *deployment.Spec.Replicas, int32(4))
+	assert.Equal(t, test.flinkServer.GetJob("job-1"), fake.JobStateRunning)
+	assert.Assert(t, isJobRunning("job-1")(test.getCluster()))
+}
+
+func TestJobClusterUpgrade(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+
+	// Changing the job spec upgrades the job through a savepoint.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job.Args = []string{"--input", "./README.txt"}
+	})
+	test.reconcileUntil(
+		"job resubmitted", func(cluster *v1alpha1.FlinkCluster) bool {
+			var jobStatus = cluster.Status.Components.Job
+			return jobStatus.UpgradePhase == v1alpha1.JobUpgradePhase.Resubmitting &&
+				test.getJob() != nil
+		})
+	assert.Equal(t, test.flinkServer.GetJob("job-1"), fake.JobStateCanceled)
+	assert.DeepEqual(
+		t,
+		getJobArg(test.getJob(), "--fromSavepoint"),
+		"gs://my-bucket/savepoints/savepoint-trigger-1")
+
+	test.flinkServer.SetJob("job-2", fake.JobStateRunning)
+	test.reconcileUntil("upgraded job running", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		return isJobRunning("job-2")(cluster) &&
+			len(cluster.Status.Components.Job.UpgradePhase) == 0
+	})
+	assert.Equal(
+		t,
+		test.getCluster().Status.Components.Job.FromSavepoint,
+		"gs://my-bucket/savepoints/savepoint-trigger-1")
+}
+
+// Checks whether any of the events has the prefix.
+func hasEvent(events []string, prefix string) bool {
+	return countEvents(events, prefix) > 0
+}
+
+// Counts the events which have the prefix.
+func countEvents(events []string, prefix string) int {
+	var count = 0
+	for _, event := range events {
+		if strings.HasPrefix(event, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestJobRescale(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+	test.flinkServer.FlinkVersion = "1.8.3"
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+
+	// The job is not rescaled up until the TaskManagers have enough slots.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		*cluster.Spec.Job.Parallelism = 4
+	})
+	for i := 0; i < 3; i++ {
+		test.simulateKubernetes()
+		test.reconcile()
+	}
+	// The warning is reported once while the job is waiting.
+	assert.Equal(t, countEvents(
+		test.getEvents(),
+		"Warning JobRescale Waiting for enough task slots to rescale the job "+
+			"to 4, available: 2"), 1)
+	assert.Equal(
+		t,
+		test.getCluster().Status.Components.Job.PendingRescaleParallelism,
+		int32(4))
+	assert.Equal(t, test.flinkServer.GetJobParallelism("job-1"), int32(1))
+
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.TaskManager.Replicas = 4
+	})
+	test.reconcileUntil(
+		"job rescaled", func(cluster *v1alpha1.FlinkCluster) bool {
+			var jobStatus = cluster.Status.Components.Job
+			return jobStatus.Parallelism == 4 &&
+				len(jobStatus.RescaleTriggerID) == 0
+		})
+	assert.Equal(t, test.flinkServer.GetJobParallelism("job-1"), int32(4))
+	assert.Equal(
+		t,
+		test.getCluster().Status.Components.Job.PendingRescaleParallelism,
+		int32(0))
+	assert.Equal(t, test.getCluster().Status.Components.Job.FlinkVersion, "1.8.3")
+	assert.Assert(t, isJobRunning("job-1")(test.getCluster()))
+	assert.Equal(t, getJobArg(test.getJob(), "--parallelism"), "1")
+	var events = test.getEvents()
+	assert.Assert(t, hasEvent(events, "Normal JobRescale Rescaling job from 1 to 4"))
+	assert.Assert(t, hasEvent(events, "Normal JobRescale Job rescaled to 4"))
+
+	// Rescaling down doesn't need more slots.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		*cluster.Spec.Job.Parallelism = 2
+	})
+	test.reconcileUntil(
+		"job rescaled down", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.Parallelism == 2
+		})
+	assert.Equal(t, test.flinkServer.GetJobParallelism("job-1"), int32(2))
+}
+
+func TestJobRescaleWithSavepoint(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+
+	// Flink 1.9 doesn't support the rescale API, the job is resubmitted from
+	// a savepoint with the new parallelism.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		*cluster.Spec.Job.Parallelism = 2
+	})
+	test.reconcileUntil(
+		"job resubmitted", func(cluster *v1alpha1.FlinkCluster) bool {
+			var jobStatus = cluster.Status.Components.Job
+			return jobStatus.UpgradePhase == v1alpha1.JobUpgradePhase.Resubmitting &&
+				test.getJob() != nil
+		})
+	assert.Equal(t, test.flinkServer.GetJob("job-1"), fake.JobStateCanceled)
+	assert.Equal(t, getJobArg(test.getJob(), "--parallelism"), "2")
+	assert.Equal(
+		t,
+		getJobArg(test.getJob(), "--fromSavepoint"),
+		"gs://my-bucket/savepoints/savepoint-trigger-1")
+	assert.Assert(t, hasEvent(
+		test.getEvents(),
+		"Normal JobUpgrade Flink 1.9.1 doesn't support the rescale API, taking "+
+			"savepoint before resubmitting the job with parallelism 2"))
+
+	test.flinkServer.SetJob("job-2", fake.JobStateRunning)
+	test.reconcileUntil("rescaled job running", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		return isJobRunning("job-2")(cluster) &&
+			len(cluster.Status.Components.Job.UpgradePhase) == 0
+	})
+	for i := 0; i < 3; i++ {
+		test.reconcile()
+	}
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Assert(t, isJobRunning("job-2")(test.getCluster()))
+	assert.Equal(t, jobStatus.Parallelism, int32(0))
+	assert.Equal(t, len(jobStatus.RescaleTriggerID), 0)
+}
+
+func TestJobRescaleFailure(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+	test.flinkServer.FlinkVersion = "1.8.3"
+	test.flinkServer.FailRescalings = true
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+
+	// The job is resubmitted from a savepoint when the rescaling fails.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		*cluster.Spec.Job.Parallelism = 2
+	})
+	test.reconcileUntil(
+		"job resubmitted", func(cluster *v1alpha1.FlinkCluster) bool {
+			var jobStatus = cluster.Status.Components.Job
+			return jobStatus.UpgradePhase == v1alpha1.JobUpgradePhase.Resubmitting &&
+				test.getJob() != nil
+		})
+	assert.Equal(t, test.flinkServer.GetJob("job-1"), fake.JobStateCanceled)
+	assert.Equal(t, test.flinkServer.GetJobParallelism("job-1"), int32(1))
+	assert.Equal(t, getJobArg(test.getJob(), "--parallelism"), "2")
+	assert.Assert(t, hasEvent(
+		test.getEvents(),
+		"Normal JobUpgrade Failed to rescale job: "+
+			"org.apache.flink.runtime.rest.handler.RestHandlerException: "+
+			"Rescaling is temporarily disabled. See FLINK-12312., taking "+
+			"savepoint before resubmitting the job with parallelism 2"))
+	assert.Equal(
+		t, len(test.getCluster().Status.Components.Job.RescaleTriggerID), 0)
+}
+
+func TestJobClusterRestartFromCheckpoint(t *testing.T) {
+	var cluster = getTestJobCluster()
+	var restartPolicy = corev1.RestartPolicy(
+		v1alpha1.JobRestartPolicy.FromSavepointOnFailure)
+	cluster.Spec.Job.RestartPolicy = &restartPolicy
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	assert.Equal(
+		t,
+		test.getJob().Spec.Template.Spec.RestartPolicy,
+		corev1.RestartPolicyNever)
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+
+	// The job fails after a checkpoint.
+	test.flinkServer.SetLatestCheckpoint("job-1", flinkclient.CheckpointInfo{
+		ID:                 7,
+		ExternalPath:       "gs://my-bucket/checkpoints/chk-7",
+		LatestAckTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateFailed)
+	test.setJobStatus(batchv1.JobStatus{Failed: 1})
+	test.reconcileUntil(
+		"restart scheduled", func(cluster *v1alpha1.FlinkCluster) bool {
+			return len(cluster.Status.Components.Job.NextRestartTime) > 0
+		})
+	assert.Equal(t, test.getCluster().Status.State, v1alpha1.ClusterState.Running)
+
+	// Skip the backoff, the failed job was created before the restart.
+	var failedJob = test.getJob()
+	failedJob.ObjectMeta.CreationTimestamp = metav1.NewTime(
+		time.Now().Add(-time.Hour))
+	assert.NilError(t, test.k8sClient.Update(context.Background(), failedJob))
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		var tc = &TimeConverter{}
+		cluster.Status.Components.Job.NextRestartTime =
+			tc.ToString(time.Now().Add(-time.Second))
+	})
+	test.reconcileUntil("job resubmitted", func(*v1alpha1.FlinkCluster) bool {
+		var job = test.getJob()
+		return job != nil && job.Status.Failed == 0
+	})
+	assert.Equal(
+		t,
+		getJobArg(test.getJob(), "--fromSavepoint"),
+		"gs://my-bucket/checkpoints/chk-7")
+
+	test.flinkServer.SetJob("job-2", fake.JobStateRunning)
+	test.reconcileUntil("restarted job running", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		return isJobRunning("job-2")(cluster) &&
+			cluster.Status.Components.Job.RestartCount == 1
+	})
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.FromSavepoint, "gs://my-bucket/checkpoints/chk-7")
+	assert.Equal(t, jobStatus.NextRestartTime, "")
+}
+
+// Gets the JAR storage of the tests, which reads the local JAR files created
+// in the temp dir.
+func getTestJarStorage() *jarstorage.Registry {
+	var registry = jarstorage.NewRegistry(jarstorage.DefaultMaxJarSize)
+	registry.Register("file", &jarstorage.LocalStorage{Dir: os.TempDir()})
+	return registry
+}
+
+// Gets a job cluster which submits the job through the Flink REST API, and
+// the local JAR file of the job which is removed by the returned function.
+func getTestRESTJobCluster(t *testing.T) (*v1alpha1.FlinkCluster, func()) {
+	var jarFile, err = ioutil.TempFile("", "WordCount*.jar")
+	assert.NilError(t, err)
+	_, err = jarFile.Write([]byte("jar"))
+	assert.NilError(t, err)
+	assert.NilError(t, jarFile.Close())
+
+	var cluster = getTestJobCluster()
+	var submissionMode = v1alpha1.JobSubmissionMode.REST
+	cluster.Spec.Job.SubmissionMode = &submissionMode
+	cluster.Spec.Job.JarFile = "file://" + jarFile.Name()
+	cluster.Spec.Job.Args = []string{"--input", "./README.txt"}
+	return cluster, func() { os.Remove(jarFile.Name()) }
+}
+
+func TestRESTJobSubmission(t *testing.T) {
+	var cluster, removeJar = getTestRESTJobCluster(t)
+	defer removeJar()
+	var restartPolicy = corev1.RestartPolicy(
+		v1alpha1.JobRestartPolicy.FromSavepointOnFailure)
+	cluster.Spec.Job.RestartPolicy = &restartPolicy
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil("job running", isJobRunning("jar-job-1"))
+	assert.Assert(t, test.getJob() == nil)
+	assert.Equal(t, test.getCluster().Status.Components.Job.Name, "")
+	assert.Equal(t, len(test.flinkServer.GetJars()), 0)
+	var runs = test.flinkServer.GetJarRuns()
+	assert.Equal(t, len(runs), 1)
+	assert.Equal(t, runs[0].EntryClass, *cluster.Spec.Job.ClassName)
+	assert.DeepEqual(t, runs[0].ProgramArgsList, cluster.Spec.Job.Args)
+	assert.Equal(t, runs[0].SavepointPath, "")
+	var events = strings.Join(test.getEvents(), "\n")
+	assert.Assert(t, strings.Contains(events, "Normal JobSubmit Job jar-job-1 submitted"))
+
+	// The failed job is resubmitted from the latest checkpoint.
+	test.flinkServer.SetLatestCheckpoint("jar-job-1", flinkclient.CheckpointInfo{
+		ID:                 3,
+		ExternalPath:       "gs://my-bucket/checkpoints/chk-3",
+		LatestAckTimestamp: time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	test.flinkServer.SetJob("jar-job-1", fake.JobStateFailed)
+	test.reconcileUntil(
+		"restart scheduled", func(cluster *v1alpha1.FlinkCluster) bool {
+			return len(cluster.Status.Components.Job.NextRestartTime) > 0
+		})
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		var tc = &TimeConverter{}
+		cluster.Status.Components.Job.NextRestartTime =
+			tc.ToString(time.Now().Add(-time.Second))
+	})
+	test.reconcileUntil("restarted job running", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		return isJobRunning("jar-job-2")(cluster) &&
+			cluster.Status.Components.Job.RestartCount == 1
+	})
+	runs = test.flinkServer.GetJarRuns()
+	assert.Equal(t, len(runs), 2)
+	assert.Equal(t, runs[1].SavepointPath, "gs://my-bucket/checkpoints/chk-3")
+	assert.Equal(
+		t,
+		test.getCluster().Status.Components.Job.FromSavepoint,
+		"gs://my-bucket/checkpoints/chk-3")
+
+	// Removing the job from the spec stops it with the final savepoint.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job = nil
+	})
+	test.reconcileUntil("job stopped", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		var jobStatus = cluster.Status.Components.Job
+		return jobStatus != nil &&
+			jobStatus.StopPhase == v1alpha1.JobStopPhase.Stopped
+	})
+	assert.Equal(t, test.flinkServer.GetJob("jar-job-2"), fake.JobStateFinished)
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.State, v1alpha1.JobState.Cancelled)
+	assert.Equal(
+		t,
+		jobStatus.SavepointLocation,
+		"gs://my-bucket/savepoints/savepoint-trigger-1")
+}
+
+func TestRESTJobSubmissionAdoptsActiveJob(t *testing.T) {
+	var cluster, removeJar = getTestRESTJobCluster(t)
+	defer removeJar()
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	// The job was submitted, but its ID was not recorded in the job status.
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+	assert.Equal(t, len(test.flinkServer.GetJarRuns()), 0)
+}
+
+func TestRESTJobRescale(t *testing.T) {
+	var cluster, removeJar = getTestRESTJobCluster(t)
+	defer removeJar()
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+	test.flinkServer.FlinkVersion = "1.8.3"
+
+	test.reconcileUntil("job running", isJobRunning("jar-job-1"))
+	assert.Equal(
+		t, test.getCluster().Status.Components.Job.Parallelism, int32(1))
+
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		*cluster.Spec.Job.Parallelism = 2
+	})
+	test.reconcileUntil(
+		"job rescaled", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.Parallelism == 2
+		})
+	assert.Equal(t, test.flinkServer.GetJobParallelism("jar-job-1"), int32(2))
+	assert.Equal(t, len(test.flinkServer.GetJarRuns()), 1)
+
+	// The job is resubmitted from a savepoint when the rescaling fails.
+	test.flinkServer.FailRescalings = true
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		*cluster.Spec.Job.Parallelism = 1
+	})
+	test.reconcileUntil("rescaled job running", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		return isJobRunning("jar-job-2")(cluster) &&
+			len(cluster.Status.Components.Job.UpgradePhase) == 0
+	})
+	assert.Equal(t, test.flinkServer.GetJob("jar-job-1"), fake.JobStateCanceled)
+	var runs = test.flinkServer.GetJarRuns()
+	assert.Equal(t, len(runs), 2)
+	assert.Equal(t, *runs[1].Parallelism, int32(1))
+	assert.Equal(
+		t, runs[1].SavepointPath, "gs://my-bucket/savepoints/savepoint-trigger-1")
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.Parallelism, int32(1))
+	assert.Equal(t, jobStatus.SkippedRescaleParallelism, int32(0))
+}
+
+func TestRESTJobUpgrade(t *testing.T) {
+	var cluster, removeJar = getTestRESTJobCluster(t)
+	defer removeJar()
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil("job running", isJobRunning("jar-job-1"))
+	var submittedSpecHash = test.getCluster().Status.Components.Job.SubmittedSpecHash
+	assert.Assert(t, len(submittedSpecHash) > 0)
+
+	// Changing the job spec upgrades the job through a savepoint, the job is
+	// resubmitted once the cancelled job has ended.
+	var args = []string{"--input", "./LICENSE"}
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job.Args = args
+	})
+	test.reconcileUntil("upgraded job running", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		return isJobRunning("jar-job-2")(cluster) &&
+			len(cluster.Status.Components.Job.UpgradePhase) == 0
+	})
+	assert.Assert(t, test.getJob() == nil)
+	assert.Equal(t, test.flinkServer.GetJob("jar-job-1"), fake.JobStateCanceled)
+	var runs = test.flinkServer.GetJarRuns()
+	assert.Equal(t, len(runs), 2)
+	assert.DeepEqual(t, runs[1].ProgramArgsList, args)
+	assert.Equal(
+		t, runs[1].SavepointPath, "gs://my-bucket/savepoints/savepoint-trigger-1")
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(
+		t, jobStatus.FromSavepoint, "gs://my-bucket/savepoints/savepoint-trigger-1")
+	assert.Assert(t, jobStatus.SubmittedSpecHash != submittedSpecHash)
+	assert.Assert(t, hasEvent(test.getEvents(), "Normal JobUpgrade Job upgrade completed"))
+
+	// The upgraded job is not upgraded again.
+	for i := 0; i < 3; i++ {
+		test.reconcile()
+	}
+	assert.Equal(t, len(test.flinkServer.GetJarRuns()), 2)
+	assert.Assert(t, isJobRunning("jar-job-2")(test.getCluster()))
+}
+
+func TestRESTJobSubmissionFailure(t *testing.T) {
+	var cluster, removeJar = getTestRESTJobCluster(t)
+	defer removeJar()
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+	test.flinkServer.JarRunError = "The main method caused an error"
+
+	test.reconcileUntil("job failed", func(cluster *v1alpha1.FlinkCluster) bool {
+		var jobStatus = cluster.Status.Components.Job
+		return jobStatus != nil && jobStatus.State == v1alpha1.JobState.Failed
+	})
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.ID, "")
+	assert.Assert(t, strings.Contains(
+		jobStatus.FailureReason, "The main method caused an error"))
+	assert.Assert(t, len(jobStatus.FailureTime) > 0)
+	var events = strings.Join(test.getEvents(), "\n")
+	assert.Assert(t, strings.Contains(events, "Warning JobSubmit Failed to submit job"))
+
+	// The failed job is not submitted again with the default restart policy.
+	test.reconcile()
+	test.reconcile()
+	assert.Equal(t, len(test.flinkServer.GetJarRuns()), 1)
+	assert.Equal(t, len(test.flinkServer.GetJars()), 0)
+}
+
+func TestJobStopWithFinalSavepoint(t *testing.T) {
+	// The final savepoint of the job without savepointsDir is taken to the
+	// default savepoints dir.
+	var cluster = getTestJobCluster()
+	cluster.Spec.Job.SavepointsDir = nil
+	cluster.Spec.FlinkProperties = map[string]string{
+		"state.savepoints.dir": "gs://my-bucket/default-savepoints"}
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+
+	// Removing the job from the spec stops it with the final savepoint.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job = nil
+	})
+	test.reconcileUntil("job stopped", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		var jobStatus = cluster.Status.Components.Job
+		return jobStatus != nil &&
+			jobStatus.StopPhase == v1alpha1.JobStopPhase.Stopped
+	})
+	assert.Assert(t, test.getJob() == nil)
+	assert.Equal(t, test.flinkServer.GetJob("job-1"), fake.JobStateFinished)
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.State, v1alpha1.JobState.Cancelled)
+	assert.Equal(
+		t,
+		jobStatus.SavepointLocation,
+		"gs://my-bucket/default-savepoints/savepoint-trigger-1")
+	assert.Equal(
+		t, jobStatus.SavepointHistory[0].Type, v1alpha1.SavepointType.Final)
+}
+
+func TestJobResubmittedAfterStop(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job.SavepointGeneration = 1
+	})
+	test.reconcileUntil(
+		"savepoint taken", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.SavepointGeneration == 1
+		})
+
+	var jobSpec = test.getCluster().Spec.Job
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job = nil
+	})
+	test.reconcileUntil("job stopped", func(
+		cluster *v1alpha1.FlinkCluster) bool {
+		var jobStatus = cluster.Status.Components.Job
+		return jobStatus != nil &&
+			jobStatus.StopPhase == v1alpha1.JobStopPhase.Stopped
+	})
+	// The final savepoint is taken to the savepoints dir of the removed job.
+	assert.Equal(
+		t,
+		test.getCluster().Status.Components.Job.SavepointLocation,
+		"gs://my-bucket/savepoints/savepoint-trigger-2")
+
+	// The new job keeps the served savepoint requests and the savepoint
+	// history of the stopped job.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job = jobSpec
+	})
+	test.reconcileUntil("job resubmitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-2", fake.JobStateRunning)
+	test.reconcileUntil("new job running", isJobRunning("job-2"))
+	for i := 0; i < 3; i++ {
+		test.reconcile()
+	}
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, jobStatus.SavepointGeneration, int32(1))
+	assert.Equal(t, len(jobStatus.StopPhase), 0)
+	assert.DeepEqual(
+		t,
+		[]string{
+			jobStatus.SavepointHistory[0].Type,
+			jobStatus.SavepointHistory[1].Type,
+		},
+		[]string{v1alpha1.SavepointType.Manual, v1alpha1.SavepointType.Final})
+	assert.Equal(t, len(test.flinkServer.GetSavepointLocations("job-2")), 0)
+}
+
+func TestSavepointRequestedDuringPeriodicSavepoint(t *testing.T) {
+	var cluster = getTestJobCluster()
+	var autoSavepointSeconds int32 = 3600
+	cluster.Spec.Job.AutoSavepointSeconds = &autoSavepointSeconds
+	var test = newClusterLifecycleTest(t, cluster)
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil(
+		"periodic savepoint triggered",
+		func(cluster *v1alpha1.FlinkCluster) bool {
+			var jobStatus = cluster.Status.Components.Job
+			return jobStatus != nil &&
+				jobStatus.LastSavepointState == v1alpha1.SavepointState.InProgress
+		})
+
+	// The periodic savepoint in progress doesn't serve the request.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.Spec.Job.SavepointGeneration = 1
+	})
+	test.reconcileUntil(
+		"periodic savepoint taken", func(cluster *v1alpha1.FlinkCluster) bool {
+			return len(cluster.Status.Components.Job.SavepointHistory) == 1
+		})
+	var jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(
+		t, jobStatus.SavepointHistory[0].Type, v1alpha1.SavepointType.Periodic)
+	assert.Equal(t, jobStatus.SavepointGeneration, int32(0))
+
+	test.reconcileUntil(
+		"manual savepoint taken", func(cluster *v1alpha1.FlinkCluster) bool {
+			return cluster.Status.Components.Job.SavepointGeneration == 1
+		})
+	jobStatus = test.getCluster().Status.Components.Job
+	assert.Equal(t, len(jobStatus.SavepointHistory), 2)
+	assert.Equal(
+		t, jobStatus.SavepointHistory[1].Type, v1alpha1.SavepointType.Manual)
+}
+
+func TestJobCancelWithoutFinalSavepoint(t *testing.T) {
+	var test = newClusterLifecycleTest(t, getTestJobCluster())
+	defer test.close()
+
+	test.reconcileUntil("job submitted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() != nil
+	})
+	test.flinkServer.SetJob("job-1", fake.JobStateRunning)
+	test.reconcileUntil("job running", isJobRunning("job-1"))
+
+	// The job is cancelled when the final savepoint is skipped.
+	test.updateCluster(func(cluster *v1alpha1.FlinkCluster) {
+		cluster.ObjectMeta.Annotations = map[string]string{
+			skipFinalSavepointAnnotation: "true"}
+		cluster.Spec.Job = nil
+	})
+	test.reconcileUntil("job deleted", func(*v1alpha1.FlinkCluster) bool {
+		return test.getJob() == nil
+	})
+	assert.Equal(t, test.flinkServer.GetJob("job-1"), fake.JobStateCanceled)
+	assert.Equal(
+		t, len(test.flinkServer.GetSavepointLocations("job-1")), 0)
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package controllers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"sort"
@@ -27,10 +30,12 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -39,8 +44,18 @@ import (
 // underlying Kubernetes resource specs.
 
 var delayDeleteClusterMinutes int32 = 5
+var configHashAnnotation = "flinkoperator.k8s.io/config-hash"
+var internalLoadBalancerAnnotation = "cloud.google.com/load-balancer-type"
 var flinkConfigMapPath = "/opt/flink/conf"
 var flinkConfigMapVolume = "flink-config-volume"
+var restTLSPath = "/opt/flink/rest-tls"
+var restTLSVolume = "rest-tls-volume"
+var tmLocalStatePath = "/flink-local-state"
+
+// The group of the Flink user in the Flink images, which the volumes of the
+// local state must be writable by.
+var flinkGroupID int64 = 9999
+var kubernetesHAServicesFactory = "org.apache.flink.kubernetes.highavailability.KubernetesHaServicesFactory"
 var flinkSystemProps = map[string]struct{}{
 	"jobmanager.rpc.address": {},
 	"jobmanager.rpc.port":    {},
@@ -57,24 +72,70 @@ type DesiredClusterState struct {
 	TmDeployment *appsv1.Deployment
 	ConfigMap    *corev1.ConfigMap
 	Job          *batchv1.Job
+	// The JobManager StatefulSet and its headless service, instead of the
+	// deployment with the "StatefulSet" deployment type.
+	JmStatefulSet     *appsv1.StatefulSet
+	JmHeadlessService *corev1.Service
+	// The TaskManager StatefulSet and its headless service, instead of the
+	// deployment with the volume claim templates.
+	TmStatefulSet     *appsv1.StatefulSet
+	TmHeadlessService *corev1.Service
+	// The service account of the cluster pods and its role for the
+	// Kubernetes HA services.
+	HAServiceAccount *corev1.ServiceAccount
+	HARole           *rbacv1.Role
+	HARoleBinding    *rbacv1.RoleBinding
 }
 
 // Gets the desired state of a cluster.
 func getDesiredClusterState(
-	cluster *v1alpha1.FlinkCluster,
+	observed *ObservedClusterState,
 	now time.Time) DesiredClusterState {
+	var cluster = observed.cluster
+
 	// The cluster has been deleted, all resources should be cleaned up.
 	if cluster == nil {
 		return DesiredClusterState{}
 	}
-	return DesiredClusterState{
+	var desired = DesiredClusterState{
 		ConfigMap:    getDesiredConfigMap(cluster, now),
 		JmDeployment: getDesiredJobManagerDeployment(cluster, now),
 		JmService:    getDesiredJobManagerService(cluster, now),
 		JmIngress:    getDesiredJobManagerIngress(cluster, now),
 		TmDeployment: getDesiredTaskManagerDeployment(cluster, now),
-		Job:          getDesiredJob(cluster),
+		Job:          getDesiredJob(observed),
+
+		JmStatefulSet:     getDesiredJobManagerStatefulSet(cluster, now),
+		JmHeadlessService: getDesiredJobManagerHeadlessService(cluster, now),
+		TmStatefulSet:     getDesiredTaskManagerStatefulSet(cluster, now),
+		TmHeadlessService: getDesiredTaskManagerHeadlessService(cluster, now),
+
+		HAServiceAccount: getDesiredHAServiceAccount(cluster),
+		HARole:           getDesiredHARole(cluster),
+		HARoleBinding:    getDesiredHARoleBinding(cluster),
+	}
+	// Flink reads the config only at startup, so the hash of the configMap is
+	// put into the pod templates to roll out the pods when the config changes.
+	if desired.ConfigMap != nil {
+		var configHash = getConfigMapHash(desired.ConfigMap)
+		if desired.JmDeployment != nil {
+			setPodTemplateConfigHash(
+				&desired.JmDeployment.Spec.Template, configHash)
+		}
+		if desired.JmStatefulSet != nil {
+			setPodTemplateConfigHash(
+				&desired.JmStatefulSet.Spec.Template, configHash)
+		}
+		if desired.TmDeployment != nil {
+			setPodTemplateConfigHash(
+				&desired.TmDeployment.Spec.Template, configHash)
+		}
+		if desired.TmStatefulSet != nil {
+			setPodTemplateConfigHash(
+				&desired.TmStatefulSet.Spec.Template, configHash)
+		}
 	}
+	return desired
 }
 
 // Gets the desired JobManager deployment spec from the FlinkCluster spec.
@@ -82,11 +143,64 @@ func getDesiredJobManagerDeployment(
 	flinkCluster *v1alpha1.FlinkCluster,
 	now time.Time) *appsv1.Deployment {
 
-	if shouldCleanup(flinkCluster, "JobManagerDeployment") {
+	if shouldCleanup(flinkCluster, "JobManagerDeployment") ||
+		flinkCluster.Spec.JobManager.IsStatefulSet() {
+		return nil
+	}
+
+	var podTemplate = getJobManagerPodTemplate(flinkCluster)
+	var jobManagerDeployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       flinkCluster.ObjectMeta.Namespace,
+			Name:            getJobManagerDeploymentName(flinkCluster.ObjectMeta.Name),
+			OwnerReferences: []metav1.OwnerReference{toOwnerReference(flinkCluster)},
+			Labels:          podTemplate.ObjectMeta.Labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: flinkCluster.Spec.JobManager.Replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: podTemplate.ObjectMeta.Labels},
+			Template: podTemplate,
+		},
+	}
+	return jobManagerDeployment
+}
+
+// Gets the desired JobManager StatefulSet spec from the FlinkCluster spec,
+// with the "StatefulSet" deployment type.
+func getDesiredJobManagerStatefulSet(
+	flinkCluster *v1alpha1.FlinkCluster,
+	now time.Time) *appsv1.StatefulSet {
+
+	if shouldCleanup(flinkCluster, "JobManagerStatefulSet") ||
+		!flinkCluster.Spec.JobManager.IsStatefulSet() {
 		return nil
 	}
 
-	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
+	var clusterName = flinkCluster.ObjectMeta.Name
+	var podTemplate = getJobManagerPodTemplate(flinkCluster)
+	var jobManagerStatefulSet = &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       flinkCluster.ObjectMeta.Namespace,
+			Name:            getJobManagerStatefulSetName(clusterName),
+			OwnerReferences: []metav1.OwnerReference{toOwnerReference(flinkCluster)},
+			Labels:          podTemplate.ObjectMeta.Labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    flinkCluster.Spec.JobManager.Replicas,
+			ServiceName: getJobManagerHeadlessServiceName(clusterName),
+			Selector:    &metav1.LabelSelector{MatchLabels: podTemplate.ObjectMeta.Labels},
+			Template:    podTemplate,
+			// The standby JobManagers don't need to wait for the leader.
+			PodManagementPolicy:  appsv1.ParallelPodManagement,
+			VolumeClaimTemplates: flinkCluster.Spec.JobManager.VolumeClaimTemplates,
+		},
+	}
+	return jobManagerStatefulSet
+}
+
+// Gets the pod template of the JobManager deployment or StatefulSet.
+func getJobManagerPodTemplate(
+	flinkCluster *v1alpha1.FlinkCluster) corev1.PodTemplateSpec {
 	var clusterName = flinkCluster.ObjectMeta.Name
 	var imageSpec = flinkCluster.Spec.Image
 	var jobManagerSpec = flinkCluster.Spec.JobManager
@@ -94,7 +208,6 @@ func getDesiredJobManagerDeployment(
 	var blobPort = corev1.ContainerPort{Name: "blob", ContainerPort: *jobManagerSpec.Ports.Blob}
 	var queryPort = corev1.ContainerPort{Name: "query", ContainerPort: *jobManagerSpec.Ports.Query}
 	var uiPort = corev1.ContainerPort{Name: "ui", ContainerPort: *jobManagerSpec.Ports.UI}
-	var jobManagerDeploymentName = getJobManagerDeploymentName(clusterName)
 	var labels = map[string]string{
 		"cluster":   clusterName,
 		"app":       "flink",
@@ -108,6 +221,11 @@ func getDesiredJobManagerDeployment(
 	confVol, confMount = getFlinkConfRsc(clusterName)
 	volumes = append(jobManagerSpec.Volumes, *confVol)
 	volumeMounts = append(jobManagerSpec.Mounts, *confMount)
+	if isRESTTLSEnabled(flinkCluster) {
+		var tlsVol, tlsMount = getRESTTLSRsc(flinkCluster)
+		volumes = append(volumes, *tlsVol)
+		volumeMounts = append(volumeMounts, *tlsMount)
+	}
 	var envVars = []corev1.EnvVar{
 		{
 			Name: "JOB_MANAGER_CPU_LIMIT",
@@ -130,43 +248,43 @@ func getDesiredJobManagerDeployment(
 			},
 		},
 	}
+	// With HA, the JobManager publishes its pod IP as the leader address,
+	// since the service may route to any of the JobManagers.
+	var args = []string{"jobmanager"}
+	if flinkCluster.Spec.HighAvailability != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name: "POD_IP",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"},
+			},
+		})
+		args = append(args, "$(POD_IP)")
+	}
 	envVars = append(envVars, flinkCluster.Spec.EnvVars...)
-	var jobManagerDeployment = &appsv1.Deployment{
+	return corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace:       clusterNamespace,
-			Name:            jobManagerDeploymentName,
-			OwnerReferences: []metav1.OwnerReference{toOwnerReference(flinkCluster)},
-			Labels:          labels,
+			Labels: labels,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: jobManagerSpec.Replicas,
-			Selector: &metav1.LabelSelector{MatchLabels: labels},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						corev1.Container{
-							Name:            "jobmanager",
-							Image:           imageSpec.Name,
-							ImagePullPolicy: imageSpec.PullPolicy,
-							Args:            []string{"jobmanager"},
-							Ports: []corev1.ContainerPort{
-								rpcPort, blobPort, queryPort, uiPort},
-							Resources:    jobManagerSpec.Resources,
-							Env:          envVars,
-							VolumeMounts: volumeMounts,
-						},
-					},
-					Volumes:          volumes,
-					NodeSelector:     jobManagerSpec.NodeSelector,
-					ImagePullSecrets: imageSpec.PullSecrets,
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				corev1.Container{
+					Name:            "jobmanager",
+					Image:           imageSpec.Name,
+					ImagePullPolicy: imageSpec.PullPolicy,
+					Args:            args,
+					Ports: []corev1.ContainerPort{
+						rpcPort, blobPort, queryPort, uiPort},
+					Resources:    jobManagerSpec.Resources,
+					Env:          envVars,
+					VolumeMounts: volumeMounts,
 				},
 			},
+			Volumes:            volumes,
+			NodeSelector:       jobManagerSpec.NodeSelector,
+			ImagePullSecrets:   imageSpec.PullSecrets,
+			ServiceAccountName: getPodServiceAccountName(flinkCluster),
 		},
 	}
-	return jobManagerDeployment
 }
 
 // Gets the desired JobManager service spec from a cluster spec.
@@ -181,22 +299,6 @@ func getDesiredJobManagerService(
 	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
 	var clusterName = flinkCluster.ObjectMeta.Name
 	var jobManagerSpec = flinkCluster.Spec.JobManager
-	var rpcPort = corev1.ServicePort{
-		Name:       "rpc",
-		Port:       *jobManagerSpec.Ports.RPC,
-		TargetPort: intstr.FromString("rpc")}
-	var blobPort = corev1.ServicePort{
-		Name:       "blob",
-		Port:       *jobManagerSpec.Ports.Blob,
-		TargetPort: intstr.FromString("blob")}
-	var queryPort = corev1.ServicePort{
-		Name:       "query",
-		Port:       *jobManagerSpec.Ports.Query,
-		TargetPort: intstr.FromString("query")}
-	var uiPort = corev1.ServicePort{
-		Name:       "ui",
-		Port:       *jobManagerSpec.Ports.UI,
-		TargetPort: intstr.FromString("ui")}
 	var jobManagerServiceName = getJobManagerServiceName(clusterName)
 	var labels = map[string]string{
 		"cluster":   clusterName,
@@ -213,7 +315,7 @@ func getDesiredJobManagerService(
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: labels,
-			Ports:    []corev1.ServicePort{rpcPort, blobPort, queryPort, uiPort},
+			Ports:    getJobManagerServicePorts(&jobManagerSpec),
 		},
 	}
 	// This implementation is specific to GKE, see details at
@@ -225,7 +327,7 @@ func getDesiredJobManagerService(
 	case v1alpha1.AccessScope.VPC:
 		jobManagerService.Spec.Type = corev1.ServiceTypeLoadBalancer
 		jobManagerService.Annotations =
-			map[string]string{"cloud.google.com/load-balancer-type": "Internal"}
+			map[string]string{internalLoadBalancerAnnotation: "Internal"}
 	case v1alpha1.AccessScope.External:
 		jobManagerService.Spec.Type = corev1.ServiceTypeLoadBalancer
 	default:
@@ -235,6 +337,66 @@ func getDesiredJobManagerService(
 	return jobManagerService
 }
 
+// Gets the desired headless service of the JobManager StatefulSet, which
+// gives the pods stable hostnames, e.g.,
+// "<cluster>-jobmanager-0.<cluster>-jobmanager-headless".
+func getDesiredJobManagerHeadlessService(
+	flinkCluster *v1alpha1.FlinkCluster,
+	now time.Time) *corev1.Service {
+
+	if shouldCleanup(flinkCluster, "JobManagerHeadlessService") ||
+		!flinkCluster.Spec.JobManager.IsStatefulSet() {
+		return nil
+	}
+
+	var clusterName = flinkCluster.ObjectMeta.Name
+	var labels = map[string]string{
+		"cluster":   clusterName,
+		"app":       "flink",
+		"component": "jobmanager",
+	}
+	var headlessService = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: flinkCluster.ObjectMeta.Namespace,
+			Name:      getJobManagerHeadlessServiceName(clusterName),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			Ports:     getJobManagerServicePorts(&flinkCluster.Spec.JobManager),
+			// The hostnames are resolvable before the pods are ready, e.g.,
+			// for the standby JobManagers.
+			PublishNotReadyAddresses: true,
+		},
+	}
+	return headlessService
+}
+
+func getJobManagerServicePorts(
+	jobManagerSpec *v1alpha1.JobManagerSpec) []corev1.ServicePort {
+	var rpcPort = corev1.ServicePort{
+		Name:       "rpc",
+		Port:       *jobManagerSpec.Ports.RPC,
+		TargetPort: intstr.FromString("rpc")}
+	var blobPort = corev1.ServicePort{
+		Name:       "blob",
+		Port:       *jobManagerSpec.Ports.Blob,
+		TargetPort: intstr.FromString("blob")}
+	var queryPort = corev1.ServicePort{
+		Name:       "query",
+		Port:       *jobManagerSpec.Ports.Query,
+		TargetPort: intstr.FromString("query")}
+	var uiPort = corev1.ServicePort{
+		Name:       "ui",
+		Port:       *jobManagerSpec.Ports.UI,
+		TargetPort: intstr.FromString("ui")}
+	return []corev1.ServicePort{rpcPort, blobPort, queryPort, uiPort}
+}
+
 // Gets the desired JobManager ingress spec from a cluster spec.
 func getDesiredJobManagerIngress(
 	flinkCluster *v1alpha1.FlinkCluster,
@@ -316,18 +478,129 @@ func getDesiredTaskManagerDeployment(
 	flinkCluster *v1alpha1.FlinkCluster,
 	now time.Time) *appsv1.Deployment {
 
-	if shouldCleanup(flinkCluster, "TaskManagerDeployment") {
+	if shouldCleanup(flinkCluster, "TaskManagerDeployment") ||
+		isTaskManagerStatefulSet(flinkCluster) {
+		return nil
+	}
+
+	var podTemplate = getTaskManagerPodTemplate(flinkCluster)
+	var taskManagerDeployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: flinkCluster.ObjectMeta.Namespace,
+			Name:      getTaskManagerDeploymentName(flinkCluster.ObjectMeta.Name),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: podTemplate.ObjectMeta.Labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &flinkCluster.Spec.TaskManager.Replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: podTemplate.ObjectMeta.Labels},
+			Template: podTemplate,
+		},
+	}
+	return taskManagerDeployment
+}
+
+// Gets the desired TaskManager StatefulSet spec from a cluster spec, with
+// the volume claim templates for the local state.
+func getDesiredTaskManagerStatefulSet(
+	flinkCluster *v1alpha1.FlinkCluster,
+	now time.Time) *appsv1.StatefulSet {
+
+	if shouldCleanup(flinkCluster, "TaskManagerStatefulSet") ||
+		!isTaskManagerStatefulSet(flinkCluster) {
+		return nil
+	}
+
+	var taskManagerStatefulSetName = getTaskManagerStatefulSetName(
+		flinkCluster.ObjectMeta.Name)
+	var podTemplate = getTaskManagerPodTemplate(flinkCluster)
+	var taskManagerStatefulSet = &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: flinkCluster.ObjectMeta.Namespace,
+			Name:      taskManagerStatefulSetName,
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: podTemplate.ObjectMeta.Labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &flinkCluster.Spec.TaskManager.Replicas,
+			// The TaskManagers register with their IPs, the headless service
+			// only gives the pods their stable hostnames.
+			ServiceName: getTaskManagerHeadlessServiceName(
+				flinkCluster.ObjectMeta.Name),
+			Selector: &metav1.LabelSelector{MatchLabels: podTemplate.ObjectMeta.Labels},
+			Template: podTemplate,
+			// The TaskManagers are independent of each other.
+			PodManagementPolicy:  appsv1.ParallelPodManagement,
+			VolumeClaimTemplates: flinkCluster.Spec.TaskManager.VolumeClaimTemplates,
+		},
+	}
+	return taskManagerStatefulSet
+}
+
+// Gets the desired headless service of the TaskManager StatefulSet, which
+// gives the pods stable hostnames, e.g.,
+// "<cluster>-taskmanager-0.<cluster>-taskmanager".
+func getDesiredTaskManagerHeadlessService(
+	flinkCluster *v1alpha1.FlinkCluster,
+	now time.Time) *corev1.Service {
+
+	if shouldCleanup(flinkCluster, "TaskManagerHeadlessService") ||
+		!isTaskManagerStatefulSet(flinkCluster) {
 		return nil
 	}
 
-	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
+	var clusterName = flinkCluster.ObjectMeta.Name
+	var taskManagerSpec = flinkCluster.Spec.TaskManager
+	var labels = map[string]string{
+		"cluster":   clusterName,
+		"app":       "flink",
+		"component": "taskmanager",
+	}
+	var headlessService = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: flinkCluster.ObjectMeta.Namespace,
+			Name:      getTaskManagerHeadlessServiceName(clusterName),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "data",
+					Port:       *taskManagerSpec.Ports.Data,
+					TargetPort: intstr.FromString("data"),
+				},
+				{
+					Name:       "rpc",
+					Port:       *taskManagerSpec.Ports.RPC,
+					TargetPort: intstr.FromString("rpc"),
+				},
+				{
+					Name:       "query",
+					Port:       *taskManagerSpec.Ports.Query,
+					TargetPort: intstr.FromString("query"),
+				},
+			},
+		},
+	}
+	return headlessService
+}
+
+// Gets the pod template of the TaskManager deployment or StatefulSet.
+func getTaskManagerPodTemplate(
+	flinkCluster *v1alpha1.FlinkCluster) corev1.PodTemplateSpec {
 	var clusterName = flinkCluster.ObjectMeta.Name
 	var imageSpec = flinkCluster.Spec.Image
 	var taskManagerSpec = flinkCluster.Spec.TaskManager
 	var dataPort = corev1.ContainerPort{Name: "data", ContainerPort: *taskManagerSpec.Ports.Data}
 	var rpcPort = corev1.ContainerPort{Name: "rpc", ContainerPort: *taskManagerSpec.Ports.RPC}
 	var queryPort = corev1.ContainerPort{Name: "query", ContainerPort: *taskManagerSpec.Ports.Query}
-	var taskManagerDeploymentName = getTaskManagerDeploymentName(clusterName)
 	var labels = map[string]string{
 		"cluster":   clusterName,
 		"app":       "flink",
@@ -341,6 +614,18 @@ func getDesiredTaskManagerDeployment(
 	confVol, confMount = getFlinkConfRsc(clusterName)
 	volumes = append(taskManagerSpec.Volumes, *confVol)
 	volumeMounts = append(taskManagerSpec.Mounts, *confMount)
+	// The volumes of the local state, which are created from the claim
+	// templates by the StatefulSet.
+	var securityContext *corev1.PodSecurityContext
+	for _, claim := range taskManagerSpec.VolumeClaimTemplates {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      claim.ObjectMeta.Name,
+			MountPath: getTaskManagerLocalStateDir(claim.ObjectMeta.Name),
+		})
+	}
+	if len(taskManagerSpec.VolumeClaimTemplates) > 0 {
+		securityContext = &corev1.PodSecurityContext{FSGroup: &flinkGroupID}
+	}
 	var envVars = []corev1.EnvVar{
 		{
 			Name: "TASK_MANAGER_CPU_LIMIT",
@@ -363,12 +648,31 @@ func getDesiredTaskManagerDeployment(
 			},
 		},
 	}
+	// The TaskManager of the StatefulSet keeps its identity across restarts,
+	// i.e., the resource ID is the pod name and the working dir is in the
+	// first volume of the local state, so that the restarted TaskManager
+	// recovers from the local state which it left behind.
+	var args = []string{"taskmanager"}
+	if len(taskManagerSpec.VolumeClaimTemplates) > 0 {
+		var claimName = taskManagerSpec.VolumeClaimTemplates[0].ObjectMeta.Name
+		envVars = append(envVars, corev1.EnvVar{
+			Name: "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			},
+		})
+		args = append(
+			args,
+			"-Dtaskmanager.resource-id=$(POD_NAME)",
+			"-Dprocess.taskmanager.working-dir="+
+				getTaskManagerLocalStateDir(claimName)+"/working-dir")
+	}
 	envVars = append(envVars, flinkCluster.Spec.EnvVars...)
 	var containers = []corev1.Container{corev1.Container{
 		Name:            "taskmanager",
 		Image:           imageSpec.Name,
 		ImagePullPolicy: imageSpec.PullPolicy,
-		Args:            []string{"taskmanager"},
+		Args:            args,
 		Ports: []corev1.ContainerPort{
 			dataPort, rpcPort, queryPort},
 		Resources:    taskManagerSpec.Resources,
@@ -376,31 +680,19 @@ func getDesiredTaskManagerDeployment(
 		VolumeMounts: volumeMounts,
 	}}
 	containers = append(containers, taskManagerSpec.Sidecars...)
-	var taskManagerDeployment = &appsv1.Deployment{
+	return corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace: clusterNamespace,
-			Name:      taskManagerDeploymentName,
-			OwnerReferences: []metav1.OwnerReference{
-				toOwnerReference(flinkCluster)},
 			Labels: labels,
 		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &taskManagerSpec.Replicas,
-			Selector: &metav1.LabelSelector{MatchLabels: labels},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Containers:       containers,
-					Volumes:          volumes,
-					NodeSelector:     taskManagerSpec.NodeSelector,
-					ImagePullSecrets: imageSpec.PullSecrets,
-				},
-			},
+		Spec: corev1.PodSpec{
+			Containers:         containers,
+			Volumes:            volumes,
+			NodeSelector:       taskManagerSpec.NodeSelector,
+			ImagePullSecrets:   imageSpec.PullSecrets,
+			ServiceAccountName: getPodServiceAccountName(flinkCluster),
+			SecurityContext:    securityContext,
 		},
 	}
-	return taskManagerDeployment
 }
 
 // Gets the desired configMap.
@@ -428,6 +720,49 @@ func getDesiredConfigMap(
 		"query.server.port":      strconv.FormatInt(int64(*jmPorts.Query), 10),
 		"rest.port":              strconv.FormatInt(int64(*jmPorts.UI), 10),
 	}
+	// REST TLS with the keystore and truststore in the mounted secret, their
+	// passwords are set through the Flink properties.
+	if isRESTTLSEnabled(flinkCluster) {
+		var tlsSpec = flinkCluster.Spec.RESTSecurity.TLS
+		flinkProps["security.ssl.rest.enabled"] = "true"
+		flinkProps["security.ssl.rest.keystore"] = restTLSPath + "/keystore.jks"
+		flinkProps["security.ssl.rest.truststore"] = restTLSPath + "/truststore.jks"
+		flinkProps["security.ssl.rest.authentication-enabled"] =
+			strconv.FormatBool(tlsSpec.ClientCertSecret != nil)
+	}
+	// Local recovery from the local state in the persistent volumes of the
+	// TaskManager StatefulSet.
+	if isTaskManagerStatefulSet(flinkCluster) {
+		var localStateDirs []string
+		for _, claim := range flinkCluster.Spec.TaskManager.VolumeClaimTemplates {
+			localStateDirs = append(
+				localStateDirs, getTaskManagerLocalStateDir(claim.ObjectMeta.Name))
+		}
+		flinkProps["state.backend.local-recovery"] = "true"
+		flinkProps["taskmanager.state.local.root-dirs"] =
+			strings.Join(localStateDirs, ",")
+	}
+	// HA services with the metadata in the storage dir, the cluster ID is
+	// qualified with the namespace, so that the clusters can share the dir.
+	if haSpec := flinkCluster.Spec.HighAvailability; haSpec != nil {
+		flinkProps["high-availability.storageDir"] = haSpec.StorageDir
+		flinkProps["high-availability.cluster-id"] =
+			clusterNamespace + "/" + clusterName
+		switch haSpec.Mode {
+		case v1alpha1.HighAvailabilityMode.Kubernetes:
+			flinkProps["high-availability"] = kubernetesHAServicesFactory
+			flinkProps["kubernetes.cluster-id"] = clusterName
+			flinkProps["kubernetes.namespace"] = clusterNamespace
+		case v1alpha1.HighAvailabilityMode.ZooKeeper:
+			flinkProps["high-availability"] = "zookeeper"
+			flinkProps["high-availability.zookeeper.quorum"] =
+				haSpec.ZooKeeper.Quorum
+			if haSpec.ZooKeeper.RootPath != nil {
+				flinkProps["high-availability.zookeeper.path.root"] =
+					*haSpec.ZooKeeper.RootPath
+			}
+		}
+	}
 	// Merge Flink properties.
 	for k, v := range flinkProperties {
 		// Do not allow to override properties in flinkSystemProps
@@ -457,14 +792,96 @@ func getDesiredConfigMap(
 	return configMap
 }
 
+// Gets the desired service account of the cluster pods, which the Kubernetes
+// HA services of Flink run with.
+func getDesiredHAServiceAccount(
+	flinkCluster *v1alpha1.FlinkCluster) *corev1.ServiceAccount {
+	if !isKubernetesHAEnabled(flinkCluster) ||
+		shouldCleanup(flinkCluster, "HAServiceAccount") {
+		return nil
+	}
+	return &corev1.ServiceAccount{
+		ObjectMeta: getHAObjectMeta(flinkCluster),
+	}
+}
+
+// Gets the desired role which allows the Kubernetes HA services to elect the
+// leader and store the job metadata pointers with ConfigMaps.
+func getDesiredHARole(flinkCluster *v1alpha1.FlinkCluster) *rbacv1.Role {
+	if !isKubernetesHAEnabled(flinkCluster) ||
+		shouldCleanup(flinkCluster, "HARole") {
+		return nil
+	}
+	return &rbacv1.Role{
+		ObjectMeta: getHAObjectMeta(flinkCluster),
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps"},
+				Verbs: []string{
+					"get", "list", "watch", "create", "update", "patch", "delete"},
+			},
+		},
+	}
+}
+
+// Gets the desired role binding of the HA role to the service account.
+func getDesiredHARoleBinding(
+	flinkCluster *v1alpha1.FlinkCluster) *rbacv1.RoleBinding {
+	if !isKubernetesHAEnabled(flinkCluster) ||
+		shouldCleanup(flinkCluster, "HARoleBinding") {
+		return nil
+	}
+	var name = getHAServiceAccountName(flinkCluster.ObjectMeta.Name)
+	return &rbacv1.RoleBinding{
+		ObjectMeta: getHAObjectMeta(flinkCluster),
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "Role",
+			Name:     name,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      name,
+				Namespace: flinkCluster.ObjectMeta.Namespace,
+			},
+		},
+	}
+}
+
+func getHAObjectMeta(flinkCluster *v1alpha1.FlinkCluster) metav1.ObjectMeta {
+	var clusterName = flinkCluster.ObjectMeta.Name
+	return metav1.ObjectMeta{
+		Namespace: flinkCluster.ObjectMeta.Namespace,
+		Name:      getHAServiceAccountName(clusterName),
+		OwnerReferences: []metav1.OwnerReference{
+			toOwnerReference(flinkCluster)},
+		Labels: map[string]string{
+			"cluster": clusterName,
+			"app":     "flink",
+		},
+	}
+}
+
+// Gets the service account of the cluster pods, empty for the default one.
+func getPodServiceAccountName(flinkCluster *v1alpha1.FlinkCluster) string {
+	if !isKubernetesHAEnabled(flinkCluster) {
+		return ""
+	}
+	return getHAServiceAccountName(flinkCluster.ObjectMeta.Name)
+}
+
 // Gets the desired job spec from a cluster spec.
 func getDesiredJob(
-	flinkCluster *v1alpha1.FlinkCluster) *batchv1.Job {
+	observed *ObservedClusterState) *batchv1.Job {
+	var flinkCluster = observed.cluster
 	var jobSpec = flinkCluster.Spec.Job
 	if jobSpec == nil {
 		return nil
 	}
 
+	var fromSavepoint = getFromSavepoint(observed)
 	var imageSpec = flinkCluster.Spec.Image
 	var jobManagerSpec = flinkCluster.Spec.JobManager
 	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
@@ -482,8 +899,8 @@ func getDesiredJob(
 	if jobSpec.ClassName != nil {
 		jobArgs = append(jobArgs, "--class", *jobSpec.ClassName)
 	}
-	if jobSpec.Savepoint != nil {
-		jobArgs = append(jobArgs, "--fromSavepoint", *jobSpec.Savepoint)
+	if len(fromSavepoint) > 0 {
+		jobArgs = append(jobArgs, "--fromSavepoint", fromSavepoint)
 	}
 	if jobSpec.AllowNonRestoredState != nil &&
 		*jobSpec.AllowNonRestoredState == true {
@@ -516,6 +933,29 @@ func getDesiredJob(
 	jobArgs = append(jobArgs, jarPath)
 
 	jobArgs = append(jobArgs, jobSpec.Args...)
+
+	// With REST TLS, the Flink CLI needs the Flink properties and the
+	// keystore and truststore to connect to the REST API.
+	var volumes = jobSpec.Volumes
+	var volumeMounts = jobSpec.Mounts
+	if isRESTTLSEnabled(flinkCluster) {
+		var confVol, confMount = getFlinkConfRsc(clusterName)
+		var tlsVol, tlsMount = getRESTTLSRsc(flinkCluster)
+		volumes = append(
+			append([]corev1.Volume{}, volumes...), *confVol, *tlsVol)
+		volumeMounts = append(
+			append([]corev1.VolumeMount{}, volumeMounts...), *confMount, *tlsMount)
+	}
+
+	// With FromSavepointOnFailure, the submitter is not retried by Kubernetes,
+	// the operator resubmits the failed job from the latest savepoint instead.
+	var restartPolicy = *jobSpec.RestartPolicy
+	var backoffLimit *int32
+	if string(restartPolicy) == v1alpha1.JobRestartPolicy.FromSavepointOnFailure {
+		restartPolicy = corev1.RestartPolicyNever
+		backoffLimit = new(int32)
+	}
+
 	var job = &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: clusterNamespace,
@@ -525,6 +965,7 @@ func getDesiredJob(
 			Labels: labels,
 		},
 		Spec: batchv1.JobSpec{
+			BackoffLimit: backoffLimit,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
@@ -537,12 +978,13 @@ func getDesiredJob(
 							ImagePullPolicy: imageSpec.PullPolicy,
 							Args:            jobArgs,
 							Env:             envVars,
-							VolumeMounts:    jobSpec.Mounts,
+							VolumeMounts:    volumeMounts,
 						},
 					},
-					RestartPolicy:    *jobSpec.RestartPolicy,
-					Volumes:          jobSpec.Volumes,
-					ImagePullSecrets: imageSpec.PullSecrets,
+					RestartPolicy:      restartPolicy,
+					Volumes:            volumes,
+					ImagePullSecrets:   imageSpec.PullSecrets,
+					ServiceAccountName: getPodServiceAccountName(flinkCluster),
 				},
 			},
 		},
@@ -550,6 +992,55 @@ func getDesiredJob(
 	return job
 }
 
+// Gets the file name of the JAR file of the job, e.g., "WordCount.jar" for
+// "https://example.com/jobs/WordCount.jar".
+func getJarFileName(jarFile string) string {
+	var parts = strings.Split(strings.SplitN(jarFile, "?", 2)[0], "/")
+	return parts[len(parts)-1]
+}
+
+// Gets the request to run the uploaded JAR of the job through the Flink REST
+// API, which is equivalent to the args of the job submitter.
+func getJarRunRequest(
+	jobSpec *v1alpha1.JobSpec, fromSavepoint string) flinkclient.JarRunRequest {
+	var request = flinkclient.JarRunRequest{
+		ProgramArgsList: jobSpec.Args,
+		Parallelism:     jobSpec.Parallelism,
+		SavepointPath:   fromSavepoint,
+	}
+	if jobSpec.ClassName != nil {
+		request.EntryClass = *jobSpec.ClassName
+	}
+	if jobSpec.AllowNonRestoredState != nil {
+		request.AllowNonRestoredState = *jobSpec.AllowNonRestoredState
+	}
+	return request
+}
+
+// Gets the hash of the job spec which the job is submitted with through the
+// Flink REST API, i.e., the fields which the args of the job submitter are
+// derived from, except the parallelism.
+func getJobSpecHash(jobSpec *v1alpha1.JobSpec) string {
+	var submitted = struct {
+		JarFile               string
+		ClassName             *string
+		Args                  []string
+		Savepoint             *string
+		SavepointRef          *corev1.LocalObjectReference
+		AllowNonRestoredState *bool
+	}{
+		JarFile:               jobSpec.JarFile,
+		ClassName:             jobSpec.ClassName,
+		Args:                  jobSpec.Args,
+		Savepoint:             jobSpec.Savepoint,
+		SavepointRef:          jobSpec.SavepointRef,
+		AllowNonRestoredState: jobSpec.AllowNonRestoredState,
+	}
+	var data, _ = json.Marshal(submitted)
+	var hash = sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
 // Converts the FlinkCluster as owner reference for its child resources.
 func toOwnerReference(
 	flinkCluster *v1alpha1.FlinkCluster) metav1.OwnerReference {
@@ -586,6 +1077,47 @@ func getJobManagerIngressHost(ingressHostFormat string, clusterName string) stri
 	return jobManagerIngressHostRegex.ReplaceAllString(ingressHostFormat, clusterName)
 }
 
+// Gets the savepoint location where to restore the job from. The savepoint
+// recorded in the job status, e.g., after an upgrade, takes precedence over the
+// savepoint in the job spec. The FlinkSavepoint referenced by the job spec is
+// resolved once it succeeds, after that the job keeps the location which it
+// was submitted with.
+func getFromSavepoint(observed *ObservedClusterState) string {
+	var jobSpec = observed.cluster.Spec.Job
+	var jobStatus = observed.cluster.Status.Components.Job
+	if jobStatus != nil && len(jobStatus.FromSavepoint) > 0 {
+		return jobStatus.FromSavepoint
+	}
+	if jobSpec.SavepointRef != nil {
+		if observed.job != nil {
+			return getJobArg(observed.job, "--fromSavepoint")
+		}
+		if isSavepointSucceeded(observed.savepoint) {
+			return observed.savepoint.Status.Location
+		}
+		return ""
+	}
+	if jobSpec.Savepoint != nil {
+		return *jobSpec.Savepoint
+	}
+	return ""
+}
+
+// Gets the value of the arg of the job submitter.
+func getJobArg(job *batchv1.Job, name string) string {
+	var containers = job.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return ""
+	}
+	var args = containers[0].Args
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == name {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
 // Checks whether the component should be deleted according to the cleanup
 // policy. Always return false for session cluster.
 func shouldCleanup(
@@ -614,12 +1146,36 @@ func shouldCleanup(
 	case v1alpha1.CleanupActionDeleteCluster:
 		return true
 	case v1alpha1.CleanupActionDeleteTaskManager:
-		return component == "TaskManagerDeployment"
+		return component == "TaskManagerDeployment" ||
+			component == "TaskManagerStatefulSet" ||
+			component == "TaskManagerHeadlessService"
 	}
 
 	return false
 }
 
+// Gets the hash of the configMap data.
+func getConfigMapHash(configMap *corev1.ConfigMap) string {
+	var keys = make([]string, 0, len(configMap.Data))
+	for k := range configMap.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var hash = sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte(configMap.Data[key]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func setPodTemplateConfigHash(template *corev1.PodTemplateSpec, hash string) {
+	if template.ObjectMeta.Annotations == nil {
+		template.ObjectMeta.Annotations = map[string]string{}
+	}
+	template.ObjectMeta.Annotations[configHashAnnotation] = hash
+}
+
 func getFlinkConfRsc(clusterName string) (*corev1.Volume, *corev1.VolumeMount) {
 	var confVol *corev1.Volume
 	var confMount *corev1.VolumeMount
@@ -640,6 +1196,32 @@ func getFlinkConfRsc(clusterName string) (*corev1.Volume, *corev1.VolumeMount) {
 	return confVol, confMount
 }
 
+// Gets the dir of the local state in the volume of the claim, which is
+// mounted in the TaskManager container.
+func getTaskManagerLocalStateDir(claimName string) string {
+	return tmLocalStatePath + "/" + claimName
+}
+
+// Gets the volume and the mount of the secret which contains the keystore
+// and the truststore of the REST TLS.
+func getRESTTLSRsc(
+	flinkCluster *v1alpha1.FlinkCluster) (*corev1.Volume, *corev1.VolumeMount) {
+	var tlsVol = &corev1.Volume{
+		Name: restTLSVolume,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: flinkCluster.Spec.RESTSecurity.TLS.KeystoreSecret,
+			},
+		},
+	}
+	var tlsMount = &corev1.VolumeMount{
+		Name:      restTLSVolume,
+		MountPath: restTLSPath,
+		ReadOnly:  true,
+	}
+	return tlsVol, tlsMount
+}
+
 // TODO: Wouldn't it be better to create a file, put it in an operator image, and read from them?.
 // Provide logging profiles
 func getLogConf() map[string]string {
@@ -17,17 +17,20 @@ limitations under the License.
 package controllers
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp/cmpopts"
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
 	"gotest.tools/assert"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -133,10 +136,14 @@ func TestGetDesiredClusterState(t *testing.T) {
 	}
 
 	// Run.
-	var desiredState = getDesiredClusterState(cluster, time.Now())
+	var desiredState = getDesiredClusterState(
+		&ObservedClusterState{cluster: cluster}, time.Now())
 
 	// Verify.
 
+	// The content of the configMap is verified below.
+	var configHash = getConfigMapHash(desiredState.ConfigMap)
+
 	// JmDeployment
 	var expectedDesiredJmDeployment = appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -172,6 +179,9 @@ func TestGetDesiredClusterState(t *testing.T) {
 						"cluster":   "flinkjobcluster-sample",
 						"component": "jobmanager",
 					},
+					Annotations: map[string]string{
+						"flinkoperator.k8s.io/config-hash": configHash,
+					},
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
@@ -380,6 +390,9 @@ func TestGetDesiredClusterState(t *testing.T) {
 						"cluster":   "flinkjobcluster-sample",
 						"component": "taskmanager",
 					},
+					Annotations: map[string]string{
+						"flinkoperator.k8s.io/config-hash": configHash,
+					},
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
@@ -556,3 +569,375 @@ taskmanager.numberOfTaskSlots: 1
 		*desiredState.ConfigMap,
 		expectedConfigMap)
 }
+
+func TestGetFromSavepointRef(t *testing.T) {
+	var cluster = &v1alpha1.FlinkCluster{
+		Spec: v1alpha1.FlinkClusterSpec{
+			Job: &v1alpha1.JobSpec{
+				SavepointRef: &corev1.LocalObjectReference{Name: "mysavepoint"},
+			},
+		},
+	}
+	var savepoint = &v1alpha1.FlinkSavepoint{
+		Status: v1alpha1.FlinkSavepointStatus{
+			State: v1alpha1.FlinkSavepointState.InProgress,
+		},
+	}
+	var observed = &ObservedClusterState{cluster: cluster, savepoint: savepoint}
+
+	// Not submitted until the savepoint succeeds.
+	assert.Equal(t, getFromSavepoint(observed), "")
+
+	savepoint.Status.State = v1alpha1.FlinkSavepointState.Succeeded
+	savepoint.Status.Location = "file:/tmp/savepoint-1"
+	assert.Equal(t, getFromSavepoint(observed), "file:/tmp/savepoint-1")
+
+	// The submitted job keeps the savepoint it was restored from.
+	observed.job = &batchv1.Job{
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Args: []string{"--fromSavepoint", "file:/tmp/savepoint-0"},
+					}},
+				},
+			},
+		},
+	}
+	assert.Equal(t, getFromSavepoint(observed), "file:/tmp/savepoint-0")
+}
+
+func TestGetJarRunRequest(t *testing.T) {
+	var className = "org.apache.flink.examples.java.wordcount.WordCount"
+	var parallelism int32 = 2
+	var jobSpec = &v1alpha1.JobSpec{
+		JarFile:               "https://example.com/jobs/WordCount.jar?version=1",
+		ClassName:             &className,
+		Args:                  []string{"--input", "./README.txt"},
+		Parallelism:           &parallelism,
+		AllowNonRestoredState: &[]bool{true}[0],
+	}
+
+	assert.Equal(t, getJarFileName(jobSpec.JarFile), "WordCount.jar")
+	assert.Equal(t, getJarFileName("/opt/flink/WordCount.jar"), "WordCount.jar")
+	assert.DeepEqual(
+		t,
+		getJarRunRequest(jobSpec, "gs://my-bucket/savepoint-1"),
+		flinkclient.JarRunRequest{
+			EntryClass:            className,
+			ProgramArgsList:       []string{"--input", "./README.txt"},
+			Parallelism:           &parallelism,
+			SavepointPath:         "gs://my-bucket/savepoint-1",
+			AllowNonRestoredState: true,
+		})
+}
+
+func TestGetDesiredClusterStateWithRESTTLS(t *testing.T) {
+	var clientCertSecret = "operator-cert"
+	var cluster = getTestJobCluster()
+	cluster.Spec.RESTSecurity = &v1alpha1.RESTSecuritySpec{
+		TLS: &v1alpha1.RESTTLSSpec{
+			KeystoreSecret:   "rest-keystore",
+			CASecret:         "rest-ca",
+			ClientCertSecret: &clientCertSecret,
+		},
+	}
+	cluster.Default()
+	var observed = &ObservedClusterState{cluster: cluster}
+	var desiredState = getDesiredClusterState(observed, time.Now())
+
+	var flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	for _, property := range []string{
+		"security.ssl.rest.enabled: true",
+		"security.ssl.rest.keystore: /opt/flink/rest-tls/keystore.jks",
+		"security.ssl.rest.truststore: /opt/flink/rest-tls/truststore.jks",
+		"security.ssl.rest.authentication-enabled: true",
+	} {
+		assert.Assert(t, strings.Contains(flinkConf, property), property)
+	}
+
+	var tlsVolume = corev1.Volume{
+		Name: "rest-tls-volume",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: "rest-keystore"},
+		},
+	}
+	var tlsMount = corev1.VolumeMount{
+		Name:      "rest-tls-volume",
+		MountPath: "/opt/flink/rest-tls",
+		ReadOnly:  true,
+	}
+	var jmPodSpec = desiredState.JmDeployment.Spec.Template.Spec
+	assert.DeepEqual(t, jmPodSpec.Volumes[len(jmPodSpec.Volumes)-1], tlsVolume)
+	var jmMounts = jmPodSpec.Containers[0].VolumeMounts
+	assert.DeepEqual(t, jmMounts[len(jmMounts)-1], tlsMount)
+
+	// The job submitter also gets the Flink properties to connect to the REST
+	// API with TLS.
+	var jobPodSpec = desiredState.Job.Spec.Template.Spec
+	assert.Equal(t, len(jobPodSpec.Volumes), 2)
+	assert.Equal(t, jobPodSpec.Volumes[0].Name, "flink-config-volume")
+	assert.DeepEqual(t, jobPodSpec.Volumes[1], tlsVolume)
+	assert.DeepEqual(t, jobPodSpec.Containers[0].VolumeMounts[1], tlsMount)
+}
+
+func TestGetDesiredClusterStateWithHighAvailability(t *testing.T) {
+	var jmReplicas int32 = 2
+	var cluster = getTestJobCluster()
+	cluster.Spec.JobManager.Replicas = &jmReplicas
+	cluster.Spec.HighAvailability = &v1alpha1.HighAvailabilitySpec{
+		Mode:       v1alpha1.HighAvailabilityMode.Kubernetes,
+		StorageDir: "gs://my-bucket/flink-ha",
+	}
+	cluster.Default()
+	var observed = &ObservedClusterState{cluster: cluster}
+	var desiredState = getDesiredClusterState(observed, time.Now())
+
+	var flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	for _, property := range []string{
+		"high-availability: org.apache.flink.kubernetes.highavailability.KubernetesHaServicesFactory",
+		"high-availability.storageDir: gs://my-bucket/flink-ha",
+		"high-availability.cluster-id: default/mycluster",
+		"kubernetes.cluster-id: mycluster",
+		"kubernetes.namespace: default",
+	} {
+		assert.Assert(t, strings.Contains(flinkConf, property), property)
+	}
+
+	// The JobManagers publish their pod IPs as the leader address.
+	var jmPodSpec = desiredState.JmDeployment.Spec.Template.Spec
+	assert.Equal(t, *desiredState.JmDeployment.Spec.Replicas, int32(2))
+	assert.DeepEqual(
+		t, jmPodSpec.Containers[0].Args, []string{"jobmanager", "$(POD_IP)"})
+	assert.Equal(t, jmPodSpec.Containers[0].Env[2].Name, "POD_IP")
+
+	// All the pods run with the service account which can manage ConfigMaps.
+	var serviceAccountName = "mycluster-ha"
+	assert.Equal(t, jmPodSpec.ServiceAccountName, serviceAccountName)
+	assert.Equal(
+		t,
+		desiredState.TmDeployment.Spec.Template.Spec.ServiceAccountName,
+		serviceAccountName)
+	assert.Equal(
+		t,
+		desiredState.Job.Spec.Template.Spec.ServiceAccountName,
+		serviceAccountName)
+	assert.Equal(t, desiredState.HAServiceAccount.Name, serviceAccountName)
+	assert.DeepEqual(
+		t,
+		desiredState.HARole.Rules,
+		[]rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps"},
+				Verbs: []string{
+					"get", "list", "watch", "create", "update", "patch", "delete"},
+			},
+		})
+	assert.Equal(t, desiredState.HARoleBinding.RoleRef.Name, serviceAccountName)
+	assert.DeepEqual(
+		t,
+		desiredState.HARoleBinding.Subjects,
+		[]rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      serviceAccountName,
+				Namespace: "default",
+			},
+		})
+
+	// ZooKeeper doesn't need the service account.
+	var rootPath = "/flink-clusters"
+	cluster.Spec.HighAvailability = &v1alpha1.HighAvailabilitySpec{
+		Mode:       v1alpha1.HighAvailabilityMode.ZooKeeper,
+		StorageDir: "gs://my-bucket/flink-ha",
+		ZooKeeper: &v1alpha1.ZooKeeperHASpec{
+			Quorum:   "zk-0.zk:2181,zk-1.zk:2181",
+			RootPath: &rootPath,
+		},
+	}
+	desiredState = getDesiredClusterState(observed, time.Now())
+	flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	for _, property := range []string{
+		"high-availability: zookeeper",
+		"high-availability.zookeeper.quorum: zk-0.zk:2181,zk-1.zk:2181",
+		"high-availability.zookeeper.path.root: /flink-clusters",
+	} {
+		assert.Assert(t, strings.Contains(flinkConf, property), property)
+	}
+	assert.Assert(t, !strings.Contains(flinkConf, "kubernetes.cluster-id"))
+	assert.Equal(
+		t, desiredState.JmDeployment.Spec.Template.Spec.ServiceAccountName, "")
+	assert.Assert(t, desiredState.HAServiceAccount == nil)
+	assert.Assert(t, desiredState.HARole == nil)
+	assert.Assert(t, desiredState.HARoleBinding == nil)
+}
+
+func TestGetDesiredClusterStateWithStatefulSet(t *testing.T) {
+	var deploymentType = v1alpha1.DeploymentType.StatefulSet
+	var storageClassName = "standard"
+	var volumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "jobmanager-data"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteOnce},
+				StorageClassName: &storageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("10Gi"),
+					},
+				},
+			},
+		},
+	}
+	var cluster = getTestJobCluster()
+	cluster.Spec.JobManager.DeploymentType = &deploymentType
+	cluster.Spec.JobManager.VolumeClaimTemplates = volumeClaimTemplates
+	cluster.Spec.JobManager.Mounts = []corev1.VolumeMount{
+		{Name: "jobmanager-data", MountPath: "/data"}}
+	cluster.Default()
+	var observed = &ObservedClusterState{cluster: cluster}
+	var desiredState = getDesiredClusterState(observed, time.Now())
+
+	// The StatefulSet runs the same pods as the deployment would.
+	assert.Assert(t, desiredState.JmDeployment == nil)
+	var statefulSet = desiredState.JmStatefulSet
+	assert.Equal(t, statefulSet.Name, "mycluster-jobmanager")
+	assert.Equal(t, *statefulSet.Spec.Replicas, int32(1))
+	assert.Equal(t, statefulSet.Spec.ServiceName, "mycluster-jobmanager-headless")
+	assert.Equal(
+		t, statefulSet.Spec.PodManagementPolicy, appsv1.ParallelPodManagement)
+	assert.DeepEqual(
+		t,
+		statefulSet.Spec.VolumeClaimTemplates,
+		volumeClaimTemplates,
+		cmpopts.IgnoreUnexported(resource.Quantity{}))
+	var podTemplate = getJobManagerPodTemplate(cluster)
+	setPodTemplateConfigHash(
+		&podTemplate, getConfigMapHash(desiredState.ConfigMap))
+	assert.DeepEqual(
+		t,
+		statefulSet.Spec.Template,
+		podTemplate,
+		cmpopts.IgnoreUnexported(resource.Quantity{}))
+	assert.DeepEqual(
+		t,
+		statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts[0],
+		corev1.VolumeMount{Name: "jobmanager-data", MountPath: "/data"})
+
+	var headlessService = desiredState.JmHeadlessService
+	assert.Equal(t, headlessService.Name, "mycluster-jobmanager-headless")
+	assert.Equal(t, headlessService.Spec.ClusterIP, corev1.ClusterIPNone)
+	assert.Assert(t, headlessService.Spec.PublishNotReadyAddresses)
+	assert.DeepEqual(
+		t, headlessService.Spec.Selector, statefulSet.Spec.Selector.MatchLabels)
+	assert.DeepEqual(
+		t, headlessService.Spec.Ports, desiredState.JmService.Spec.Ports)
+}
+
+func TestGetDesiredClusterStateWithTaskManagerStatefulSet(t *testing.T) {
+	var volumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "local-state-1"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteOnce},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "local-state-2"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteOnce},
+			},
+		},
+	}
+	var cluster = getTestJobCluster()
+	cluster.Spec.TaskManager.VolumeClaimTemplates = volumeClaimTemplates
+	cluster.Default()
+	var observed = &ObservedClusterState{cluster: cluster}
+	var desiredState = getDesiredClusterState(observed, time.Now())
+
+	assert.Assert(t, desiredState.TmDeployment == nil)
+	var statefulSet = desiredState.TmStatefulSet
+	assert.Equal(t, statefulSet.Name, "mycluster-taskmanager")
+	assert.Equal(t, *statefulSet.Spec.Replicas, cluster.Spec.TaskManager.Replicas)
+	assert.Equal(
+		t, statefulSet.Spec.PodManagementPolicy, appsv1.ParallelPodManagement)
+	assert.DeepEqual(
+		t, statefulSet.Spec.VolumeClaimTemplates, volumeClaimTemplates)
+
+	// The headless service of the StatefulSet selects the TaskManagers.
+	assert.Equal(t, statefulSet.Spec.ServiceName, "mycluster-taskmanager")
+	var headlessService = desiredState.TmHeadlessService
+	assert.Equal(t, headlessService.Name, "mycluster-taskmanager")
+	assert.Equal(t, headlessService.Spec.ClusterIP, corev1.ClusterIPNone)
+	assert.DeepEqual(
+		t, headlessService.Spec.Selector, statefulSet.Spec.Selector.MatchLabels)
+	assert.Equal(t, len(headlessService.Spec.Ports), 3)
+
+	// The volumes are mounted as the local state dirs.
+	var podSpec = statefulSet.Spec.Template.Spec
+	var mounts = podSpec.Containers[0].VolumeMounts
+	assert.DeepEqual(
+		t,
+		mounts[len(mounts)-2:],
+		[]corev1.VolumeMount{
+			{Name: "local-state-1", MountPath: "/flink-local-state/local-state-1"},
+			{Name: "local-state-2", MountPath: "/flink-local-state/local-state-2"},
+		})
+	assert.Equal(t, *podSpec.SecurityContext.FSGroup, int64(9999))
+
+	// The TaskManager has a stable resource ID and a working dir in the
+	// first volume.
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].Args,
+		[]string{
+			"taskmanager",
+			"-Dtaskmanager.resource-id=$(POD_NAME)",
+			"-Dprocess.taskmanager.working-dir=" +
+				"/flink-local-state/local-state-1/working-dir",
+		})
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].Env[2],
+		corev1.EnvVar{
+			Name: "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			},
+		})
+	assert.Equal(
+		t,
+		statefulSet.Spec.Template.Annotations[configHashAnnotation],
+		getConfigMapHash(desiredState.ConfigMap))
+
+	var flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	for _, property := range []string{
+		"state.backend.local-recovery: true",
+		"taskmanager.state.local.root-dirs: " +
+			"/flink-local-state/local-state-1,/flink-local-state/local-state-2",
+	} {
+		assert.Assert(t, strings.Contains(flinkConf, property), property)
+	}
+}
+
+func TestTaskManagerStatefulSetCleanup(t *testing.T) {
+	var cluster = getTestJobCluster()
+	cluster.Spec.TaskManager.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		{ObjectMeta: metav1.ObjectMeta{Name: "local-state"}},
+	}
+	cluster.Default()
+	cluster.Spec.Job.CleanupPolicy.AfterJobSucceeds =
+		v1alpha1.CleanupActionDeleteTaskManager
+	cluster.Status.Components.Job = &v1alpha1.JobStatus{
+		State: v1alpha1.JobState.Succeeded}
+	var observed = &ObservedClusterState{cluster: cluster}
+	var desiredState = getDesiredClusterState(observed, time.Now())
+
+	assert.Assert(t, desiredState.TmStatefulSet == nil)
+	assert.Assert(t, desiredState.TmHeadlessService == nil)
+	assert.Assert(t, desiredState.JmService != nil)
+}
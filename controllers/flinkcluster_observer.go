@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"errors"
+	"strconv"
 
 	"github.com/go-logr/logr"
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
@@ -27,6 +28,8 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -39,6 +42,8 @@ type ClusterStateObserver struct {
 	request     ctrl.Request
 	context     context.Context
 	log         logr.Logger
+	// How the Flink API is reached.
+	flinkAPIAccess FlinkAPIAccess
 }
 
 // ObservedClusterState holds observed state of a cluster.
@@ -52,6 +57,29 @@ type ObservedClusterState struct {
 	job          *batchv1.Job
 	flinkJobList *flinkclient.JobStatusList
 	flinkJobID   *string
+	// The details of the active Flink job, or of the recorded one if there is
+	// no active job.
+	flinkJob            *flinkclient.JobDetails
+	flinkJobRestarts    *int32
+	flinkJobExceptions  *flinkclient.JobExceptions
+	flinkJobCheckpoints *flinkclient.JobCheckpoints
+	// The jobs in the session cluster.
+	flinkJobsOverview *flinkclient.JobsOverview
+	savepoint         *v1alpha1.FlinkSavepoint
+	// The base URL of the Flink API, empty if it is not available.
+	flinkAPIBaseURL string
+	// The service account, role and role binding of the Kubernetes HA
+	// services.
+	haServiceAccount *corev1.ServiceAccount
+	haRole           *rbacv1.Role
+	haRoleBinding    *rbacv1.RoleBinding
+	// The JobManager StatefulSet and its headless service.
+	jmStatefulSet     *appsv1.StatefulSet
+	jmHeadlessService *corev1.Service
+	// The TaskManager StatefulSet.
+	tmStatefulSet *appsv1.StatefulSet
+	// The headless service of the TaskManager StatefulSet.
+	tmHeadlessService *corev1.Service
 }
 
 // Observes the state of the cluster and its components.
@@ -106,6 +134,21 @@ func (observer *ClusterStateObserver) observe(
 		observed.jmDeployment = observedJmDeployment
 	}
 
+	// (Optional) JobManager StatefulSet.
+	var observedJmStatefulSet = new(appsv1.StatefulSet)
+	err = observer.observeJobManagerStatefulSet(observedJmStatefulSet)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get JobManager StatefulSet")
+			return err
+		}
+		log.Info("Observed JobManager StatefulSet", "state", "nil")
+		observedJmStatefulSet = nil
+	} else {
+		log.Info("Observed JobManager StatefulSet", "state", *observedJmStatefulSet)
+		observed.jmStatefulSet = observedJmStatefulSet
+	}
+
 	// JobManager service.
 	var observedJmService = new(corev1.Service)
 	err = observer.observeJobManagerService(observedJmService)
@@ -121,6 +164,24 @@ func (observer *ClusterStateObserver) observe(
 		observed.jmService = observedJmService
 	}
 
+	// (Optional) JobManager headless service.
+	var observedJmHeadlessService = new(corev1.Service)
+	err = observer.observeJobManagerHeadlessService(observedJmHeadlessService)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get JobManager headless service")
+			return err
+		}
+		log.Info("Observed JobManager headless service", "state", "nil")
+		observedJmHeadlessService = nil
+	} else {
+		log.Info(
+			"Observed JobManager headless service",
+			"state",
+			*observedJmHeadlessService)
+		observed.jmHeadlessService = observedJmHeadlessService
+	}
+
 	// (Optional) JobManager ingress.
 	var observedJmIngress = new(extensionsv1beta1.Ingress)
 	err = observer.observeJobManagerIngress(observedJmIngress)
@@ -151,10 +212,118 @@ func (observer *ClusterStateObserver) observe(
 		observed.tmDeployment = observedTmDeployment
 	}
 
+	// (Optional) TaskManager StatefulSet.
+	var observedTmStatefulSet = new(appsv1.StatefulSet)
+	err = observer.observeTaskManagerStatefulSet(observedTmStatefulSet)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get TaskManager StatefulSet")
+			return err
+		}
+		log.Info("Observed TaskManager StatefulSet", "state", "nil")
+		observedTmStatefulSet = nil
+	} else {
+		log.Info("Observed TaskManager StatefulSet", "state", *observedTmStatefulSet)
+		observed.tmStatefulSet = observedTmStatefulSet
+	}
+
+	// (Optional) TaskManager headless service.
+	var observedTmHeadlessService = new(corev1.Service)
+	err = observer.observeTaskManagerHeadlessService(observedTmHeadlessService)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get TaskManager headless service")
+			return err
+		}
+		log.Info("Observed TaskManager headless service", "state", "nil")
+		observedTmHeadlessService = nil
+	} else {
+		log.Info(
+			"Observed TaskManager headless service",
+			"state",
+			*observedTmHeadlessService)
+		observed.tmHeadlessService = observedTmHeadlessService
+	}
+
+	// (Optional) service account, role and role binding of the Kubernetes HA
+	// services.
+	err = observer.observeHAResources(observed)
+	if err != nil {
+		return err
+	}
+
+	// Flink API.
+	observer.observeFlinkAPI(observed)
+
 	// (Optional) job.
 	err = observer.observeJob(observed)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// (Optional) jobs in the session cluster.
+	observer.observeSessionJobs(observed)
+
+	return nil
+}
+
+// Resolves the base URL of the Flink API and sets up the client for it. The
+// requests to the API fail if it cannot be set up, e.g., the JobManager
+// service has no cluster IP yet.
+func (observer *ClusterStateObserver) observeFlinkAPI(
+	observed *ObservedClusterState) {
+	var log = observer.log
+	if observed.cluster == nil {
+		return
+	}
+
+	var baseURL, err = getFlinkAPIBaseURL(
+		observer.context,
+		observer.k8sClient,
+		observed.cluster,
+		observer.flinkAPIAccess)
+	if err != nil {
+		log.Info("Failed to get Flink API base URL", "error", err)
+		return
+	}
+	err = configureFlinkClient(
+		observer.context,
+		observer.k8sClient,
+		observed.cluster,
+		observer.flinkClient,
+		observer.flinkAPIAccess)
+	if err != nil {
+		log.Error(err, "Failed to configure Flink API client")
+	}
+	observed.flinkAPIBaseURL = baseURL
+}
+
+// Observes all the jobs in a session cluster through Flink API. A session
+// cluster may be shared by several jobs, so multiple jobs are normal.
+func (observer *ClusterStateObserver) observeSessionJobs(
+	observed *ObservedClusterState) {
+	var log = observer.log
+
+	if observed.cluster == nil || observed.cluster.Spec.Job != nil {
+		return
+	}
+	if observed.cluster.Status.State != v1alpha1.ClusterState.Running {
+		log.Info(
+			"Skip getting Flink jobs in the session cluster.",
+			"clusterState",
+			observed.cluster.Status.State)
+		return
+	}
+
+	var overview, err = observer.flinkClient.GetJobsOverview(
+		observer.context, observed.flinkAPIBaseURL)
+	if err != nil {
+		// It is normal in many cases, not an error.
+		log.Info("Failed to get Flink jobs overview.", "error", err)
+		return
+	}
+	log.Info("Observed Flink jobs in the session cluster", "jobs", overview.Jobs)
+	observed.flinkJobsOverview = &overview
 }
 
 func (observer *ClusterStateObserver) observeJob(
@@ -162,8 +331,11 @@ func (observer *ClusterStateObserver) observeJob(
 	var err error
 	var log = observer.log
 
-	// Either the cluster has been deleted or it is a session cluster.
-	if observed.cluster == nil || observed.cluster.Spec.Job == nil {
+	// Either the cluster has been deleted or it is a session cluster. The job
+	// which has been removed from the spec is still observed until it stops.
+	if observed.cluster == nil ||
+		(observed.cluster.Spec.Job == nil &&
+			observed.cluster.Status.Components.Job == nil) {
 		return nil
 	}
 
@@ -186,6 +358,25 @@ func (observer *ClusterStateObserver) observeJob(
 		observed.job = observedJob
 	}
 
+	// (Optional) FlinkSavepoint where to restore the job from.
+	if observed.cluster.Spec.Job != nil &&
+		observed.cluster.Spec.Job.SavepointRef != nil {
+		var savepointRef = observed.cluster.Spec.Job.SavepointRef
+		var observedSavepoint = new(v1alpha1.FlinkSavepoint)
+		err = observer.observeSavepoint(savepointRef.Name, observedSavepoint)
+		if err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to get FlinkSavepoint")
+				return err
+			}
+			log.Info("Observed FlinkSavepoint", "state", "nil")
+			observedSavepoint = nil
+		} else {
+			log.Info("Observed FlinkSavepoint", "state", *observedSavepoint)
+			observed.savepoint = observedSavepoint
+		}
+	}
+
 	return nil
 }
 
@@ -194,10 +385,12 @@ func (observer *ClusterStateObserver) observeJob(
 //
 // This needs to be done after the cluster is running and before the job is
 // submitted, because we use it to detect whether the Flink API server is up
-// and running.
+// and running. The job list is observed on every reconcile, so that a job
+// resubmitted by the job submitter is detected.
 func (observer *ClusterStateObserver) observeFlinkJobs(
 	observed *ObservedClusterState) {
 	var log = observer.log
+	var recordedJobStatus = observed.cluster.Status.Components.Job
 
 	// Wait until the cluster is running.
 	if observed.cluster.Status.State !=
@@ -209,20 +402,10 @@ func (observer *ClusterStateObserver) observeFlinkJobs(
 		return
 	}
 
-	// Skip if it is already recorded.
-	var recordedJobStatus = observed.cluster.Status.Components.Job
-	if recordedJobStatus != nil && len(recordedJobStatus.ID) > 0 {
-		log.Info(
-			"Skip getting Flink job status.",
-			"recordedStatus",
-			*recordedJobStatus)
-		return
-	}
-
 	// Get Flink job status list.
 	var jobList = &flinkclient.JobStatusList{}
 	var err = observer.flinkClient.GetJobStatusList(
-		getFlinkAPIBaseURL(observed.cluster), jobList)
+		observer.context, observed.flinkAPIBaseURL, jobList)
 	if err != nil {
 		// It is normal in many cases, not an error.
 		log.Info("Failed to get Flink job status list.", "error", err)
@@ -232,7 +415,7 @@ func (observer *ClusterStateObserver) observeFlinkJobs(
 
 	// Extract Flink job ID.
 	if jobList != nil {
-		var jobs = jobList.Jobs
+		var jobs = getActiveFlinkJobs(jobList.Jobs)
 		var jobCount = len(jobs)
 		log.Info("Observed Flink job status list", "jobs", jobs)
 		if jobCount > 1 {
@@ -245,6 +428,103 @@ func (observer *ClusterStateObserver) observeFlinkJobs(
 			log.Info("Observed Flink job ID", "ID", observed.flinkJobID)
 		}
 	}
+
+	// Get the details of the active job, or of the recorded job which may have
+	// ended.
+	var jobID string
+	if observed.flinkJobID != nil {
+		jobID = *observed.flinkJobID
+	} else if recordedJobStatus != nil {
+		jobID = recordedJobStatus.ID
+	}
+	if len(jobID) == 0 {
+		return
+	}
+	observer.observeFlinkJobDetails(observed, jobID)
+}
+
+// Observes the details, the exceptions, the checkpoint statistics and the
+// restart count of the Flink job.
+func (observer *ClusterStateObserver) observeFlinkJobDetails(
+	observed *ObservedClusterState, jobID string) {
+	var log = observer.log.WithValues("jobID", jobID)
+	var apiBaseURL = observed.flinkAPIBaseURL
+
+	var details, err = observer.flinkClient.GetJobDetails(
+		observer.context, apiBaseURL, jobID)
+	if err != nil {
+		log.Info("Failed to get Flink job details.", "error", err)
+		return
+	}
+	log.Info("Observed Flink job details", "details", details)
+	observed.flinkJob = &details
+
+	// The root exception is only observed when the job is failing or has
+	// failed.
+	switch details.State {
+	case "FAILING", "FAILED", "RESTARTING":
+		exceptions, err := observer.flinkClient.GetJobExceptions(
+			observer.context, apiBaseURL, jobID)
+		if err != nil {
+			log.Info("Failed to get Flink job exceptions.", "error", err)
+		} else {
+			observed.flinkJobExceptions = &exceptions
+		}
+	}
+
+	checkpoints, err := observer.flinkClient.GetJobCheckpoints(
+		observer.context, apiBaseURL, jobID)
+	if err != nil {
+		log.Info("Failed to get Flink job checkpoints.", "error", err)
+	} else {
+		observed.flinkJobCheckpoints = &checkpoints
+	}
+
+	// The restart count metric is numRestarts since Flink 1.10 and
+	// fullRestarts before.
+	metrics, err := observer.flinkClient.GetJobMetrics(
+		observer.context, apiBaseURL, jobID, []string{"numRestarts", "fullRestarts"})
+	if err != nil {
+		log.Info("Failed to get Flink job metrics.", "error", err)
+		return
+	}
+	for _, name := range []string{"numRestarts", "fullRestarts"} {
+		if value, ok := metrics[name]; ok {
+			restarts, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				log.Info("Invalid Flink job metric.", name, value)
+				return
+			}
+			var restarts32 = int32(restarts)
+			observed.flinkJobRestarts = &restarts32
+			return
+		}
+	}
+}
+
+// Gets the Flink jobs which are not cancelled, failed or finished. Jobs
+// cancelled or stopped by the operator, e.g., during an upgrade, or failed
+// jobs which the operator restarted, are still in the job list of the cluster.
+func getActiveFlinkJobs(jobs []flinkclient.JobStatus) []flinkclient.JobStatus {
+	var activeJobs = []flinkclient.JobStatus{}
+	for _, job := range jobs {
+		if job.Status != "CANCELED" && job.Status != "FAILED" &&
+			job.Status != "FINISHED" {
+			activeJobs = append(activeJobs, job)
+		}
+	}
+	return activeJobs
+}
+
+func (observer *ClusterStateObserver) observeSavepoint(
+	name string, observedSavepoint *v1alpha1.FlinkSavepoint) error {
+	return observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      name,
+		},
+		observedSavepoint)
 }
 
 func (observer *ClusterStateObserver) observeCluster(
@@ -285,6 +565,62 @@ func (observer *ClusterStateObserver) observeTaskManagerDeployment(
 		clusterNamespace, tmDeploymentName, "TaskManager", observedDeployment)
 }
 
+func (observer *ClusterStateObserver) observeHAResources(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	var serviceAccount = new(corev1.ServiceAccount)
+	var found, err = observer.observeHAResource(serviceAccount)
+	if err != nil {
+		log.Error(err, "Failed to get HA service account")
+		return err
+	}
+	if found {
+		observed.haServiceAccount = serviceAccount
+	}
+	log.Info("Observed HA service account", "state", observed.haServiceAccount)
+
+	var role = new(rbacv1.Role)
+	found, err = observer.observeHAResource(role)
+	if err != nil {
+		log.Error(err, "Failed to get HA role")
+		return err
+	}
+	if found {
+		observed.haRole = role
+	}
+	log.Info("Observed HA role", "state", observed.haRole)
+
+	var roleBinding = new(rbacv1.RoleBinding)
+	found, err = observer.observeHAResource(roleBinding)
+	if err != nil {
+		log.Error(err, "Failed to get HA role binding")
+		return err
+	}
+	if found {
+		observed.haRoleBinding = roleBinding
+	}
+	log.Info("Observed HA role binding", "state", observed.haRoleBinding)
+
+	return nil
+}
+
+// Gets the HA resource of the given type, returns false if it is not found.
+func (observer *ClusterStateObserver) observeHAResource(
+	resource runtime.Object) (bool, error) {
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      getHAServiceAccountName(observer.request.Name),
+		},
+		resource)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return true, nil
+}
+
 func (observer *ClusterStateObserver) observeDeployment(
 	namespace string,
 	name string,
@@ -322,6 +658,75 @@ func (observer *ClusterStateObserver) observeJobManagerService(
 		observedService)
 }
 
+func (observer *ClusterStateObserver) observeJobManagerHeadlessService(
+	observedService *corev1.Service) error {
+	var clusterNamespace = observer.request.Namespace
+	var clusterName = observer.request.Name
+
+	return observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: clusterNamespace,
+			Name:      getJobManagerHeadlessServiceName(clusterName),
+		},
+		observedService)
+}
+
+func (observer *ClusterStateObserver) observeTaskManagerHeadlessService(
+	observedService *corev1.Service) error {
+	var clusterNamespace = observer.request.Namespace
+	var clusterName = observer.request.Name
+
+	return observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: clusterNamespace,
+			Name:      getTaskManagerHeadlessServiceName(clusterName),
+		},
+		observedService)
+}
+
+func (observer *ClusterStateObserver) observeJobManagerStatefulSet(
+	observedStatefulSet *appsv1.StatefulSet) error {
+	var clusterNamespace = observer.request.Namespace
+	var clusterName = observer.request.Name
+	var jmStatefulSetName = getJobManagerStatefulSetName(clusterName)
+	return observer.observeStatefulSet(
+		clusterNamespace, jmStatefulSetName, "JobManager", observedStatefulSet)
+}
+
+func (observer *ClusterStateObserver) observeTaskManagerStatefulSet(
+	observedStatefulSet *appsv1.StatefulSet) error {
+	var clusterNamespace = observer.request.Namespace
+	var clusterName = observer.request.Name
+	var tmStatefulSetName = getTaskManagerStatefulSetName(clusterName)
+	return observer.observeStatefulSet(
+		clusterNamespace, tmStatefulSetName, "TaskManager", observedStatefulSet)
+}
+
+func (observer *ClusterStateObserver) observeStatefulSet(
+	namespace string,
+	name string,
+	component string,
+	observedStatefulSet *appsv1.StatefulSet) error {
+	var log = observer.log.WithValues("component", component)
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: namespace,
+			Name:      name,
+		},
+		observedStatefulSet)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get StatefulSet")
+		} else {
+			log.Info("StatefulSet not found")
+		}
+	}
+	return err
+}
+
 func (observer *ClusterStateObserver) observeJobManagerIngress(
 	observedIngress *extensionsv1beta1.Ingress) error {
 	var clusterNamespace = observer.request.Namespace
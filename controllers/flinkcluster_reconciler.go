@@ -18,16 +18,26 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
 	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"github.com/googlecloudplatform/flink-operator/controllers/jarstorage"
+	"github.com/googlecloudplatform/flink-operator/controllers/savepointstorage"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -35,12 +45,19 @@ import (
 // ClusterReconciler takes actions to drive the observed state towards the
 // desired state.
 type ClusterReconciler struct {
-	k8sClient   client.Client
-	flinkClient flinkclient.FlinkClient
-	context     context.Context
-	log         logr.Logger
-	observed    ObservedClusterState
-	desired     DesiredClusterState
+	k8sClient        client.Client
+	flinkClient      flinkclient.FlinkClient
+	savepointStorage *savepointstorage.Registry
+	jarStorage       *jarstorage.Registry
+	context          context.Context
+	log              logr.Logger
+	recorder         record.EventRecorder
+	observed         ObservedClusterState
+	desired          DesiredClusterState
+
+	// The savepoints which have expired from the savepoint history, they are
+	// deleted after the new history has been stored in the job status.
+	expiredSavepoints []string
 }
 
 // Compares the desired state and the observed state, if there is a difference,
@@ -54,6 +71,23 @@ func (reconciler *ClusterReconciler) reconcile() (ctrl.Result, error) {
 		return ctrl.Result{}, nil
 	}
 
+	// Stop the job with a final savepoint before the cluster is deleted.
+	if !reconciler.observed.cluster.ObjectMeta.DeletionTimestamp.IsZero() {
+		return reconciler.reconcileClusterDeletion()
+	}
+	if reconciler.observed.cluster.Spec.Job != nil &&
+		!hasFinalizer(
+			reconciler.observed.cluster.ObjectMeta.Finalizers,
+			finalSavepointFinalizer) {
+		err = reconciler.addFinalizer()
+		return ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}, err
+	}
+
+	err = reconciler.reconcileHAResources()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	err = reconciler.reconcileConfigMap()
 	if err != nil {
 		return ctrl.Result{}, err
@@ -64,11 +98,21 @@ func (reconciler *ClusterReconciler) reconcile() (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
+	err = reconciler.reconcileJobManagerStatefulSet()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	err = reconciler.reconcileJobManagerService()
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	err = reconciler.reconcileJobManagerHeadlessService()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	err = reconciler.reconcileJobManagerIngress()
 	if err != nil {
 		return ctrl.Result{}, err
@@ -79,6 +123,16 @@ func (reconciler *ClusterReconciler) reconcile() (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
+	err = reconciler.reconcileTaskManagerStatefulSet()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileTaskManagerHeadlessService()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	result, err := reconciler.reconcileJob()
 
 	return result, nil
@@ -109,9 +163,14 @@ func (reconciler *ClusterReconciler) reconcileDeployment(
 	}
 
 	if desiredDeployment != nil && observedDeployment != nil {
+		if isDeploymentUpdateNeeded(desiredDeployment, observedDeployment) {
+			var updated = observedDeployment.DeepCopy()
+			mergeObjectMeta(&desiredDeployment.ObjectMeta, &updated.ObjectMeta)
+			updated.Spec = desiredDeployment.Spec
+			return reconciler.updateDeployment(updated, component)
+		}
 		log.Info("Deployment already exists, no action")
 		return nil
-		// TODO(dagang): compare and update if needed.
 	}
 
 	if desiredDeployment == nil && observedDeployment != nil {
@@ -149,6 +208,7 @@ func (reconciler *ClusterReconciler) updateDeployment(
 		log.Error(err, "Failed to update deployment")
 	} else {
 		log.Info("Deployment updated")
+		reconciler.createComponentUpdateEvent(component + " deployment")
 	}
 	return err
 }
@@ -170,6 +230,102 @@ func (reconciler *ClusterReconciler) deleteDeployment(
 	return err
 }
 
+func (reconciler *ClusterReconciler) reconcileJobManagerStatefulSet() error {
+	return reconciler.reconcileStatefulSet(
+		"JobManager",
+		reconciler.desired.JmStatefulSet,
+		reconciler.observed.jmStatefulSet)
+}
+
+func (reconciler *ClusterReconciler) reconcileTaskManagerStatefulSet() error {
+	return reconciler.reconcileStatefulSet(
+		"TaskManager",
+		reconciler.desired.TmStatefulSet,
+		reconciler.observed.tmStatefulSet)
+}
+
+func (reconciler *ClusterReconciler) reconcileStatefulSet(
+	component string,
+	desiredStatefulSet *appsv1.StatefulSet,
+	observedStatefulSet *appsv1.StatefulSet) error {
+	var log = reconciler.log.WithValues("component", component)
+
+	if desiredStatefulSet != nil && observedStatefulSet == nil {
+		return reconciler.createStatefulSet(desiredStatefulSet, component)
+	}
+
+	if desiredStatefulSet != nil && observedStatefulSet != nil {
+		if isStatefulSetUpdateNeeded(desiredStatefulSet, observedStatefulSet) {
+			var updated = observedStatefulSet.DeepCopy()
+			mergeObjectMeta(&desiredStatefulSet.ObjectMeta, &updated.ObjectMeta)
+			updated.Spec = desiredStatefulSet.Spec
+			// The volume claim templates cannot be updated, the observed ones
+			// are kept with the defaults set by the API server.
+			updated.Spec.VolumeClaimTemplates =
+				observedStatefulSet.Spec.VolumeClaimTemplates
+			return reconciler.updateStatefulSet(updated, component)
+		}
+		log.Info("StatefulSet already exists, no action")
+		return nil
+	}
+
+	if desiredStatefulSet == nil && observedStatefulSet != nil {
+		return reconciler.deleteStatefulSet(observedStatefulSet, component)
+	}
+
+	return nil
+}
+
+func (reconciler *ClusterReconciler) createStatefulSet(
+	statefulSet *appsv1.StatefulSet, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Creating StatefulSet", "StatefulSet", *statefulSet)
+	var err = k8sClient.Create(context, statefulSet)
+	if err != nil {
+		log.Error(err, "Failed to create StatefulSet")
+	} else {
+		log.Info("StatefulSet created")
+	}
+	return err
+}
+
+func (reconciler *ClusterReconciler) updateStatefulSet(
+	statefulSet *appsv1.StatefulSet, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Updating StatefulSet", "StatefulSet", statefulSet)
+	var err = k8sClient.Update(context, statefulSet)
+	if err != nil {
+		log.Error(err, "Failed to update StatefulSet")
+	} else {
+		log.Info("StatefulSet updated")
+		reconciler.createComponentUpdateEvent(component + " StatefulSet")
+	}
+	return err
+}
+
+func (reconciler *ClusterReconciler) deleteStatefulSet(
+	statefulSet *appsv1.StatefulSet, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Deleting StatefulSet", "StatefulSet", statefulSet)
+	var err = k8sClient.Delete(context, statefulSet)
+	err = client.IgnoreNotFound(err)
+	if err != nil {
+		log.Error(err, "Failed to delete StatefulSet")
+	} else {
+		log.Info("StatefulSet deleted")
+	}
+	return err
+}
+
 func (reconciler *ClusterReconciler) reconcileJobManagerService() error {
 	var desiredJmService = reconciler.desired.JmService
 	var observedJmService = reconciler.observed.jmService
@@ -179,14 +335,87 @@ func (reconciler *ClusterReconciler) reconcileJobManagerService() error {
 	}
 
 	if desiredJmService != nil && observedJmService != nil {
+		if isServiceUpdateNeeded(desiredJmService, observedJmService) {
+			var updated = observedJmService.DeepCopy()
+			mergeObjectMeta(&desiredJmService.ObjectMeta, &updated.ObjectMeta)
+			// The annotation is only for internal load balancers.
+			if _, ok := desiredJmService.Annotations[internalLoadBalancerAnnotation]; !ok {
+				delete(updated.Annotations, internalLoadBalancerAnnotation)
+			}
+			updated.Spec.Type = desiredJmService.Spec.Type
+			updated.Spec.Selector = desiredJmService.Spec.Selector
+			updated.Spec.Ports = mergeServicePorts(
+				desiredJmService.Spec.Ports,
+				observedJmService.Spec.Ports,
+				desiredJmService.Spec.Type)
+			return reconciler.updateService(updated, "JobManager")
+		}
 		reconciler.log.Info("JobManager service already exists, no action")
 		return nil
-		// TODO(dagang): compare and update if needed.
 	}
 
 	if desiredJmService == nil && observedJmService != nil {
 		return reconciler.deleteService(observedJmService, "JobManager")
-		// TODO(dagang): compare and update if needed.
+	}
+
+	return nil
+}
+
+func (reconciler *ClusterReconciler) reconcileJobManagerHeadlessService() error {
+	var desiredService = reconciler.desired.JmHeadlessService
+	var observedService = reconciler.observed.jmHeadlessService
+	var component = "JobManager headless"
+
+	if desiredService != nil && observedService == nil {
+		return reconciler.createService(desiredService, component)
+	}
+
+	if desiredService != nil && observedService != nil {
+		if isServiceUpdateNeeded(desiredService, observedService) {
+			var updated = observedService.DeepCopy()
+			mergeObjectMeta(&desiredService.ObjectMeta, &updated.ObjectMeta)
+			updated.Spec.Selector = desiredService.Spec.Selector
+			updated.Spec.Ports = desiredService.Spec.Ports
+			updated.Spec.PublishNotReadyAddresses =
+				desiredService.Spec.PublishNotReadyAddresses
+			return reconciler.updateService(updated, component)
+		}
+		reconciler.log.Info(
+			"JobManager headless service already exists, no action")
+		return nil
+	}
+
+	if desiredService == nil && observedService != nil {
+		return reconciler.deleteService(observedService, component)
+	}
+
+	return nil
+}
+
+func (reconciler *ClusterReconciler) reconcileTaskManagerHeadlessService() error {
+	var desiredService = reconciler.desired.TmHeadlessService
+	var observedService = reconciler.observed.tmHeadlessService
+	var component = "TaskManager headless"
+
+	if desiredService != nil && observedService == nil {
+		return reconciler.createService(desiredService, component)
+	}
+
+	if desiredService != nil && observedService != nil {
+		if isServiceUpdateNeeded(desiredService, observedService) {
+			var updated = observedService.DeepCopy()
+			mergeObjectMeta(&desiredService.ObjectMeta, &updated.ObjectMeta)
+			updated.Spec.Selector = desiredService.Spec.Selector
+			updated.Spec.Ports = desiredService.Spec.Ports
+			return reconciler.updateService(updated, component)
+		}
+		reconciler.log.Info(
+			"TaskManager headless service already exists, no action")
+		return nil
+	}
+
+	if desiredService == nil && observedService != nil {
+		return reconciler.deleteService(observedService, component)
 	}
 
 	return nil
@@ -208,6 +437,23 @@ func (reconciler *ClusterReconciler) createService(
 	return err
 }
 
+func (reconciler *ClusterReconciler) updateService(
+	service *corev1.Service, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Updating service", "service", service)
+	var err = k8sClient.Update(context, service)
+	if err != nil {
+		log.Error(err, "Failed to update service")
+	} else {
+		log.Info("Service updated")
+		reconciler.createComponentUpdateEvent(component + " service")
+	}
+	return err
+}
+
 func (reconciler *ClusterReconciler) deleteService(
 	service *corev1.Service, component string) error {
 	var context = reconciler.context
@@ -234,9 +480,14 @@ func (reconciler *ClusterReconciler) reconcileJobManagerIngress() error {
 	}
 
 	if desiredJmIngress != nil && observedJmIngress != nil {
+		if isIngressUpdateNeeded(desiredJmIngress, observedJmIngress) {
+			var updated = observedJmIngress.DeepCopy()
+			mergeObjectMeta(&desiredJmIngress.ObjectMeta, &updated.ObjectMeta)
+			updated.Spec = desiredJmIngress.Spec
+			return reconciler.updateIngress(updated, "JobManager")
+		}
 		reconciler.log.Info("JobManager ingress already exists, no action")
 		return nil
-		// TODO: compare and update if needed.
 	}
 
 	if desiredJmIngress == nil && observedJmIngress != nil {
@@ -262,6 +513,23 @@ func (reconciler *ClusterReconciler) createIngress(
 	return err
 }
 
+func (reconciler *ClusterReconciler) updateIngress(
+	ingress *extensionsv1beta1.Ingress, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Updating ingress", "ingress", ingress)
+	var err = k8sClient.Update(context, ingress)
+	if err != nil {
+		log.Error(err, "Failed to update ingress")
+	} else {
+		log.Info("Ingress updated")
+		reconciler.createComponentUpdateEvent(component + " ingress")
+	}
+	return err
+}
+
 func (reconciler *ClusterReconciler) deleteIngress(
 	ingress *extensionsv1beta1.Ingress, component string) error {
 	var context = reconciler.context
@@ -288,9 +556,14 @@ func (reconciler *ClusterReconciler) reconcileConfigMap() error {
 	}
 
 	if desiredConfigMap != nil && observedConfigMap != nil {
+		if isConfigMapUpdateNeeded(desiredConfigMap, observedConfigMap) {
+			var updated = observedConfigMap.DeepCopy()
+			mergeObjectMeta(&desiredConfigMap.ObjectMeta, &updated.ObjectMeta)
+			updated.Data = desiredConfigMap.Data
+			return reconciler.updateConfigMap(updated, "ConfigMap")
+		}
 		reconciler.log.Info("ConfigMap already exists, no action")
 		return nil
-		// TODO: compare and update if needed.
 	}
 
 	if desiredConfigMap == nil && observedConfigMap != nil {
@@ -316,6 +589,23 @@ func (reconciler *ClusterReconciler) createConfigMap(
 	return err
 }
 
+func (reconciler *ClusterReconciler) updateConfigMap(
+	cm *corev1.ConfigMap, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Updating configMap", "configMap", cm)
+	var err = k8sClient.Update(context, cm)
+	if err != nil {
+		log.Error(err, "Failed to update configMap")
+	} else {
+		log.Info("ConfigMap updated")
+		reconciler.createComponentUpdateEvent(component)
+	}
+	return err
+}
+
 func (reconciler *ClusterReconciler) deleteConfigMap(
 	cm *corev1.ConfigMap, component string) error {
 	var context = reconciler.context
@@ -333,19 +623,135 @@ func (reconciler *ClusterReconciler) deleteConfigMap(
 	return err
 }
 
+// Creates or deletes the service account, role and role binding of the
+// Kubernetes HA services. They don't depend on the rest of the spec, so they
+// are never updated.
+func (reconciler *ClusterReconciler) reconcileHAResources() error {
+	var desired = reconciler.desired
+	var observed = reconciler.observed
+	var err = reconciler.reconcileHAResource(
+		"HAServiceAccount",
+		desired.HAServiceAccount != nil,
+		observed.haServiceAccount != nil,
+		desired.HAServiceAccount,
+		observed.haServiceAccount)
+	if err != nil {
+		return err
+	}
+	err = reconciler.reconcileHAResource(
+		"HARole",
+		desired.HARole != nil,
+		observed.haRole != nil,
+		desired.HARole,
+		observed.haRole)
+	if err != nil {
+		return err
+	}
+	return reconciler.reconcileHAResource(
+		"HARoleBinding",
+		desired.HARoleBinding != nil,
+		observed.haRoleBinding != nil,
+		desired.HARoleBinding,
+		observed.haRoleBinding)
+}
+
+func (reconciler *ClusterReconciler) reconcileHAResource(
+	component string,
+	isDesired bool,
+	isObserved bool,
+	desired runtime.Object,
+	observed runtime.Object) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+	var err error
+
+	if isDesired && !isObserved {
+		log.Info("Creating HA resource", "resource", desired)
+		err = k8sClient.Create(context, desired)
+		if err != nil {
+			log.Info("Failed to create HA resource", "error", err)
+		} else {
+			log.Info("HA resource created")
+		}
+		return err
+	}
+
+	if !isDesired && isObserved {
+		log.Info("Deleting HA resource", "resource", observed)
+		err = client.IgnoreNotFound(k8sClient.Delete(context, observed))
+		if err != nil {
+			log.Error(err, "Failed to delete HA resource")
+		} else {
+			log.Info("HA resource deleted")
+		}
+		return err
+	}
+
+	return nil
+}
+
 func (reconciler *ClusterReconciler) reconcileJob() (ctrl.Result, error) {
 	var log = reconciler.log
 	var desiredJob = reconciler.desired.Job
 	var observed = reconciler.observed
 	var observedJob = observed.job
+	var jobStatus = observed.cluster.Status.Components.Job
+
+	// The job submitted through the Flink REST API has no job submitter, it is
+	// tracked by the job status instead. A stopped job is submitted again when
+	// it is added back to the spec.
+	var restSubmission = desiredJob != nil &&
+		observed.cluster.Spec.Job.IsRESTSubmission()
+	var jobSubmitted = observedJob != nil
+	if restSubmission {
+		jobSubmitted = jobStatus != nil &&
+			jobStatus.StopPhase != v1alpha1.JobStopPhase.Stopped
+	}
+
+	// Restart
+	if desiredJob != nil && jobStatus != nil &&
+		len(jobStatus.NextRestartTime) > 0 {
+		if restSubmission {
+			return reconciler.restartJobViaREST()
+		}
+		return reconciler.restartJob(desiredJob, observedJob)
+	}
+
+	// Upgrade
+	if desiredJob != nil {
+		if jobStatus != nil && len(jobStatus.UpgradePhase) > 0 {
+			return reconciler.upgradeJob(desiredJob, observedJob)
+		}
+		if reconciler.isJobSpecChanged(desiredJob, observedJob) {
+			if reconciler.isJobRunning() {
+				return reconciler.startJobUpgrade(
+					observed.cluster.Status.Components.Job.DeepCopy(),
+					"Job spec changed, taking savepoint before upgrading the job")
+			}
+			log.Info("Skip upgrading job, job is not running")
+		}
+	}
 
 	// Create
-	if desiredJob != nil && observedJob == nil {
+	if desiredJob != nil && !jobSubmitted {
+		if reconciler.isSavepointRefPending() {
+			log.Info(
+				"Skip creating job, waiting for the FlinkSavepoint to succeed",
+				"savepoint",
+				observed.cluster.Spec.Job.SavepointRef.Name)
+			return ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}, nil
+		}
 		// If the observed Flink job status list is not nil (e.g., emtpy list), it
 		// means Flink REST API server is up and running. It is the source of
 		// truth of whether we can submit a job.
 		if reconciler.observed.flinkJobList != nil {
-			var err = reconciler.createJob(desiredJob)
+			var err error
+			if restSubmission {
+				err = reconciler.submitJobViaREST()
+			} else {
+				err = reconciler.createJob(desiredJob)
+			}
 			return ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}, err
 		}
 		log.Info("Skip creating job, waiting for Flink API to be ready")
@@ -353,23 +759,48 @@ func (reconciler *ClusterReconciler) reconcileJob() (ctrl.Result, error) {
 	}
 
 	// Update
-	if desiredJob != nil && observedJob != nil {
+	if desiredJob != nil && jobSubmitted {
+		if jobStatus != nil && jobStatus.State == v1alpha1.JobState.Failed &&
+			canRestartJob(observed.cluster) {
+			return reconciler.startJobRestart()
+		}
+
+		// Rescale
+		if reconciler.isRescaleInProgress() {
+			return reconciler.updateRescaleProgress()
+		}
+		if reconciler.isRescaleNeeded() && !reconciler.isSavepointInProgress() {
+			if reconciler.canRescaleJob() {
+				return reconciler.rescaleJob()
+			}
+			if !reconciler.isRescalePendingRecorded() {
+				return reconciler.setRescalePending()
+			}
+		}
+
 		var jobID = reconciler.getFlinkJobID()
-		if reconciler.shouldTakeSavepoint() {
+		var err error
+		if reconciler.isSavepointInProgress() {
+			log.Info("Checking savepoint.", "jobID", jobID)
+			err = reconciler.updateSavepointProgress()
+		} else if reconciler.shouldTakeSavepoint() {
 			log.Info("Taking savepoint.", "jobID", jobID)
-			var savepointStatus, err = reconciler.takeSavepoint(jobID)
-			if savepointStatus.Completed && err == nil {
-				err = reconciler.updateSavepointStatus(savepointStatus)
-				if err != nil {
-					log.Error(
-						err, "Failed to update savepoint status.", "error", err)
-				}
-			} else {
-				log.Info("Failed to take savepoint.", "jobID", jobID)
+			var savepointType = v1alpha1.SavepointType.Periodic
+			if observed.cluster.Spec.Job.SavepointGeneration >
+				jobStatus.SavepointGeneration {
+				savepointType = v1alpha1.SavepointType.Manual
 			}
+			err = reconciler.triggerSavepoint(
+				jobStatus.DeepCopy(),
+				*observed.cluster.Spec.Job.SavepointsDir,
+				savepointType,
+				false /* cancel */)
 		} else {
 			log.Info("Skip taking savepoint.", "jobID", jobID)
 		}
+		if err != nil {
+			log.Error(err, "Failed to take savepoint.", "jobID", jobID)
+		}
 
 		if !reconciler.isJobFinished() {
 			return ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}, nil
@@ -380,9 +811,15 @@ func (reconciler *ClusterReconciler) reconcileJob() (ctrl.Result, error) {
 	}
 
 	// Delete
-	// TODO: take savepoint before deleting.
-	if desiredJob == nil && observedJob != nil {
-		reconciler.deleteJob(observedJob)
+	if desiredJob == nil && (observedJob != nil ||
+		reconciler.isJobStopping() || reconciler.isJobRunning()) {
+		var stopped, err = reconciler.stopJobWithFinalSavepoint()
+		if err != nil || !stopped {
+			return ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}, err
+		}
+		if observedJob != nil {
+			reconciler.deleteJob(observedJob)
+		}
 		return ctrl.Result{}, nil
 	}
 
@@ -404,13 +841,103 @@ func (reconciler *ClusterReconciler) createJob(job *batchv1.Job) error {
 	return err
 }
 
+// Submits the job through the Flink REST API instead of a job submitter, the
+// ID of the Flink job is recorded in the job status right away.
+func (reconciler *ClusterReconciler) submitJobViaREST() error {
+	var jobStatus = &v1alpha1.JobStatus{}
+	var submitErr = reconciler.runJobViaREST(jobStatus)
+	var err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.createJobSubmitEvent(jobStatus, submitErr)
+	}
+	return err
+}
+
+// Uploads the JAR file of the job and runs it through the Flink REST API. The
+// ID of the Flink job is recorded in the job status, or the job fails if it
+// cannot be submitted, e.g., the JAR file is not found or its main method
+// throws an exception. Returns the error of the submission.
+//
+// The job may have been submitted by an earlier reconcile which failed to
+// record it, e.g., the update of the job status conflicted. The cluster runs
+// a single job, so an active job of the cluster is adopted instead of
+// submitting the job again.
+func (reconciler *ClusterReconciler) runJobViaREST(
+	jobStatus *v1alpha1.JobStatus) error {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	var jobSpec = cluster.Spec.Job
+	var apiBaseURL = reconciler.observed.flinkAPIBaseURL
+	var fromSavepoint = getFromSavepoint(&reconciler.observed)
+	var tc = &TimeConverter{}
+
+	var jobID string
+	var err error
+	var activeJobs = getActiveFlinkJobs(reconciler.observed.flinkJobList.Jobs)
+	switch {
+	case len(activeJobs) > 1:
+		err = fmt.Errorf("the cluster has %v active jobs", len(activeJobs))
+	case len(activeJobs) == 1:
+		jobID = activeJobs[0].ID
+		log.Info("Adopting the active job", "jobID", jobID)
+	default:
+		jobID, err = submitJar(
+			reconciler.context,
+			reconciler.flinkClient,
+			reconciler.jarStorage,
+			apiBaseURL,
+			jobSpec.JarFile,
+			getJarRunRequest(jobSpec, fromSavepoint),
+			log)
+	}
+	if err != nil {
+		log.Info("Failed to submit job", "error", err)
+		jobStatus.State = v1alpha1.JobState.Failed
+		jobStatus.FailureReason = truncateFailureReason(
+			fmt.Sprintf("Failed to submit job: %v", err))
+		jobStatus.FailureTime = tc.ToString(time.Now())
+		return err
+	}
+	log.Info("Job submitted", "jobID", jobID)
+	jobStatus.ID = jobID
+	jobStatus.State = v1alpha1.JobState.Pending
+	jobStatus.FromSavepoint = fromSavepoint
+	jobStatus.SubmittedSpecHash = getJobSpecHash(jobSpec)
+	if jobSpec.Parallelism != nil {
+		jobStatus.Parallelism = *jobSpec.Parallelism
+	}
+	return nil
+}
+
+func (reconciler *ClusterReconciler) createJobSubmitEvent(
+	jobStatus *v1alpha1.JobStatus, submitErr error) {
+	var cluster = reconciler.observed.cluster
+	if submitErr != nil {
+		reconciler.recorder.Event(
+			cluster,
+			"Warning",
+			"JobSubmit",
+			truncateFailureReason(
+				fmt.Sprintf("Failed to submit job: %v", submitErr)))
+		return
+	}
+	reconciler.recorder.Event(
+		cluster,
+		"Normal",
+		"JobSubmit",
+		fmt.Sprintf("Job %v submitted", jobStatus.ID))
+}
+
 func (reconciler *ClusterReconciler) deleteJob(job *batchv1.Job) error {
 	var context = reconciler.context
 	var log = reconciler.log
 	var k8sClient = reconciler.k8sClient
 
 	log.Info("Deleting job", "job", job)
-	var err = k8sClient.Delete(context, job)
+	var err = k8sClient.Delete(
+		context,
+		job,
+		client.PropagationPolicy(metav1.DeletePropagationBackground))
 	err = client.IgnoreNotFound(err)
 	if err != nil {
 		log.Error(err, "Failed to delete job")
@@ -420,80 +947,1286 @@ func (reconciler *ClusterReconciler) deleteJob(job *batchv1.Job) error {
 	return err
 }
 
-func (reconciler *ClusterReconciler) getFlinkJobID() string {
-	var jobStatus = reconciler.observed.cluster.Status.Components.Job
-	if jobStatus != nil && len(jobStatus.ID) > 0 {
-		return jobStatus.ID
+// Starts a stateful upgrade of the job when the job spec has changed, or when
+// the job cannot be rescaled through the Flink rescale API. The upgrade is
+// driven by the phase recorded in the job status, so that it can be resumed if
+// the operator restarts in the middle of it.
+func (reconciler *ClusterReconciler) startJobUpgrade(
+	jobStatus *v1alpha1.JobStatus, message string) (ctrl.Result, error) {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+
+	if cluster.Spec.Job.SavepointsDir == nil {
+		log.Info("Skip upgrading job, savepointsDir is not specified")
+		reconciler.recorder.Event(
+			cluster,
+			"Warning",
+			"JobUpgrade",
+			"Job spec changed, but the job cannot be upgraded without savepointsDir")
+		return ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}, nil
 	}
-	return ""
+
+	log.Info("Starting job upgrade", "jobID", reconciler.getFlinkJobID())
+	jobStatus.UpgradePhase = v1alpha1.JobUpgradePhase.TakingSavepoint
+	// The job is resubmitted with the parallelism of the job spec.
+	resetRescaleStatus(jobStatus)
+	// The savepoint in progress doesn't cancel the job, take a new one.
+	if jobStatus.LastSavepointState == v1alpha1.SavepointState.InProgress {
+		jobStatus.LastSavepointState = ""
+	}
+	var err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.createJobUpgradeEvent(message)
+	}
+	return ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}, err
 }
 
-func (reconciler *ClusterReconciler) shouldTakeSavepoint() bool {
-	var jobSpec = reconciler.observed.cluster.Spec.Job
-	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+// Drives the ongoing job upgrade to the next phase.
+func (reconciler *ClusterReconciler) upgradeJob(
+	desiredJob *batchv1.Job, observedJob *batchv1.Job) (ctrl.Result, error) {
+	var requeueResult = ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}
+	var err error
 
-	// Not enabled.
-	if jobSpec.AutoSavepointSeconds == nil || jobSpec.SavepointsDir == nil {
-		return false
+	switch reconciler.observed.cluster.Status.Components.Job.UpgradePhase {
+	case v1alpha1.JobUpgradePhase.TakingSavepoint:
+		// The job submitter is deleted before the Flink job is cancelled,
+		// otherwise it would fail and be restarted, which resubmits the job
+		// without the savepoint.
+		if observedJob != nil {
+			err = reconciler.deleteJob(observedJob)
+			return requeueResult, err
+		}
+		err = reconciler.takeUpgradeSavepoint()
+	case v1alpha1.JobUpgradePhase.Resubmitting:
+		err = reconciler.resubmitJob(desiredJob, observedJob)
+	default:
+		reconciler.log.Info(
+			"Unknown job upgrade phase",
+			"phase",
+			reconciler.observed.cluster.Status.Components.Job.UpgradePhase)
+		return ctrl.Result{}, nil
 	}
+	return requeueResult, err
+}
 
-	// Job is not running yet.
-	var flinkJobID = reconciler.getFlinkJobID()
-	if len(flinkJobID) == 0 {
-		return false
+// Triggers a savepoint which cancels the job when it completes, then tracks
+// the savepoint until it completes.
+func (reconciler *ClusterReconciler) takeUpgradeSavepoint() error {
+	var cluster = reconciler.observed.cluster
+	var jobStatus = cluster.Status.Components.Job.DeepCopy()
+
+	if jobStatus.LastSavepointState != v1alpha1.SavepointState.InProgress {
+		return reconciler.triggerSavepoint(
+			jobStatus,
+			*cluster.Spec.Job.SavepointsDir,
+			v1alpha1.SavepointType.Upgrade,
+			true /* cancel */)
 	}
 
-	// Job has finished.
-	if reconciler.isJobFinished() {
-		return false
+	var completed, err = reconciler.checkSavepoint(jobStatus)
+	if err != nil || !completed {
+		return err
 	}
-
-	// First savepoint.
-	if len(jobStatus.LastSavepointTime) == 0 {
-		return true
+	// Retry with a new savepoint if it failed.
+	if jobStatus.LastSavepointState == v1alpha1.SavepointState.Failed {
+		return reconciler.updateJobStatus(*jobStatus)
 	}
 
-	// Interval expired.
-	var tc = &TimeConverter{}
-	var lastTime = tc.FromString(jobStatus.LastSavepointTime)
-	var nextTime = lastTime.Add(
-		time.Duration(int64(*jobSpec.AutoSavepointSeconds) * int64(time.Second)))
-	return time.Now().After(nextTime)
+	jobStatus.FromSavepoint = jobStatus.SavepointLocation
+	// The job submitted through the Flink REST API keeps the ID of the
+	// cancelled job until it is resubmitted, so that it is resubmitted only
+	// after the cancelled job has ended.
+	if !cluster.Spec.Job.IsRESTSubmission() {
+		jobStatus.ID = ""
+	}
+	// The resubmitted job runs with the parallelism of the new job submitter.
+	jobStatus.Parallelism = 0
+	jobStatus.UpgradePhase = v1alpha1.JobUpgradePhase.Resubmitting
+	err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.createJobUpgradeEvent(fmt.Sprintf(
+			"Job cancelled with savepoint %v, resubmitting the job",
+			jobStatus.SavepointLocation))
+	}
+	return err
 }
 
-// Takes savepoint for a job.
-func (reconciler *ClusterReconciler) takeSavepoint(jobID string) (
-	flinkclient.SavepointStatus, error) {
-	var log = reconciler.log
-	var apiBaseURL = getFlinkAPIBaseURL(reconciler.observed.cluster)
-	var status, err = reconciler.flinkClient.TakeSavepoint(
-		apiBaseURL, jobID, *reconciler.observed.cluster.Spec.Job.SavepointsDir)
-	log.Info(
-		"Savepoint status.",
-		"status", status,
-		"error", err)
-	if err == nil && len(status.FailureCause.StackTrace) > 0 {
-		err = fmt.Errorf("%s", status.FailureCause.StackTrace)
+// Resubmits the job from the savepoint, the upgrade completes when the new
+// job is found in the Flink cluster or has finished.
+func (reconciler *ClusterReconciler) resubmitJob(
+	desiredJob *batchv1.Job, observedJob *batchv1.Job) error {
+	if reconciler.observed.cluster.Spec.Job.IsRESTSubmission() {
+		return reconciler.resubmitJobViaREST()
+	}
+	if observedJob == nil {
+		return reconciler.createJob(desiredJob)
+	}
+	if isJobUpgradeNeeded(desiredJob, observedJob) {
+		reconciler.log.Info("Waiting for the old job to be deleted")
+		return nil
+	}
+	if len(reconciler.getFlinkJobID()) == 0 && !reconciler.isJobFinished() {
+		return nil
 	}
-	return status, err
-}
 
-func (reconciler *ClusterReconciler) isJobFinished() bool {
-	var jobStatus = reconciler.observed.cluster.Status.Components.Job
-	return jobStatus != nil &&
-		(jobStatus.State == v1alpha1.JobState.Succeeded ||
-			jobStatus.State == v1alpha1.JobState.Failed)
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job.DeepCopy()
+	jobStatus.UpgradePhase = ""
+	var err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.createJobUpgradeEvent("Job upgrade completed")
+	}
+	return err
 }
 
-func (reconciler *ClusterReconciler) updateSavepointStatus(
-	savepointStatus flinkclient.SavepointStatus) error {
-	var cluster = v1alpha1.FlinkCluster{}
-	reconciler.observed.cluster.DeepCopyInto(&cluster)
-	cluster.Status = reconciler.observed.cluster.Status
+// Resubmits the job from the savepoint through the Flink REST API once the
+// cancelled job has ended. The upgrade completes once the job is resubmitted,
+// a failed submission fails the job.
+func (reconciler *ClusterReconciler) resubmitJobViaREST() error {
+	var log = reconciler.log
+	var jobList = reconciler.observed.flinkJobList
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job.DeepCopy()
+
+	if jobList == nil {
+		log.Info("Skip resubmitting job, waiting for Flink API to be ready")
+		return nil
+	}
+	for _, job := range getActiveFlinkJobs(jobList.Jobs) {
+		if job.ID == jobStatus.ID {
+			log.Info("Waiting for the cancelled job to end", "jobID", job.ID)
+			return nil
+		}
+	}
+
+	jobStatus.ID = ""
+	var submitErr = reconciler.runJobViaREST(jobStatus)
+	jobStatus.UpgradePhase = ""
+	var err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.createJobSubmitEvent(jobStatus, submitErr)
+		if submitErr == nil {
+			reconciler.createJobUpgradeEvent("Job upgrade completed")
+		}
+	}
+	return err
+}
+
+// Schedules a restart of the failed job from the latest savepoint or retained
+// checkpoint, the job is resubmitted after the backoff. The restart is driven
+// by the next restart time recorded in the job status.
+func (reconciler *ClusterReconciler) startJobRestart() (ctrl.Result, error) {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	var jobStatus = cluster.Status.Components.Job.DeepCopy()
+	var tc = &TimeConverter{}
+
+	var location = getLatestRestorePoint(
+		jobStatus, reconciler.getLatestCheckpoint(jobStatus.ID))
+	if len(location) > 0 {
+		jobStatus.FromSavepoint = location
+	}
+	var backoff = getJobRestartBackoff(jobStatus.RestartCount)
+	jobStatus.ID = ""
+	jobStatus.NextRestartTime = tc.ToString(time.Now().Add(backoff))
+	// The restarted job runs with the parallelism of the job spec, and the
+	// rescaling in progress never completes on the failed job.
+	jobStatus.Parallelism = 0
+	resetRescaleStatus(jobStatus)
+	// The savepoint in progress never completes on the failed job.
+	if jobStatus.LastSavepointState == v1alpha1.SavepointState.InProgress {
+		jobStatus.LastSavepointState = ""
+	}
+
+	log.Info(
+		"Job failed, scheduling restart",
+		"fromSavepoint",
+		jobStatus.FromSavepoint,
+		"nextRestartTime",
+		jobStatus.NextRestartTime)
+	var err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		var message = fmt.Sprintf(
+			"Job failed, restarting it in %v without savepoint", backoff)
+		if len(jobStatus.FromSavepoint) > 0 {
+			message = fmt.Sprintf(
+				"Job failed, restarting it in %v from %v",
+				backoff,
+				jobStatus.FromSavepoint)
+		}
+		reconciler.recorder.Event(cluster, "Warning", "JobRestart", message)
+	}
+	return ctrl.Result{RequeueAfter: backoff, Requeue: true}, err
+}
+
+// Resubmits the failed job after the backoff. The failed job submitter is
+// deleted first, the restart completes when the new job is found in the Flink
+// cluster or has finished.
+func (reconciler *ClusterReconciler) restartJob(
+	desiredJob *batchv1.Job, observedJob *batchv1.Job) (ctrl.Result, error) {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
 	var jobStatus = cluster.Status.Components.Job
-	jobStatus.LastSavepointTriggerID = savepointStatus.TriggerID
-	jobStatus.SavepointLocation = savepointStatus.Location
+	var requeueResult = ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}
+	var tc = &TimeConverter{}
+	var nextRestartTime = tc.FromString(jobStatus.NextRestartTime)
+
+	if observedJob == nil {
+		if reconciler.observed.flinkJobList == nil {
+			log.Info("Skip restarting job, waiting for Flink API to be ready")
+			return requeueResult, nil
+		}
+		return requeueResult, reconciler.createJob(desiredJob)
+	}
+
+	// The failed job is created before the restart is scheduled.
+	if observedJob.ObjectMeta.CreationTimestamp.Time.Before(nextRestartTime) {
+		var backoff = time.Until(nextRestartTime)
+		if backoff > 0 {
+			log.Info(
+				"Waiting for the backoff to restart the job",
+				"nextRestartTime",
+				jobStatus.NextRestartTime)
+			return ctrl.Result{RequeueAfter: backoff, Requeue: true}, nil
+		}
+		return requeueResult, reconciler.deleteJob(observedJob)
+	}
+
+	if len(reconciler.getFlinkJobID()) == 0 && !reconciler.isJobFinished() {
+		return requeueResult, nil
+	}
+
+	return requeueResult, reconciler.completeJobRestart(jobStatus.DeepCopy())
+}
+
+// Resubmits the failed job through the Flink REST API after the backoff. The
+// restart completes once the job is resubmitted, a failed submission fails
+// the job again.
+func (reconciler *ClusterReconciler) restartJobViaREST() (ctrl.Result, error) {
+	var log = reconciler.log
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	var requeueResult = ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}
 	var tc = &TimeConverter{}
+
+	var backoff = time.Until(tc.FromString(jobStatus.NextRestartTime))
+	if backoff > 0 {
+		log.Info(
+			"Waiting for the backoff to restart the job",
+			"nextRestartTime",
+			jobStatus.NextRestartTime)
+		return ctrl.Result{RequeueAfter: backoff, Requeue: true}, nil
+	}
+	if reconciler.observed.flinkJobList == nil {
+		log.Info("Skip restarting job, waiting for Flink API to be ready")
+		return requeueResult, nil
+	}
+
+	var newJobStatus = jobStatus.DeepCopy()
+	var submitErr = reconciler.runJobViaREST(newJobStatus)
+	reconciler.createJobSubmitEvent(newJobStatus, submitErr)
+	return requeueResult, reconciler.completeJobRestart(newJobStatus)
+}
+
+// Records the completed restart of the job in the job status.
+func (reconciler *ClusterReconciler) completeJobRestart(
+	jobStatus *v1alpha1.JobStatus) error {
+	var cluster = reconciler.observed.cluster
+	var tc = &TimeConverter{}
+	jobStatus.RestartCount++
+	jobStatus.LastRestartTime = tc.ToString(time.Now())
+	jobStatus.NextRestartTime = ""
+	var err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.recorder.Event(
+			cluster,
+			"Normal",
+			"JobRestart",
+			fmt.Sprintf(
+				"Job restarted, restarts: %v/%v",
+				jobStatus.RestartCount,
+				getMaxJobRestarts(cluster)))
+	}
+	return err
+}
+
+// Checks whether the running job needs to be rescaled to the parallelism of
+// the job spec.
+func (reconciler *ClusterReconciler) isRescaleNeeded() bool {
+	var jobSpec = reconciler.observed.cluster.Spec.Job
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	if jobSpec.Parallelism == nil || jobStatus == nil ||
+		jobStatus.State != v1alpha1.JobState.Running {
+		return false
+	}
+	var parallelism = reconciler.getJobParallelism()
+	return parallelism > 0 && parallelism != *jobSpec.Parallelism &&
+		jobStatus.SkippedRescaleParallelism != *jobSpec.Parallelism
+}
+
+func (reconciler *ClusterReconciler) isRescaleInProgress() bool {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	return jobStatus != nil && len(jobStatus.RescaleTriggerID) > 0
+}
+
+// Gets the parallelism of the job, i.e., the one recorded in the job status
+// when the job was submitted through the Flink REST API or rescaled, otherwise
+// the one in the args of the job submitter. Zero if it is unknown.
+func (reconciler *ClusterReconciler) getJobParallelism() int32 {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	if jobStatus != nil && jobStatus.Parallelism > 0 {
+		return jobStatus.Parallelism
+	}
+	var observedJob = reconciler.observed.job
+	if observedJob == nil {
+		return 0
+	}
+	var parallelism, err = strconv.ParseInt(
+		getJobArg(observedJob, "--parallelism"), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(parallelism)
+}
+
+// Checks whether the job can be rescaled, i.e., the available TaskManagers
+// have enough task slots for the new parallelism when it is rescaled up.
+func (reconciler *ClusterReconciler) canRescaleJob() bool {
+	var parallelism = *reconciler.observed.cluster.Spec.Job.Parallelism
+	if parallelism <= reconciler.getJobParallelism() {
+		return true
+	}
+	var slots = reconciler.getAvailableTaskSlots()
+	if slots >= parallelism {
+		return true
+	}
+	reconciler.log.Info(
+		"Waiting for enough task slots to rescale the job",
+		"parallelism",
+		parallelism,
+		"availableSlots",
+		slots)
+	return false
+}
+
+func (reconciler *ClusterReconciler) isRescalePendingRecorded() bool {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	return jobStatus.PendingRescaleParallelism ==
+		*reconciler.observed.cluster.Spec.Job.Parallelism
+}
+
+// Records the parallelism which the job is waiting to be rescaled to in the
+// job status, so that the warning is reported once for each parallelism.
+func (reconciler *ClusterReconciler) setRescalePending() (ctrl.Result, error) {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job.DeepCopy()
+	var parallelism = *reconciler.observed.cluster.Spec.Job.Parallelism
+	jobStatus.PendingRescaleParallelism = parallelism
+	var err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.createJobRescaleEvent(
+			"Warning",
+			fmt.Sprintf(
+				"Waiting for enough task slots to rescale the job to %v, available: %v",
+				parallelism,
+				reconciler.getAvailableTaskSlots()))
+	}
+	return ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}, err
+}
+
+// Resets the rescaling of the job which is resubmitted, the resubmitted job
+// runs with the parallelism of the job spec, possibly on another Flink
+// version.
+func resetRescaleStatus(jobStatus *v1alpha1.JobStatus) {
+	jobStatus.RescaleTriggerID = ""
+	jobStatus.RescaleParallelism = 0
+	jobStatus.PendingRescaleParallelism = 0
+	jobStatus.SkippedRescaleParallelism = 0
+	jobStatus.FlinkVersion = ""
+}
+
+// Gets the number of task slots of the available TaskManagers, i.e., the
+// number of task slots of each TaskManager times the available replicas.
+func (reconciler *ClusterReconciler) getAvailableTaskSlots() int32 {
+	var observed = reconciler.observed
+	var replicas int32
+	if observed.tmDeployment != nil {
+		replicas = observed.tmDeployment.Status.AvailableReplicas
+	} else if observed.tmStatefulSet != nil {
+		replicas = observed.tmStatefulSet.Status.ReadyReplicas
+	}
+	return replicas * getTaskSlotsPerTaskManager(observed.cluster)
+}
+
+// Rescales the running job to the parallelism of the job spec through the
+// Flink rescale API, then tracks the rescaling until it completes. If the
+// Flink version doesn't support the rescale API, the job is upgraded instead,
+// i.e., it is cancelled with a savepoint and resubmitted with the new
+// parallelism.
+func (reconciler *ClusterReconciler) rescaleJob() (ctrl.Result, error) {
+	var log = reconciler.log
+	var flinkClient = reconciler.flinkClient
+	var apiBaseURL = reconciler.observed.flinkAPIBaseURL
+	var cluster = reconciler.observed.cluster
+	var jobStatus = cluster.Status.Components.Job.DeepCopy()
+	var parallelism = *cluster.Spec.Job.Parallelism
+	var requeueResult = ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}
+
+	// The Flink version is recorded in the job status, it doesn't change
+	// while the job is running.
+	if len(jobStatus.FlinkVersion) == 0 {
+		var flinkVersion, err = flinkClient.GetFlinkVersion(
+			reconciler.context, apiBaseURL)
+		if err != nil {
+			log.Info("Failed to get Flink version", "error", err)
+			return requeueResult, nil
+		}
+		jobStatus.FlinkVersion = flinkVersion
+	}
+	var flinkVersion = jobStatus.FlinkVersion
+	if !isRescaleAPISupported(flinkVersion) {
+		log.Info(
+			"Flink rescale API is not supported", "flinkVersion", flinkVersion)
+		return reconciler.rescaleJobWithSavepoint(
+			jobStatus,
+			fmt.Sprintf(
+				"Flink %v doesn't support the rescale API", flinkVersion))
+	}
+
+	log.Info(
+		"Rescaling job",
+		"jobID",
+		jobStatus.ID,
+		"from",
+		reconciler.getJobParallelism(),
+		"to",
+		parallelism)
+	var triggerID, err = flinkClient.TriggerRescaling(
+		reconciler.context, apiBaseURL, jobStatus.ID, parallelism)
+	if err != nil {
+		log.Info("Failed to trigger rescaling", "error", err)
+		// The request is rejected by Flink, other errors are retried.
+		if _, ok := err.(*flinkclient.APIError); ok {
+			return reconciler.rescaleJobWithSavepoint(
+				jobStatus, fmt.Sprintf("Failed to trigger rescaling: %v", err))
+		}
+		return requeueResult, nil
+	}
+	jobStatus.RescaleTriggerID = triggerID.RequestID
+	jobStatus.RescaleParallelism = parallelism
+	jobStatus.PendingRescaleParallelism = 0
+	jobStatus.SkippedRescaleParallelism = 0
+	err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.createJobRescaleEvent(
+			"Normal",
+			fmt.Sprintf(
+				"Rescaling job from %v to %v",
+				reconciler.getJobParallelism(),
+				parallelism))
+	}
+	return requeueResult, err
+}
+
+// Tracks the ongoing rescaling until it completes, the parallelism of the
+// rescaled job is recorded in the job status. If the rescaling fails, the job
+// is rescaled with a savepoint instead.
+func (reconciler *ClusterReconciler) updateRescaleProgress() (
+	ctrl.Result, error) {
+	var log = reconciler.log
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job.DeepCopy()
+	var requeueResult = ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}
+
+	var status, err = reconciler.flinkClient.GetRescalingStatus(
+		reconciler.context, reconciler.observed.flinkAPIBaseURL,
+		jobStatus.ID,
+		jobStatus.RescaleTriggerID)
+	var parallelism = jobStatus.RescaleParallelism
+	jobStatus.RescaleTriggerID = ""
+	jobStatus.RescaleParallelism = 0
+	if err != nil {
+		log.Info("Failed to get rescaling status", "error", err)
+		// The operation is lost, e.g., the JobManager has restarted, the job
+		// is rescaled again if it is still needed.
+		if flinkclient.IsNotFound(err) {
+			return requeueResult, reconciler.updateJobStatus(*jobStatus)
+		}
+		return requeueResult, nil
+	}
+	if !status.Completed {
+		log.Info("Rescaling is in progress", "triggerID", status.TriggerID)
+		return requeueResult, nil
+	}
+	if status.IsFailed() {
+		var reason = getSavepointFailureReason(status.FailureCause)
+		log.Info("Rescaling failed", "reason", reason)
+		return reconciler.rescaleJobWithSavepoint(
+			jobStatus,
+			truncateFailureReason(fmt.Sprintf("Failed to rescale job: %v", reason)))
+	}
+
+	log.Info("Rescaling completed", "parallelism", parallelism)
+	jobStatus.Parallelism = parallelism
+	err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.createJobRescaleEvent(
+			"Normal", fmt.Sprintf("Job rescaled to %v", parallelism))
+	}
+	return requeueResult, err
+}
+
+// Rescales the job by upgrading it, i.e., it is cancelled with a savepoint and
+// resubmitted with the new parallelism. The jobs without savepointsDir cannot
+// be resubmitted, they keep running with the old parallelism.
+func (reconciler *ClusterReconciler) rescaleJobWithSavepoint(
+	jobStatus *v1alpha1.JobStatus, reason string) (ctrl.Result, error) {
+	var cluster = reconciler.observed.cluster
+	var skipReason string
+	if cluster.Spec.Job.SavepointsDir == nil {
+		skipReason = "the job cannot be resubmitted with the new parallelism " +
+			"without savepointsDir"
+	}
+	if len(skipReason) > 0 {
+		reconciler.log.Info(
+			"Skip rescaling job with savepoint", "reason", skipReason)
+		jobStatus.PendingRescaleParallelism = 0
+		jobStatus.SkippedRescaleParallelism = *cluster.Spec.Job.Parallelism
+		var err = reconciler.updateJobStatus(*jobStatus)
+		if err == nil {
+			reconciler.createJobRescaleEvent(
+				"Warning", fmt.Sprintf("%v, %v", reason, skipReason))
+		}
+		return ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}, err
+	}
+	return reconciler.startJobUpgrade(
+		jobStatus,
+		fmt.Sprintf(
+			"%v, taking savepoint before resubmitting the job with parallelism %v",
+			reason,
+			*cluster.Spec.Job.Parallelism))
+}
+
+// Gets the latest completed checkpoint of the job from Flink API, nil if it
+// cannot be found.
+func (reconciler *ClusterReconciler) getLatestCheckpoint(
+	jobID string) *flinkclient.CheckpointInfo {
+	if len(jobID) == 0 {
+		return nil
+	}
+	var checkpoints, err = reconciler.flinkClient.GetJobCheckpoints(
+		reconciler.context, reconciler.observed.flinkAPIBaseURL, jobID)
+	if err != nil {
+		reconciler.log.Info("Failed to get job checkpoints", "error", err)
+		return nil
+	}
+	return checkpoints.Latest.Completed
+}
+
+// Gets the location of the latest savepoint or retained checkpoint to restore
+// the failed job from, empty if none is newer than the savepoint which the job
+// was restarted from.
+func getLatestRestorePoint(
+	jobStatus *v1alpha1.JobStatus,
+	checkpoint *flinkclient.CheckpointInfo) string {
+	var tc = &TimeConverter{}
+	var location = ""
+	var latestTime time.Time
+	if len(jobStatus.LastRestartTime) > 0 {
+		latestTime = tc.FromString(jobStatus.LastRestartTime)
+	}
+
+	var numSavepoints = len(jobStatus.SavepointHistory)
+	if numSavepoints > 0 {
+		var savepoint = jobStatus.SavepointHistory[numSavepoints-1]
+		var savepointTime = tc.FromString(savepoint.Time)
+		if savepointTime.After(latestTime) {
+			location = savepoint.Location
+			latestTime = savepointTime
+		}
+	}
+
+	// Checkpoints which are not externalized cannot be restored from, their
+	// external path is "<checkpoint-not-externally-addressable>".
+	if checkpoint != nil && len(checkpoint.ExternalPath) > 0 &&
+		!strings.HasPrefix(checkpoint.ExternalPath, "<") {
+		var checkpointTime = time.Unix(
+			0, checkpoint.LatestAckTimestamp*int64(time.Millisecond))
+		if checkpointTime.After(latestTime) {
+			location = checkpoint.ExternalPath
+		}
+	}
+	return location
+}
+
+func (reconciler *ClusterReconciler) reconcileClusterDeletion() (
+	ctrl.Result, error) {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+
+	if !hasFinalizer(cluster.ObjectMeta.Finalizers, finalSavepointFinalizer) {
+		log.Info("The cluster is being deleted, no action to take")
+		return ctrl.Result{}, nil
+	}
+
+	var stopped, err = reconciler.stopJobWithFinalSavepoint()
+	if err != nil || !stopped {
+		return ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}, err
+	}
+	return ctrl.Result{}, reconciler.removeFinalizer()
+}
+
+func (reconciler *ClusterReconciler) addFinalizer() error {
+	var cluster = reconciler.observed.cluster.DeepCopy()
+	cluster.ObjectMeta.Finalizers = append(
+		cluster.ObjectMeta.Finalizers, finalSavepointFinalizer)
+	reconciler.log.Info("Adding finalizer", "finalizer", finalSavepointFinalizer)
+	return reconciler.k8sClient.Update(reconciler.context, cluster)
+}
+
+func (reconciler *ClusterReconciler) removeFinalizer() error {
+	var cluster = reconciler.observed.cluster.DeepCopy()
+	cluster.ObjectMeta.Finalizers = removeFinalizer(
+		cluster.ObjectMeta.Finalizers, finalSavepointFinalizer)
+	reconciler.log.Info(
+		"Removing finalizer", "finalizer", finalSavepointFinalizer)
+	return reconciler.k8sClient.Update(reconciler.context, cluster)
+}
+
+// Stops the job with a final savepoint, so that it can be restored later. The
+// job submitter is deleted before the Flink job is stopped by the savepoint,
+// otherwise it would be restarted and resubmit the job. Returns true when the
+// job has stopped, or it can be stopped without the savepoint, e.g., the job
+// is not running, the savepoint is skipped or timed out, in which case the job
+// is cancelled so that it doesn't keep running on the JobManager.
+//
+// The progress is recorded in the job status, each call takes at most one
+// step which updates the status, so the caller should requeue until the job
+// has stopped.
+func (reconciler *ClusterReconciler) stopJobWithFinalSavepoint() (
+	bool, error) {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	var observedJob = reconciler.observed.job
+	var recordedJobStatus = cluster.Status.Components.Job
+
+	if cluster.ObjectMeta.Annotations[skipFinalSavepointAnnotation] == "true" {
+		log.Info("Skip taking the final savepoint as requested")
+		reconciler.recorder.Event(
+			cluster,
+			"Warning",
+			"FinalSavepoint",
+			"Stopping the job without the final savepoint as requested")
+		var cancelled = reconciler.cancelJob()
+		if recordedJobStatus != nil &&
+			recordedJobStatus.StopPhase == v1alpha1.JobStopPhase.TakingSavepoint {
+			var jobStatus = recordedJobStatus.DeepCopy()
+			jobStatus.StopPhase = v1alpha1.JobStopPhase.Stopped
+			if cancelled {
+				jobStatus.State = v1alpha1.JobState.Cancelled
+			}
+			return false, reconciler.updateJobStatus(*jobStatus)
+		}
+		return true, nil
+	}
+
+	if recordedJobStatus == nil ||
+		recordedJobStatus.StopPhase == v1alpha1.JobStopPhase.Stopped {
+		return true, nil
+	}
+
+	var jobStatus = recordedJobStatus.DeepCopy()
+	var savepointsDir = getSavepointsDir(cluster)
+	var tc = &TimeConverter{}
+
+	// Start stopping the job.
+	if len(jobStatus.StopPhase) == 0 {
+		if !reconciler.isJobRunning() {
+			log.Info("Skip taking the final savepoint, job is not running")
+			return true, nil
+		}
+		if len(savepointsDir) == 0 {
+			log.Info("Skip taking the final savepoint, no savepoints dir")
+			reconciler.recorder.Event(
+				cluster,
+				"Warning",
+				"FinalSavepoint",
+				"Stopping the job without the final savepoint, "+
+					"savepointsDir is not specified")
+			reconciler.cancelJob()
+			return true, nil
+		}
+		log.Info("Stopping job with the final savepoint", "jobID", jobStatus.ID)
+		jobStatus.StopPhase = v1alpha1.JobStopPhase.TakingSavepoint
+		jobStatus.StopTime = tc.ToString(time.Now())
+		// The savepoint in progress doesn't stop the job, take a new one.
+		if jobStatus.LastSavepointState == v1alpha1.SavepointState.InProgress {
+			jobStatus.LastSavepointState = ""
+		}
+		var err = reconciler.updateJobStatus(*jobStatus)
+		if err == nil {
+			reconciler.recorder.Event(
+				cluster,
+				"Normal",
+				"FinalSavepoint",
+				"Stopping the job with the final savepoint")
+		}
+		return false, err
+	}
+
+	// Give up taking the final savepoint after the timeout.
+	var timeout = time.Duration(
+		getFinalSavepointTimeoutSeconds(cluster)) * time.Second
+	if time.Now().After(tc.FromString(jobStatus.StopTime).Add(timeout)) {
+		log.Info("Timed out taking the final savepoint", "timeout", timeout)
+		reconciler.recorder.Event(
+			cluster,
+			"Warning",
+			"FinalSavepoint",
+			fmt.Sprintf(
+				"Stopping the job without the final savepoint, timed out after %v",
+				timeout))
+		if reconciler.cancelJob() {
+			jobStatus.State = v1alpha1.JobState.Cancelled
+		}
+		jobStatus.StopPhase = v1alpha1.JobStopPhase.Stopped
+		return false, reconciler.updateJobStatus(*jobStatus)
+	}
+
+	if observedJob != nil {
+		return false, reconciler.deleteJob(observedJob)
+	}
+
+	if jobStatus.LastSavepointState != v1alpha1.SavepointState.InProgress {
+		return false, reconciler.triggerStopWithSavepoint(jobStatus, savepointsDir)
+	}
+
+	var completed, err = reconciler.checkSavepoint(jobStatus)
+	if err != nil || !completed {
+		return false, err
+	}
+	// Retry with a new savepoint if it failed.
+	if jobStatus.LastSavepointState == v1alpha1.SavepointState.Failed {
+		return false, reconciler.updateJobStatus(*jobStatus)
+	}
+
+	jobStatus.State = v1alpha1.JobState.Cancelled
+	jobStatus.StopPhase = v1alpha1.JobStopPhase.Stopped
+	err = reconciler.updateJobStatus(*jobStatus)
+	if err == nil {
+		reconciler.recorder.Event(
+			cluster,
+			"Normal",
+			"FinalSavepoint",
+			fmt.Sprintf(
+				"Job stopped with the final savepoint %v",
+				jobStatus.SavepointLocation))
+	}
+	return false, err
+}
+
+// Cancels the running job without a savepoint. Failing to cancel the job
+// doesn't block stopping it, e.g., when the JobManager is gone, it is reported
+// in a warning event instead. Returns true if the job has been cancelled.
+func (reconciler *ClusterReconciler) cancelJob() bool {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	if !reconciler.isJobRunning() {
+		return false
+	}
+
+	var jobID = reconciler.getFlinkJobID()
+	log.Info("Cancelling job", "jobID", jobID)
+	var err = reconciler.flinkClient.CancelJob(
+		reconciler.context, reconciler.observed.flinkAPIBaseURL, jobID)
+	if err != nil {
+		log.Error(err, "Failed to cancel job", "jobID", jobID)
+		reconciler.recorder.Event(
+			cluster,
+			"Warning",
+			"JobCancel",
+			fmt.Sprintf("Failed to cancel job %v: %v", jobID, err))
+		return false
+	}
+	reconciler.recorder.Event(
+		cluster, "Normal", "JobCancel", fmt.Sprintf("Job %v cancelled", jobID))
+	return true
+}
+
+func (reconciler *ClusterReconciler) isJobStopping() bool {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	return jobStatus != nil &&
+		jobStatus.StopPhase == v1alpha1.JobStopPhase.TakingSavepoint
+}
+
+func (reconciler *ClusterReconciler) createJobUpgradeEvent(message string) {
+	reconciler.recorder.Event(
+		reconciler.observed.cluster, "Normal", "JobUpgrade", message)
+}
+
+func (reconciler *ClusterReconciler) createJobRescaleEvent(
+	eventType string, message string) {
+	reconciler.recorder.Event(
+		reconciler.observed.cluster, eventType, "JobRescale", message)
+}
+
+func (reconciler *ClusterReconciler) getFlinkJobID() string {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	if jobStatus != nil && len(jobStatus.ID) > 0 {
+		return jobStatus.ID
+	}
+	return ""
+}
+
+func (reconciler *ClusterReconciler) shouldTakeSavepoint() bool {
+	var jobSpec = reconciler.observed.cluster.Spec.Job
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+
+	// Not enabled.
+	if jobSpec.SavepointsDir == nil {
+		return false
+	}
+
+	// Job is not running yet.
+	var flinkJobID = reconciler.getFlinkJobID()
+	if len(flinkJobID) == 0 {
+		return false
+	}
+
+	// Job has finished.
+	if reconciler.isJobFinished() {
+		return false
+	}
+
+	// Savepoint requested on demand.
+	if jobSpec.SavepointGeneration > jobStatus.SavepointGeneration {
+		return true
+	}
+
+	// Auto savepoint not enabled.
+	if jobSpec.AutoSavepointSeconds == nil {
+		return false
+	}
+
+	// First savepoint.
+	if len(jobStatus.LastSavepointTime) == 0 {
+		return true
+	}
+
+	// Interval expired.
+	var tc = &TimeConverter{}
+	var lastTime = tc.FromString(jobStatus.LastSavepointTime)
+	var nextTime = lastTime.Add(
+		time.Duration(int64(*jobSpec.AutoSavepointSeconds) * int64(time.Second)))
+	return time.Now().After(nextTime)
+}
+
+func (reconciler *ClusterReconciler) isJobFinished() bool {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	return jobStatus != nil &&
+		isJobStateFinal(jobStatus.State)
+}
+
+// Checks whether the job has to wait for the FlinkSavepoint which it is
+// restored from, the savepoint is not needed once the job has been submitted
+// with it.
+func (reconciler *ClusterReconciler) isSavepointRefPending() bool {
+	var jobSpec = reconciler.observed.cluster.Spec.Job
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	if jobSpec.SavepointRef == nil {
+		return false
+	}
+	if jobStatus != nil && len(jobStatus.FromSavepoint) > 0 {
+		return false
+	}
+	return !isSavepointSucceeded(reconciler.observed.savepoint)
+}
+
+func (reconciler *ClusterReconciler) isJobRunning() bool {
+	return len(reconciler.getFlinkJobID()) > 0 && !reconciler.isJobFinished()
+}
+
+func (reconciler *ClusterReconciler) isSavepointInProgress() bool {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	return jobStatus != nil &&
+		jobStatus.LastSavepointState == v1alpha1.SavepointState.InProgress
+}
+
+// Triggers a savepoint of the job and records the trigger in the job status,
+// the job is cancelled after the savepoint succeeds if cancel is true.
+func (reconciler *ClusterReconciler) triggerSavepoint(
+	jobStatus *v1alpha1.JobStatus,
+	dir string,
+	savepointType string,
+	cancel bool) error {
+	var triggerID, result = triggerSavepoint(
+		reconciler.context,
+		reconciler.flinkClient,
+		reconciler.observed.flinkAPIBaseURL,
+		jobStatus.ID,
+		dir,
+		cancel,
+		reconciler.log)
+	return reconciler.setSavepointTriggered(
+		jobStatus, savepointType, triggerID, result)
+}
+
+// Stops the job with a savepoint, the sources are suspended before the
+// savepoint so that no data is processed after it. The savepoint is tracked
+// like other savepoints.
+func (reconciler *ClusterReconciler) triggerStopWithSavepoint(
+	jobStatus *v1alpha1.JobStatus, dir string) error {
+	var log = reconciler.log
+	var apiBaseURL = reconciler.observed.flinkAPIBaseURL
+
+	log.Info("Stopping job with savepoint", "jobID", jobStatus.ID)
+	// The job may be restored from the final savepoint, so the event time
+	// timers are not fired by draining the job.
+	var triggerID, err = reconciler.flinkClient.StopJobWithSavepoint(
+		reconciler.context, apiBaseURL, jobStatus.ID, dir, false /* drain */)
+	var result savepointResult
+	if err != nil {
+		result = getSavepointTriggerFailure(err)
+	}
+	return reconciler.setSavepointTriggered(
+		jobStatus, v1alpha1.SavepointType.Final, triggerID.RequestID, result)
+}
+
+// Records the triggered savepoint in the job status, or the failure if it
+// cannot be triggered. The type of the savepoint and the savepoint generation
+// which it serves are decided when it is triggered, the spec may change while
+// the savepoint is in progress.
+func (reconciler *ClusterReconciler) setSavepointTriggered(
+	jobStatus *v1alpha1.JobStatus,
+	savepointType string,
+	triggerID string,
+	result savepointResult) error {
+	var tc = &TimeConverter{}
+	var jobSpec = reconciler.observed.cluster.Spec.Job
+	jobStatus.LastSavepointType = savepointType
+	jobStatus.LastSavepointTriggerGeneration = jobStatus.SavepointGeneration
+	if jobSpec != nil {
+		jobStatus.LastSavepointTriggerGeneration = jobSpec.SavepointGeneration
+	}
+	if result.failed() {
+		reconciler.setSavepointFailed(jobStatus, result.failureReason)
+		reconciler.updateJobStatus(*jobStatus)
+		return errors.New(result.failureReason)
+	}
+	jobStatus.LastSavepointTriggerID = triggerID
+	jobStatus.LastSavepointTriggerTime = tc.ToString(time.Now())
+	jobStatus.LastSavepointState = v1alpha1.SavepointState.InProgress
+	jobStatus.LastSavepointFailureReason = ""
+	return reconciler.updateJobStatus(*jobStatus)
+}
+
+// Checks the savepoint in progress and updates the job status if it has
+// completed.
+func (reconciler *ClusterReconciler) updateSavepointProgress() error {
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job.DeepCopy()
+	var completed, err = reconciler.checkSavepoint(jobStatus)
+	if err != nil || !completed {
+		return err
+	}
+	return reconciler.updateJobStatus(*jobStatus)
+}
+
+// Checks the status of the savepoint in progress, records the result in the
+// given job status if it has completed. Returns true if the savepoint has
+// completed, no matter it succeeded or failed.
+func (reconciler *ClusterReconciler) checkSavepoint(
+	jobStatus *v1alpha1.JobStatus) (bool, error) {
+	var tc = &TimeConverter{}
+	var result, err = checkSavepointStatus(
+		reconciler.context,
+		reconciler.flinkClient,
+		reconciler.observed.flinkAPIBaseURL,
+		jobStatus.ID,
+		jobStatus.LastSavepointTriggerID,
+		jobStatus.LastSavepointTriggerTime,
+		reconciler.log)
+	if err != nil || !result.completed {
+		return false, err
+	}
+	if result.failed() {
+		reconciler.setSavepointFailed(jobStatus, result.failureReason)
+		return true, nil
+	}
+	jobStatus.LastSavepointState = v1alpha1.SavepointState.Succeeded
+	jobStatus.LastSavepointFailureReason = ""
+	jobStatus.SavepointLocation = result.location
 	jobStatus.LastSavepointTime = tc.ToString(time.Now())
-	return reconciler.k8sClient.Update(reconciler.context, &cluster)
+	reconciler.setSavepointGenerationServed(jobStatus)
+	reconciler.addSavepointToHistory(jobStatus, v1alpha1.SavepointInfo{
+		Location:  result.location,
+		TriggerID: jobStatus.LastSavepointTriggerID,
+		Time:      jobStatus.LastSavepointTime,
+		Type:      jobStatus.LastSavepointType,
+	})
+	return true, nil
+}
+
+// Adds the savepoint to the history in the job status. The savepoints which
+// expire from the history are deleted from the storage if the retention is
+// enabled with maxSavepointsToKeep, once the job status has been updated. The
+// retention is skipped while no storage is registered for the savepoint, so
+// that the history isn't shortened for savepoints which are never deleted.
+func (reconciler *ClusterReconciler) addSavepointToHistory(
+	jobStatus *v1alpha1.JobStatus, savepoint v1alpha1.SavepointInfo) {
+	var jobSpec = reconciler.observed.cluster.Spec.Job
+	var maxSavepointsToKeep = defaultSavepointHistoryLength
+	var retentionEnabled = jobSpec != nil && jobSpec.MaxSavepointsToKeep != nil
+	if retentionEnabled &&
+		!reconciler.savepointStorage.IsSupported(savepoint.Location) {
+		reconciler.log.Info(
+			"Skip deleting expired savepoints, the savepoint storage is not supported",
+			"location",
+			savepoint.Location)
+		retentionEnabled = false
+	}
+	if retentionEnabled {
+		maxSavepointsToKeep = int(*jobSpec.MaxSavepointsToKeep)
+	}
+
+	var history, expired = getExpiredSavepoints(
+		append(jobStatus.SavepointHistory, savepoint), maxSavepointsToKeep)
+	jobStatus.SavepointHistory = history
+	if !retentionEnabled {
+		return
+	}
+
+	for _, expiredSavepoint := range expired {
+		var location = expiredSavepoint.Location
+		// Never delete the savepoints which the job can be restored from.
+		if location == jobStatus.FromSavepoint ||
+			(jobSpec.Savepoint != nil && location == *jobSpec.Savepoint) {
+			continue
+		}
+		reconciler.expiredSavepoints =
+			append(reconciler.expiredSavepoints, location)
+	}
+}
+
+// Deletes the expired savepoints from the storage. The savepoints which cannot
+// be deleted, e.g., in an unsupported storage, are reported in a single event,
+// so that they can be deleted manually.
+func (reconciler *ClusterReconciler) deleteExpiredSavepoints() {
+	var log = reconciler.log
+	var failures = []string{}
+	for _, location := range reconciler.expiredSavepoints {
+		log.Info("Deleting expired savepoint", "location", location)
+		var err = reconciler.savepointStorage.DeleteSavepoint(location)
+		if err != nil {
+			log.Error(
+				err, "Failed to delete expired savepoint", "location", location)
+			failures = append(failures, fmt.Sprintf("%v: %v", location, err))
+		}
+	}
+	reconciler.expiredSavepoints = nil
+	if len(failures) > 0 {
+		reconciler.recorder.Event(
+			reconciler.observed.cluster,
+			"Warning",
+			"SavepointDeletionFailed",
+			fmt.Sprintf(
+				"Failed to delete expired savepoints, delete them manually: %v",
+				strings.Join(failures, "; ")))
+	}
+}
+
+// Records the failure of the last savepoint in the job status.
+func (reconciler *ClusterReconciler) setSavepointFailed(
+	jobStatus *v1alpha1.JobStatus, reason string) {
+	var tc = &TimeConverter{}
+	reconciler.log.Info("Savepoint failed", "reason", reason)
+	reconciler.recorder.Event(
+		reconciler.observed.cluster, "Warning", "SavepointFailed", reason)
+	jobStatus.LastSavepointState = v1alpha1.SavepointState.Failed
+	jobStatus.LastSavepointFailureReason = reason
+	jobStatus.LastSavepointTime = tc.ToString(time.Now())
+	reconciler.setSavepointGenerationServed(jobStatus)
+}
+
+// The savepoint serves the on-demand requests up to the savepoint generation
+// of the job spec when it was triggered, the requests after the trigger are
+// served by a later savepoint.
+func (reconciler *ClusterReconciler) setSavepointGenerationServed(
+	jobStatus *v1alpha1.JobStatus) {
+	if jobStatus.LastSavepointTriggerGeneration > jobStatus.SavepointGeneration {
+		jobStatus.SavepointGeneration = jobStatus.LastSavepointTriggerGeneration
+	}
+}
+
+func (reconciler *ClusterReconciler) updateJobStatus(
+	jobStatus v1alpha1.JobStatus) error {
+	var cluster = v1alpha1.FlinkCluster{}
+	reconciler.observed.cluster.DeepCopyInto(&cluster)
+	cluster.Status.Components.Job = &jobStatus
+	var err = reconciler.k8sClient.Update(reconciler.context, &cluster)
+	if err != nil {
+		return err
+	}
+	reconciler.deleteExpiredSavepoints()
+	return nil
+}
+
+// Splits the savepoint history into the latest savepoints to keep and the
+// expired ones.
+func getExpiredSavepoints(
+	history []v1alpha1.SavepointInfo,
+	maxSavepointsToKeep int) ([]v1alpha1.SavepointInfo, []v1alpha1.SavepointInfo) {
+	if len(history) <= maxSavepointsToKeep {
+		return history, nil
+	}
+	var numExpired = len(history) - maxSavepointsToKeep
+	return history[numExpired:], history[:numExpired]
+}
+
+// Gets the failure reason of a savepoint from the first line of the stack
+// trace, which contains the exception and its message.
+func getSavepointFailureReason(cause flinkclient.SavepointFailureCause) string {
+	var firstLine = strings.SplitN(cause.StackTrace, "\n", 2)[0]
+	if len(firstLine) > 0 {
+		return firstLine
+	}
+	if len(cause.ExceptionClass) > 0 {
+		return cause.ExceptionClass
+	}
+	return "unknown"
+}
+
+func (reconciler *ClusterReconciler) createComponentUpdateEvent(name string) {
+	reconciler.recorder.Event(
+		reconciler.observed.cluster,
+		"Normal",
+		"ComponentUpdated",
+		fmt.Sprintf("%v updated to the desired state", name))
+}
+
+// The following functions compare the desired state with the observed state
+// of the components. Fields which are not set in the desired state, e.g.,
+// populated by the API server with default values or added by other
+// controllers, are ignored, so that only the changes of the spec and the
+// manual drift of the fields managed by the operator are detected.
+
+// Checks whether the job spec has changed since the job was submitted, so that
+// the job needs to be upgraded. The job submitted through the Flink REST API
+// has no job submitter to compare with, the hash of the job spec which it was
+// submitted with is compared instead.
+func (reconciler *ClusterReconciler) isJobSpecChanged(
+	desiredJob *batchv1.Job, observedJob *batchv1.Job) bool {
+	var cluster = reconciler.observed.cluster
+	if cluster.Spec.Job.IsRESTSubmission() {
+		var jobStatus = cluster.Status.Components.Job
+		return jobStatus != nil && len(jobStatus.SubmittedSpecHash) > 0 &&
+			jobStatus.SubmittedSpecHash != getJobSpecHash(cluster.Spec.Job)
+	}
+	return observedJob != nil && isJobUpgradeNeeded(desiredJob, observedJob)
+}
+
+// The job needs to be upgraded when the arguments of the job submitter, which
+// are derived from the job spec, have changed. A change of the parallelism
+// alone is applied by rescaling the job instead.
+func isJobUpgradeNeeded(desired *batchv1.Job, observed *batchv1.Job) bool {
+	var desiredContainers = desired.Spec.Template.Spec.Containers
+	var observedContainers = observed.Spec.Template.Spec.Containers
+	if len(desiredContainers) == 0 || len(observedContainers) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(
+		removeJobArg(desiredContainers[0].Args, "--parallelism"),
+		removeJobArg(observedContainers[0].Args, "--parallelism"))
+}
+
+// Removes the arg and its value from the args of the job submitter.
+func removeJobArg(args []string, name string) []string {
+	var result = []string{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == name && i+1 < len(args) {
+			i++
+			continue
+		}
+		result = append(result, args[i])
+	}
+	return result
+}
+
+func isDeploymentUpdateNeeded(
+	desired *appsv1.Deployment, observed *appsv1.Deployment) bool {
+	return isObjectMetaChanged(&desired.ObjectMeta, &observed.ObjectMeta) ||
+		!equality.Semantic.DeepDerivative(desired.Spec, observed.Spec)
+}
+
+func isStatefulSetUpdateNeeded(
+	desired *appsv1.StatefulSet, observed *appsv1.StatefulSet) bool {
+	var desiredSpec = desired.Spec
+	// The volume claim templates are not updated, and the observed ones have
+	// the defaults and the status set by the API server.
+	desiredSpec.VolumeClaimTemplates = nil
+	return isObjectMetaChanged(&desired.ObjectMeta, &observed.ObjectMeta) ||
+		!equality.Semantic.DeepDerivative(desiredSpec, observed.Spec)
+}
+
+func isServiceUpdateNeeded(
+	desired *corev1.Service, observed *corev1.Service) bool {
+	return isObjectMetaChanged(&desired.ObjectMeta, &observed.ObjectMeta) ||
+		!equality.Semantic.DeepDerivative(desired.Spec, observed.Spec)
+}
+
+func isIngressUpdateNeeded(
+	desired *extensionsv1beta1.Ingress,
+	observed *extensionsv1beta1.Ingress) bool {
+	// An empty TLS list in the desired spec means TLS is disabled, not
+	// unspecified.
+	if len(desired.Spec.TLS) == 0 && len(observed.Spec.TLS) > 0 {
+		return true
+	}
+	return isObjectMetaChanged(&desired.ObjectMeta, &observed.ObjectMeta) ||
+		!equality.Semantic.DeepDerivative(desired.Spec, observed.Spec)
+}
+
+func isConfigMapUpdateNeeded(
+	desired *corev1.ConfigMap, observed *corev1.ConfigMap) bool {
+	return isObjectMetaChanged(&desired.ObjectMeta, &observed.ObjectMeta) ||
+		!reflect.DeepEqual(desired.Data, observed.Data)
+}
+
+func isObjectMetaChanged(
+	desired *metav1.ObjectMeta, observed *metav1.ObjectMeta) bool {
+	return !equality.Semantic.DeepDerivative(desired.Labels, observed.Labels) ||
+		!equality.Semantic.DeepDerivative(
+			desired.Annotations, observed.Annotations)
+}
+
+// Merges the labels and annotations of the desired object into the observed
+// one, keeps the ones added by others.
+func mergeObjectMeta(desired *metav1.ObjectMeta, observed *metav1.ObjectMeta) {
+	if len(desired.Labels) > 0 && observed.Labels == nil {
+		observed.Labels = map[string]string{}
+	}
+	for k, v := range desired.Labels {
+		observed.Labels[k] = v
+	}
+	if len(desired.Annotations) > 0 && observed.Annotations == nil {
+		observed.Annotations = map[string]string{}
+	}
+	for k, v := range desired.Annotations {
+		observed.Annotations[k] = v
+	}
+}
+
+// Merges the desired service ports with the observed ones, keeps the node
+// ports allocated by the API server unless the service type is ClusterIP.
+func mergeServicePorts(
+	desiredPorts []corev1.ServicePort,
+	observedPorts []corev1.ServicePort,
+	serviceType corev1.ServiceType) []corev1.ServicePort {
+	var ports = []corev1.ServicePort{}
+	for _, desiredPort := range desiredPorts {
+		var port = desiredPort
+		if serviceType != corev1.ServiceTypeClusterIP {
+			for _, observedPort := range observedPorts {
+				if observedPort.Name == port.Name {
+					port.NodePort = observedPort.NodePort
+				}
+			}
+		}
+		ports = append(ports, port)
+	}
+	return ports
 }
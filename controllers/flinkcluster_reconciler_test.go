@@ -0,0 +1,400 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"github.com/googlecloudplatform/flink-operator/controllers/savepointstorage"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestShouldTakeSavepointOnDemand(t *testing.T) {
+	var savepointsDir = "gs://my-bucket/savepoints"
+	var cluster = v1alpha1.FlinkCluster{
+		Spec: v1alpha1.FlinkClusterSpec{
+			Job: &v1alpha1.JobSpec{
+				SavepointsDir:       &savepointsDir,
+				SavepointGeneration: 1,
+			},
+		},
+		Status: v1alpha1.FlinkClusterStatus{
+			Components: v1alpha1.FlinkClusterComponentsStatus{
+				Job: &v1alpha1.JobStatus{
+					ID:    "ec7d6b0e1ba0e5d8fb4e4a2e8a7d7e43",
+					State: v1alpha1.JobState.Running,
+				},
+			},
+		},
+	}
+	var reconciler = ClusterReconciler{
+		observed: ObservedClusterState{cluster: &cluster},
+	}
+	assert.Assert(t, reconciler.shouldTakeSavepoint())
+
+	cluster.Status.Components.Job.SavepointGeneration = 1
+	assert.Assert(t, !reconciler.shouldTakeSavepoint())
+}
+
+func TestGetSavepointFailureReason(t *testing.T) {
+	var cause = flinkclient.SavepointFailureCause{
+		ExceptionClass: "java.util.concurrent.CompletionException",
+		StackTrace: "java.util.concurrent.CompletionException: " +
+			"Checkpoint expired before completing.\n" +
+			"\tat java.util.concurrent.CompletableFuture.encodeThrowable",
+	}
+	assert.Equal(
+		t,
+		getSavepointFailureReason(cause),
+		"java.util.concurrent.CompletionException: "+
+			"Checkpoint expired before completing.")
+
+	cause.StackTrace = ""
+	assert.Equal(
+		t,
+		getSavepointFailureReason(cause),
+		"java.util.concurrent.CompletionException")
+}
+
+func TestGetExpiredSavepoints(t *testing.T) {
+	var history = []v1alpha1.SavepointInfo{
+		{Location: "file:///savepoints/savepoint-1"},
+		{Location: "file:///savepoints/savepoint-2"},
+		{Location: "file:///savepoints/savepoint-3"},
+	}
+	var kept, expired = getExpiredSavepoints(history, 3)
+	assert.DeepEqual(t, kept, history)
+	assert.Equal(t, len(expired), 0)
+
+	kept, expired = getExpiredSavepoints(history, 1)
+	assert.DeepEqual(t, kept, history[2:])
+	assert.DeepEqual(t, expired, history[:2])
+}
+
+func TestAddSavepointToHistory(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "savepoints")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	var savepoints = []string{}
+	for _, name := range []string{"savepoint-1", "savepoint-2", "savepoint-3"} {
+		var savepoint = filepath.Join(dir, name)
+		assert.NilError(t, os.Mkdir(savepoint, 0755))
+		savepoints = append(savepoints, "file://"+savepoint)
+	}
+
+	var maxSavepointsToKeep int32 = 1
+	var cluster = v1alpha1.FlinkCluster{
+		Spec: v1alpha1.FlinkClusterSpec{
+			Job: &v1alpha1.JobSpec{MaxSavepointsToKeep: &maxSavepointsToKeep},
+		},
+	}
+	var jobStatus = v1alpha1.JobStatus{
+		// The job was restored from the first savepoint.
+		FromSavepoint: savepoints[0],
+		SavepointHistory: []v1alpha1.SavepointInfo{
+			{Location: savepoints[0], Type: v1alpha1.SavepointType.Periodic},
+			{Location: savepoints[1], Type: v1alpha1.SavepointType.Manual},
+		},
+	}
+	var savepointStorage = savepointstorage.NewRegistry()
+	savepointStorage.Register(
+		"file", &savepointstorage.LocalStorage{Dir: dir})
+	var reconciler = ClusterReconciler{
+		savepointStorage: savepointStorage,
+		log:              log.Log,
+		recorder:         record.NewFakeRecorder(10),
+		observed:         ObservedClusterState{cluster: &cluster},
+	}
+	reconciler.addSavepointToHistory(&jobStatus, v1alpha1.SavepointInfo{
+		Location: savepoints[2], Type: v1alpha1.SavepointType.Periodic})
+
+	assert.DeepEqual(t, jobStatus.SavepointHistory, []v1alpha1.SavepointInfo{
+		{Location: savepoints[2], Type: v1alpha1.SavepointType.Periodic}})
+	// The expired savepoint is not deleted until the history is stored.
+	assert.DeepEqual(t, reconciler.expiredSavepoints, savepoints[1:2])
+	_, err = os.Stat(filepath.Join(dir, "savepoint-2"))
+	assert.NilError(t, err)
+
+	reconciler.deleteExpiredSavepoints()
+	assert.Assert(t, reconciler.expiredSavepoints == nil)
+	_, err = os.Stat(filepath.Join(dir, "savepoint-1"))
+	assert.NilError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "savepoint-2"))
+	assert.Assert(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "savepoint-3"))
+	assert.NilError(t, err)
+}
+
+func TestAddSavepointToHistoryInUnsupportedStorage(t *testing.T) {
+	var maxSavepointsToKeep int32 = 1
+	var cluster = v1alpha1.FlinkCluster{
+		Spec: v1alpha1.FlinkClusterSpec{
+			Job: &v1alpha1.JobSpec{MaxSavepointsToKeep: &maxSavepointsToKeep},
+		},
+	}
+	var jobStatus = v1alpha1.JobStatus{
+		SavepointHistory: []v1alpha1.SavepointInfo{
+			{Location: "gs://my-bucket/savepoint-1"},
+		},
+	}
+	var reconciler = ClusterReconciler{
+		savepointStorage: savepointstorage.NewRegistry(),
+		log:              log.Log,
+		recorder:         record.NewFakeRecorder(10),
+		observed:         ObservedClusterState{cluster: &cluster},
+	}
+	reconciler.addSavepointToHistory(
+		&jobStatus, v1alpha1.SavepointInfo{Location: "gs://my-bucket/savepoint-2"})
+
+	// The savepoints cannot be deleted, so the history is kept.
+	assert.DeepEqual(t, jobStatus.SavepointHistory, []v1alpha1.SavepointInfo{
+		{Location: "gs://my-bucket/savepoint-1"},
+		{Location: "gs://my-bucket/savepoint-2"},
+	})
+	assert.Equal(t, len(reconciler.expiredSavepoints), 0)
+}
+
+func TestDeleteExpiredSavepointsInUnsupportedStorage(t *testing.T) {
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		savepointStorage: savepointstorage.NewRegistry(),
+		log:              log.Log,
+		recorder:         recorder,
+		observed:         ObservedClusterState{cluster: &v1alpha1.FlinkCluster{}},
+		expiredSavepoints: []string{
+			"/savepoints/savepoint-1", "gs://my-bucket/savepoint-2"},
+	}
+	reconciler.deleteExpiredSavepoints()
+
+	assert.Equal(t, len(recorder.Events), 1)
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning SavepointDeletionFailed Failed to delete expired savepoints, "+
+			"delete them manually: /savepoints/savepoint-1: unsupported "+
+			"savepoint storage of location /savepoints/savepoint-1; "+
+			"gs://my-bucket/savepoint-2: unsupported savepoint storage of "+
+			"location gs://my-bucket/savepoint-2")
+}
+
+func TestGetLatestRestorePoint(t *testing.T) {
+	var tc = &TimeConverter{}
+	var savepointTime = time.Date(2019, 11, 1, 10, 0, 0, 0, time.UTC)
+	var jobStatus = &v1alpha1.JobStatus{
+		SavepointHistory: []v1alpha1.SavepointInfo{
+			{Location: "gs://my-bucket/savepoint-1", Time: "2019-11-01T09:00:00Z"},
+			{Location: "gs://my-bucket/savepoint-2", Time: tc.ToString(savepointTime)},
+		},
+	}
+	var checkpoint = &flinkclient.CheckpointInfo{
+		ExternalPath: "gs://my-bucket/checkpoints/chk-5",
+		LatestAckTimestamp: savepointTime.Add(
+			-time.Minute).UnixNano() / int64(time.Millisecond),
+	}
+
+	// The savepoint is newer than the checkpoint.
+	assert.Equal(
+		t,
+		getLatestRestorePoint(jobStatus, checkpoint),
+		"gs://my-bucket/savepoint-2")
+
+	// The checkpoint is newer than the savepoint.
+	checkpoint.LatestAckTimestamp = savepointTime.Add(
+		time.Minute).UnixNano() / int64(time.Millisecond)
+	assert.Equal(
+		t,
+		getLatestRestorePoint(jobStatus, checkpoint),
+		"gs://my-bucket/checkpoints/chk-5")
+
+	// The checkpoint is not retained.
+	checkpoint.ExternalPath = "<checkpoint-not-externally-addressable>"
+	assert.Equal(
+		t,
+		getLatestRestorePoint(jobStatus, checkpoint),
+		"gs://my-bucket/savepoint-2")
+
+	// The savepoint is older than the last restart.
+	jobStatus.LastRestartTime = tc.ToString(savepointTime.Add(time.Hour))
+	assert.Equal(t, getLatestRestorePoint(jobStatus, checkpoint), "")
+	assert.Equal(t, getLatestRestorePoint(jobStatus, nil), "")
+}
+
+func TestIsJobUpgradeNeeded(t *testing.T) {
+	var desired = batchv1.Job{
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "main",
+							Args: []string{"/opt/flink/bin/flink", "run", "job.jar"},
+						},
+					},
+				},
+			},
+		},
+	}
+	var observed = desired.DeepCopy()
+	observed.Spec.Template.Spec.Containers[0].ImagePullPolicy =
+		corev1.PullIfNotPresent
+	assert.Assert(t, !isJobUpgradeNeeded(&desired, observed))
+
+	// The parallelism is changed by rescaling the job.
+	observed.Spec.Template.Spec.Containers[0].Args = []string{
+		"/opt/flink/bin/flink", "run", "--parallelism", "2", "job.jar"}
+	assert.Assert(t, !isJobUpgradeNeeded(&desired, observed))
+
+	observed.Spec.Template.Spec.Containers[0].Args = []string{
+		"/opt/flink/bin/flink", "run", "--class", "Main", "job.jar"}
+	assert.Assert(t, isJobUpgradeNeeded(&desired, observed))
+}
+
+func TestIsDeploymentUpdateNeededIgnoresDefaults(t *testing.T) {
+	var replicas int32 = 2
+	var desired = appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"app": "flink"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "taskmanager", Image: "flink:1.8.1"},
+					},
+				},
+			},
+		},
+	}
+	var observed = desired.DeepCopy()
+	observed.Annotations = map[string]string{
+		"deployment.kubernetes.io/revision": "1"}
+	observed.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirst
+	observed.Spec.Template.Spec.Containers[0].TerminationMessagePath =
+		"/dev/termination-log"
+	assert.Assert(t, !isDeploymentUpdateNeeded(&desired, observed))
+
+	observed.Spec.Template.Spec.Containers[0].Image = "flink:1.9.0"
+	assert.Assert(t, isDeploymentUpdateNeeded(&desired, observed))
+}
+
+func TestIsDeploymentUpdateNeededForReplicas(t *testing.T) {
+	var desiredReplicas int32 = 3
+	var observedReplicas int32 = 2
+	var desired = appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: &desiredReplicas},
+	}
+	var observed = appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: &observedReplicas},
+	}
+	assert.Assert(t, isDeploymentUpdateNeeded(&desired, &observed))
+}
+
+func TestIsServiceUpdateNeeded(t *testing.T) {
+	var desired = corev1.Service{
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "ui", Port: 8081, TargetPort: intstr.FromString("ui")},
+			},
+		},
+	}
+	var observed = desired.DeepCopy()
+	observed.Spec.ClusterIP = "10.0.0.1"
+	observed.Spec.Ports[0].Protocol = corev1.ProtocolTCP
+	assert.Assert(t, !isServiceUpdateNeeded(&desired, observed))
+
+	observed.Spec.Type = corev1.ServiceTypeLoadBalancer
+	assert.Assert(t, isServiceUpdateNeeded(&desired, observed))
+}
+
+func TestIsIngressUpdateNeeded(t *testing.T) {
+	var desired = extensionsv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{"kubernetes.io/ingress.class": "nginx"},
+		},
+		Spec: extensionsv1beta1.IngressSpec{
+			Rules: []extensionsv1beta1.IngressRule{{Host: "flink.example.com"}},
+		},
+	}
+	var observed = desired.DeepCopy()
+	observed.Annotations["ingress.kubernetes.io/backends"] = "{}"
+	assert.Assert(t, !isIngressUpdateNeeded(&desired, observed))
+
+	observed.Spec.TLS = []extensionsv1beta1.IngressTLS{
+		{Hosts: []string{"flink.example.com"}}}
+	assert.Assert(t, isIngressUpdateNeeded(&desired, observed))
+
+	observed = desired.DeepCopy()
+	observed.Annotations["kubernetes.io/ingress.class"] = "gce"
+	assert.Assert(t, isIngressUpdateNeeded(&desired, observed))
+}
+
+func TestIsConfigMapUpdateNeeded(t *testing.T) {
+	var desired = corev1.ConfigMap{
+		Data: map[string]string{"flink-conf.yaml": "rest.port: 8081\n"},
+	}
+	var observed = desired.DeepCopy()
+	assert.Assert(t, !isConfigMapUpdateNeeded(&desired, observed))
+
+	observed.Data["flink-conf.yaml"] = "rest.port: 8082\n"
+	assert.Assert(t, isConfigMapUpdateNeeded(&desired, observed))
+}
+
+func TestMergeObjectMeta(t *testing.T) {
+	var desired = metav1.ObjectMeta{
+		Labels:      map[string]string{"app": "flink"},
+		Annotations: map[string]string{"foo": "bar"},
+	}
+	var observed = metav1.ObjectMeta{
+		Annotations: map[string]string{"foo": "baz", "other": "value"},
+	}
+	mergeObjectMeta(&desired, &observed)
+	assert.DeepEqual(t, observed, metav1.ObjectMeta{
+		Labels:      map[string]string{"app": "flink"},
+		Annotations: map[string]string{"foo": "bar", "other": "value"},
+	})
+}
+
+func TestMergeServicePorts(t *testing.T) {
+	var desiredPorts = []corev1.ServicePort{{Name: "ui", Port: 8081}}
+	var observedPorts = []corev1.ServicePort{
+		{Name: "ui", Port: 8081, NodePort: 30001}}
+
+	var ports = mergeServicePorts(
+		desiredPorts, observedPorts, corev1.ServiceTypeLoadBalancer)
+	assert.DeepEqual(
+		t, ports, []corev1.ServicePort{{Name: "ui", Port: 8081, NodePort: 30001}})
+
+	ports = mergeServicePorts(
+		desiredPorts, observedPorts, corev1.ServiceTypeClusterIP)
+	assert.DeepEqual(t, ports, []corev1.ServicePort{{Name: "ui", Port: 8081}})
+}
@@ -23,12 +23,16 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -146,6 +150,22 @@ func (updater *ClusterStatusUpdater) createStatusChangeEvents(
 			newStatus.Components.Job.State)
 	}
 
+	// Job failure.
+	if newStatus.Components.Job != nil &&
+		len(newStatus.Components.Job.FailureTime) > 0 &&
+		(oldStatus.Components.Job == nil ||
+			oldStatus.Components.Job.FailureTime !=
+				newStatus.Components.Job.FailureTime) {
+		updater.recorder.Event(
+			updater.observed.cluster,
+			"Warning",
+			"JobFailure",
+			fmt.Sprintf(
+				"Flink job %v failed: %v",
+				newStatus.Components.Job.ID,
+				newStatus.Components.Job.FailureReason))
+	}
+
 	// Cluster.
 	if oldStatus.State != newStatus.State {
 		updater.createStatusChangeEvent("Cluster", oldStatus.State, newStatus.State)
@@ -193,13 +213,21 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 			}
 	}
 
-	// JobManager deployment.
+	// JobManager deployment, or StatefulSet.
 	var observedJmDeployment = observed.jmDeployment
-	if observedJmDeployment != nil {
-		status.Components.JobManagerDeployment.Name =
-			observedJmDeployment.ObjectMeta.Name
-		status.Components.JobManagerDeployment.State =
-			getDeploymentState(observedJmDeployment)
+	var observedJmStatefulSet = observed.jmStatefulSet
+	if observedJmDeployment != nil || observedJmStatefulSet != nil {
+		if observedJmDeployment != nil {
+			status.Components.JobManagerDeployment.Name =
+				observedJmDeployment.ObjectMeta.Name
+			status.Components.JobManagerDeployment.State =
+				getDeploymentState(observedJmDeployment)
+		} else {
+			status.Components.JobManagerDeployment.Name =
+				observedJmStatefulSet.ObjectMeta.Name
+			status.Components.JobManagerDeployment.State =
+				getStatefulSetState(observedJmStatefulSet)
+		}
 		if status.Components.JobManagerDeployment.State ==
 			v1alpha1.ComponentState.Ready {
 			runningComponents++
@@ -323,13 +351,32 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 			}
 	}
 
-	// TaskManager deployment.
+	// TaskManager deployment, or StatefulSet.
 	var observedTmDeployment = observed.tmDeployment
-	if observedTmDeployment != nil {
-		status.Components.TaskManagerDeployment.Name =
-			observedTmDeployment.ObjectMeta.Name
-		status.Components.TaskManagerDeployment.State =
-			getDeploymentState(observedTmDeployment)
+	var observedTmStatefulSet = observed.tmStatefulSet
+	if observedTmDeployment != nil || observedTmStatefulSet != nil {
+		var tmSelector *metav1.LabelSelector
+		if observedTmDeployment != nil {
+			status.Components.TaskManagerDeployment.Name =
+				observedTmDeployment.ObjectMeta.Name
+			status.Components.TaskManagerDeployment.State =
+				getDeploymentState(observedTmDeployment)
+			status.TaskManagerReplicas = observedTmDeployment.Status.Replicas
+			tmSelector = observedTmDeployment.Spec.Selector
+		} else {
+			status.Components.TaskManagerDeployment.Name =
+				observedTmStatefulSet.ObjectMeta.Name
+			status.Components.TaskManagerDeployment.State =
+				getStatefulSetState(observedTmStatefulSet)
+			status.TaskManagerReplicas = observedTmStatefulSet.Status.Replicas
+			tmSelector = observedTmStatefulSet.Spec.Selector
+		}
+		// The selector of the scale subresource, autoscalers use it to find
+		// the TaskManager pods and their metrics.
+		selector, err := metav1.LabelSelectorAsSelector(tmSelector)
+		if err == nil {
+			status.TaskManagerSelector = selector.String()
+		}
 		if status.Components.TaskManagerDeployment.State ==
 			v1alpha1.ComponentState.Ready {
 			runningComponents++
@@ -342,15 +389,37 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 			}
 	}
 
+	// (Optional) Jobs in the session cluster, the recorded jobs are kept if
+	// they cannot be observed.
+	if observed.cluster.Spec.Job == nil {
+		if observed.flinkJobsOverview != nil {
+			status.Components.Jobs = getSessionJobs(observed.flinkJobsOverview)
+		} else {
+			for _, job := range recorded.Components.Jobs {
+				status.Components.Jobs = append(status.Components.Jobs, job)
+			}
+		}
+	}
+
 	// (Optional) Job.
 	var jobFinished = false
 	var jobSucceeded = false
 	var observedJob = observed.job
+	var recordedJobStatus = observed.cluster.Status.Components.Job
 	if observedJob != nil {
 		status.Components.Job = &v1alpha1.JobStatus{}
-		var recordedJobStatus = observed.cluster.Status.Components.Job
-		if recordedJobStatus != nil {
+		// The status of a stopped job is not carried over to a new job, except
+		// the served savepoint requests and the savepoint history, so that
+		// the new job neither takes a savepoint which was not requested nor
+		// loses track of the savepoints to retain.
+		if recordedJobStatus != nil &&
+			recordedJobStatus.StopPhase != v1alpha1.JobStopPhase.Stopped {
 			recordedJobStatus.DeepCopyInto(status.Components.Job)
+		} else if recordedJobStatus != nil {
+			status.Components.Job.SavepointGeneration =
+				recordedJobStatus.SavepointGeneration
+			status.Components.Job.SavepointHistory =
+				recordedJobStatus.DeepCopy().SavepointHistory
 		}
 		status.Components.Job.Name = observedJob.ObjectMeta.Name
 
@@ -359,25 +428,72 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 			status.Components.Job.ID = *flinkJobID
 		}
 
+		// The state reported by Flink is authoritative once the Flink job is
+		// observed.
+		var flinkJobState = deriveFlinkJobState(observed, status.Components.Job)
+
 		if observedJob.Status.Active > 0 {
 			// When job status is Active, it is possible that the pod is still
 			// Pending (for scheduling), so we use Flink job ID to determine
-			// the actual state.
-			if flinkJobID == nil {
+			// the actual state. A Flink job which has ended is not final
+			// while the job submitter is active, because the submitter may
+			// resubmit it.
+			if flinkJobID == nil ||
+				flinkJobState == v1alpha1.JobState.Pending {
 				status.Components.Job.State = v1alpha1.JobState.Pending
 			} else {
 				status.Components.Job.State = v1alpha1.JobState.Running
 			}
-		} else if observedJob.Status.Failed > 0 {
-			status.Components.Job.State = v1alpha1.JobState.Failed
-			jobFinished = true
-		} else if observedJob.Status.Succeeded > 0 {
-			status.Components.Job.State = v1alpha1.JobState.Succeeded
-			jobFinished = true
-			jobSucceeded = true
+		} else if observedJob.Status.Failed > 0 ||
+			observedJob.Status.Succeeded > 0 {
+			var state = flinkJobState
+			if !isJobStateFinal(state) && observedJob.Status.Failed > 0 {
+				state = v1alpha1.JobState.Failed
+			} else if !isJobStateFinal(state) {
+				state = v1alpha1.JobState.Succeeded
+			}
+			status.Components.Job.State = state
+			jobFinished, jobSucceeded = getJobCompletion(state, observed.cluster)
+		} else if len(status.Components.Job.UpgradePhase) > 0 ||
+			len(status.Components.Job.NextRestartTime) > 0 {
+			status.Components.Job.State = v1alpha1.JobState.Pending
 		} else {
 			status.Components.Job = nil
 		}
+	} else if recordedJobStatus != nil &&
+		(len(recordedJobStatus.UpgradePhase) > 0 ||
+			len(recordedJobStatus.StopPhase) > 0 ||
+			len(recordedJobStatus.NextRestartTime) > 0) {
+		// The job resource is being recreated for an upgrade or a restart, or
+		// has been deleted to stop the job with a final savepoint.
+		status.Components.Job = recordedJobStatus.DeepCopy()
+	} else if recordedJobStatus != nil && len(recordedJobStatus.Name) == 0 {
+		// The job submitted through the Flink REST API has no job submitter,
+		// its state is derived from the Flink job alone.
+		status.Components.Job = recordedJobStatus.DeepCopy()
+		var flinkJobState = deriveFlinkJobState(observed, status.Components.Job)
+		if len(flinkJobState) > 0 {
+			status.Components.Job.State = flinkJobState
+		}
+		if isJobStateFinal(status.Components.Job.State) {
+			jobFinished, jobSucceeded = getJobCompletion(
+				status.Components.Job.State, observed.cluster)
+		}
+	}
+
+	// The savepoint settings are recorded while the job is in the spec, the
+	// job is stopped with them after it is removed from the spec.
+	if status.Components.Job != nil && observed.cluster.Spec.Job != nil {
+		var jobSpec = observed.cluster.Spec.Job
+		status.Components.Job.SavepointsDir = ""
+		if jobSpec.SavepointsDir != nil {
+			status.Components.Job.SavepointsDir = *jobSpec.SavepointsDir
+		}
+		status.Components.Job.FinalSavepointTimeoutSeconds = nil
+		if jobSpec.FinalSavepointTimeoutSeconds != nil {
+			var timeout = *jobSpec.FinalSavepointTimeoutSeconds
+			status.Components.Job.FinalSavepointTimeoutSeconds = &timeout
+		}
 	}
 
 	// Derive the new cluster state.
@@ -390,7 +506,7 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 		}
 	case v1alpha1.ClusterState.Running,
 		v1alpha1.ClusterState.Reconciling:
-		if jobFinished {
+		if jobFinished && observed.cluster.Spec.Job != nil {
 			var policy = observed.cluster.Spec.Job.CleanupPolicy
 			if jobSucceeded &&
 				policy.AfterJobSucceeds != v1alpha1.CleanupActionKeepCluster {
@@ -424,6 +540,252 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 	return status
 }
 
+// Sets the status of the observed Flink job of the job status, and returns
+// the job state derived from the state of the Flink job, or empty if the Flink
+// job is not observed.
+func deriveFlinkJobState(
+	observed *ObservedClusterState, jobStatus *v1alpha1.JobStatus) string {
+	if observed.flinkJob == nil || observed.flinkJob.ID != jobStatus.ID {
+		return ""
+	}
+	setFlinkJobStatus(observed, jobStatus)
+	var thresholdSeconds *int32
+	if observed.cluster.Spec.Job != nil {
+		thresholdSeconds = observed.cluster.Spec.Job.CheckpointStaleThresholdSeconds
+	}
+	setCheckpointStaleCondition(jobStatus, thresholdSeconds, time.Now())
+	return getJobStateFromFlinkJobState(observed.flinkJob.State)
+}
+
+// Gets whether the job in the final state has finished, i.e., it is not going
+// to be restarted, and whether it has succeeded.
+func getJobCompletion(
+	state string, cluster *v1alpha1.FlinkCluster) (finished bool, succeeded bool) {
+	switch state {
+	case v1alpha1.JobState.Failed:
+		// The cluster is kept for restarting the failed job.
+		return !canRestartJob(cluster), false
+	case v1alpha1.JobState.Succeeded:
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// Sets the details of the observed Flink job to the job status.
+func setFlinkJobStatus(
+	observed *ObservedClusterState, jobStatus *v1alpha1.JobStatus) {
+	var tc = &TimeConverter{}
+	var flinkJob = observed.flinkJob
+	jobStatus.FlinkJobState = flinkJob.State
+	jobStatus.StartTime = ""
+	if flinkJob.StartTime > 0 {
+		jobStatus.StartTime = tc.ToString(
+			time.Unix(0, flinkJob.StartTime*int64(time.Millisecond)))
+	}
+	// The duration keeps changing while the job is running, it is only
+	// recorded when the job has ended to avoid updating the status on every
+	// reconcile.
+	jobStatus.EndTime = ""
+	jobStatus.Duration = ""
+	if flinkJob.EndTime > 0 {
+		jobStatus.EndTime = tc.ToString(
+			time.Unix(0, flinkJob.EndTime*int64(time.Millisecond)))
+		jobStatus.Duration = (time.Duration(flinkJob.Duration) *
+			time.Millisecond).Round(time.Second).String()
+	}
+	if observed.flinkJobRestarts != nil {
+		jobStatus.FlinkRestartCount = *observed.flinkJobRestarts
+	}
+	// The last failure is kept after the job recovers.
+	var exceptions = observed.flinkJobExceptions
+	if exceptions != nil && len(exceptions.RootException) > 0 {
+		jobStatus.FailureReason = truncateFailureReason(exceptions.RootException)
+		jobStatus.FailureTime = tc.ToString(
+			time.Unix(0, exceptions.Timestamp*int64(time.Millisecond)))
+	}
+	if observed.flinkJobCheckpoints != nil {
+		jobStatus.Checkpoints = getCheckpointStatus(observed.flinkJobCheckpoints)
+	}
+	jobStatus.Vertices = nil
+	for _, vertex := range flinkJob.Vertices {
+		jobStatus.Vertices = append(jobStatus.Vertices, v1alpha1.JobVertexStatus{
+			ID:          vertex.ID,
+			Name:        vertex.Name,
+			Parallelism: vertex.Parallelism,
+		})
+	}
+}
+
+// Gets the jobs in a session cluster, ordered by their start time.
+func getSessionJobs(overview *flinkclient.JobsOverview) []v1alpha1.JobInfo {
+	var tc = &TimeConverter{}
+	var flinkJobs = make([]flinkclient.JobOverview, len(overview.Jobs))
+	copy(flinkJobs, overview.Jobs)
+	sort.SliceStable(flinkJobs, func(i, j int) bool {
+		if flinkJobs[i].StartTime != flinkJobs[j].StartTime {
+			return flinkJobs[i].StartTime < flinkJobs[j].StartTime
+		}
+		return flinkJobs[i].ID < flinkJobs[j].ID
+	})
+	var jobs []v1alpha1.JobInfo
+	for _, flinkJob := range flinkJobs {
+		var job = v1alpha1.JobInfo{
+			ID:    flinkJob.ID,
+			Name:  flinkJob.Name,
+			State: flinkJob.State,
+		}
+		if flinkJob.StartTime > 0 {
+			job.StartTime = tc.ToString(
+				time.Unix(0, flinkJob.StartTime*int64(time.Millisecond)))
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// Gets the checkpoint statistics of a job in the job status.
+func getCheckpointStatus(
+	checkpoints *flinkclient.JobCheckpoints) *v1alpha1.CheckpointStatus {
+	var tc = &TimeConverter{}
+	var status = &v1alpha1.CheckpointStatus{
+		CompletedCount: checkpoints.Counts.Completed,
+		FailedCount:    checkpoints.Counts.Failed,
+	}
+	var completed = checkpoints.Latest.Completed
+	if completed != nil {
+		status.LatestCompleted = &v1alpha1.CompletedCheckpoint{
+			ID:   completed.ID,
+			Path: completed.ExternalPath,
+			Time: tc.ToString(time.Unix(
+				0, completed.LatestAckTimestamp*int64(time.Millisecond))),
+			StateSize: completed.StateSize,
+			Duration: (time.Duration(completed.EndToEndDuration) *
+				time.Millisecond).String(),
+		}
+	}
+	return status
+}
+
+// Sets the CheckpointStale condition of the job, which is true when no
+// checkpoint has completed within the threshold since the latest completed
+// checkpoint, or since the start of the job if there is none. The condition is
+// removed if there is no threshold.
+func setCheckpointStaleCondition(
+	jobStatus *v1alpha1.JobStatus, thresholdSeconds *int32, now time.Time) {
+	if thresholdSeconds == nil {
+		removeJobCondition(jobStatus, v1alpha1.JobConditionType.CheckpointStale)
+		return
+	}
+	if len(jobStatus.EndTime) > 0 {
+		setJobCondition(jobStatus, v1alpha1.JobCondition{
+			Type:    v1alpha1.JobConditionType.CheckpointStale,
+			Status:  corev1.ConditionFalse,
+			Reason:  "JobEnded",
+			Message: "The job has ended",
+		}, now)
+		return
+	}
+
+	var tc = &TimeConverter{}
+	var lastTime = jobStatus.StartTime
+	if jobStatus.Checkpoints != nil &&
+		jobStatus.Checkpoints.LatestCompleted != nil {
+		lastTime = jobStatus.Checkpoints.LatestCompleted.Time
+	}
+	if len(lastTime) == 0 {
+		return
+	}
+	var threshold = time.Duration(*thresholdSeconds) * time.Second
+	if now.Sub(tc.FromString(lastTime)) > threshold {
+		setJobCondition(jobStatus, v1alpha1.JobCondition{
+			Type:   v1alpha1.JobConditionType.CheckpointStale,
+			Status: corev1.ConditionTrue,
+			Reason: "NoRecentCheckpoint",
+			Message: fmt.Sprintf(
+				"No checkpoint has completed since %v, the threshold is %v",
+				lastTime,
+				threshold),
+		}, now)
+	} else {
+		setJobCondition(jobStatus, v1alpha1.JobCondition{
+			Type:    v1alpha1.JobConditionType.CheckpointStale,
+			Status:  corev1.ConditionFalse,
+			Reason:  "CheckpointCompleted",
+			Message: "A checkpoint has completed within the threshold",
+		}, now)
+	}
+}
+
+// Adds or updates the condition of the job, the transition time only changes
+// when the status of the condition changes.
+func setJobCondition(
+	jobStatus *v1alpha1.JobStatus,
+	condition v1alpha1.JobCondition,
+	now time.Time) {
+	var tc = &TimeConverter{}
+	for i := range jobStatus.Conditions {
+		var existing = &jobStatus.Conditions[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+		condition.LastTransitionTime = existing.LastTransitionTime
+		if existing.Status != condition.Status {
+			condition.LastTransitionTime = tc.ToString(now)
+		}
+		*existing = condition
+		return
+	}
+	condition.LastTransitionTime = tc.ToString(now)
+	jobStatus.Conditions = append(jobStatus.Conditions, condition)
+}
+
+// Removes the condition of the given type from the job.
+func removeJobCondition(jobStatus *v1alpha1.JobStatus, conditionType string) {
+	var conditions []v1alpha1.JobCondition
+	for _, condition := range jobStatus.Conditions {
+		if condition.Type != conditionType {
+			conditions = append(conditions, condition)
+		}
+	}
+	jobStatus.Conditions = conditions
+}
+
+// Truncates the root exception of a job failure, which is a stack trace, so
+// that it fits in the status and events.
+func truncateFailureReason(rootException string) string {
+	var reason = strings.TrimSpace(rootException)
+	if len(reason) > maxFailureReasonLength {
+		reason = reason[:maxFailureReasonLength-3] + "..."
+	}
+	return reason
+}
+
+// Gets the job state which corresponds to the state of the Flink job, empty if
+// there is none, e.g., the job is suspended.
+func getJobStateFromFlinkJobState(flinkJobState string) string {
+	switch flinkJobState {
+	case "INITIALIZING", "CREATED":
+		return v1alpha1.JobState.Pending
+	case "RUNNING", "FAILING", "RESTARTING", "RECONCILING", "CANCELLING":
+		return v1alpha1.JobState.Running
+	case "FINISHED":
+		return v1alpha1.JobState.Succeeded
+	case "FAILED":
+		return v1alpha1.JobState.Failed
+	case "CANCELED":
+		return v1alpha1.JobState.Cancelled
+	}
+	return ""
+}
+
+// Checks whether the job state is a final state.
+func isJobStateFinal(state string) bool {
+	return state == v1alpha1.JobState.Succeeded ||
+		state == v1alpha1.JobState.Failed ||
+		state == v1alpha1.JobState.Cancelled
+}
+
 // Gets Flink job ID based on the observed state and the recorded state.
 //
 // It is possible that the recorded is not nil, but the observed is, due
@@ -515,6 +877,18 @@ func (updater *ClusterStatusUpdater) isStatusChanged(
 			newStatus.Components.TaskManagerDeployment)
 		changed = true
 	}
+	if newStatus.TaskManagerReplicas != currentStatus.TaskManagerReplicas ||
+		newStatus.TaskManagerSelector != currentStatus.TaskManagerSelector {
+		updater.log.Info(
+			"TaskManager scale status changed",
+			"current",
+			currentStatus.TaskManagerReplicas,
+			"new",
+			newStatus.TaskManagerReplicas,
+			"selector",
+			newStatus.TaskManagerSelector)
+		changed = true
+	}
 	if currentStatus.Components.Job == nil {
 		if newStatus.Components.Job != nil {
 			updater.log.Info(
@@ -525,6 +899,14 @@ func (updater *ClusterStatusUpdater) isStatusChanged(
 				*newStatus.Components.Job)
 			changed = true
 		}
+	} else if newStatus.Components.Job == nil {
+		updater.log.Info(
+			"Job status changed",
+			"current",
+			*currentStatus.Components.Job,
+			"new",
+			"nil")
+		changed = true
 	} else {
 		var isEqual = reflect.DeepEqual(
 			newStatus.Components.Job, currentStatus.Components.Job)
@@ -538,6 +920,16 @@ func (updater *ClusterStatusUpdater) isStatusChanged(
 			changed = true
 		}
 	}
+	if !reflect.DeepEqual(
+		newStatus.Components.Jobs, currentStatus.Components.Jobs) {
+		updater.log.Info(
+			"Session jobs status changed",
+			"current",
+			currentStatus.Components.Jobs,
+			"new",
+			newStatus.Components.Jobs)
+		changed = true
+	}
 	return changed
 }
 
@@ -555,3 +947,10 @@ func getDeploymentState(deployment *appsv1.Deployment) string {
 	}
 	return v1alpha1.ComponentState.NotReady
 }
+
+func getStatefulSetState(statefulSet *appsv1.StatefulSet) string {
+	if statefulSet.Status.ReadyReplicas >= *statefulSet.Spec.Replicas {
+		return v1alpha1.ComponentState.Ready
+	}
+	return v1alpha1.ComponentState.NotReady
+}
@@ -18,10 +18,12 @@ package controllers
 
 import (
 	"testing"
+	"time"
 
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
 	"gotest.tools/assert"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -46,6 +48,20 @@ func TestGetDeploymentStateReady(t *testing.T) {
 	assert.Assert(t, state == v1alpha1.ComponentState.Ready)
 }
 
+func TestGetStatefulSetState(t *testing.T) {
+	var replicas int32 = 2
+	var statefulSet = appsv1.StatefulSet{
+		Spec:   appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status: appsv1.StatefulSetStatus{Replicas: 2, ReadyReplicas: 1},
+	}
+	var state = getStatefulSetState(&statefulSet)
+	assert.Assert(t, state == v1alpha1.ComponentState.NotReady)
+
+	statefulSet.Status.ReadyReplicas = 2
+	state = getStatefulSetState(&statefulSet)
+	assert.Assert(t, state == v1alpha1.ComponentState.Ready)
+}
+
 func TestIsStatusChangedFalse(t *testing.T) {
 	var oldStatus = v1alpha1.FlinkClusterStatus{}
 	var newStatus = v1alpha1.FlinkClusterStatus{}
@@ -106,3 +122,59 @@ func TestIsStatusChangedTrue(t *testing.T) {
 	var updater = &ClusterStatusUpdater{log: log.Log}
 	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus))
 }
+
+func TestGetJobStateFromFlinkJobState(t *testing.T) {
+	assert.Equal(
+		t, getJobStateFromFlinkJobState("CREATED"), v1alpha1.JobState.Pending)
+	assert.Equal(
+		t, getJobStateFromFlinkJobState("RESTARTING"), v1alpha1.JobState.Running)
+	assert.Equal(
+		t, getJobStateFromFlinkJobState("FINISHED"), v1alpha1.JobState.Succeeded)
+	assert.Equal(
+		t, getJobStateFromFlinkJobState("FAILED"), v1alpha1.JobState.Failed)
+	assert.Equal(
+		t, getJobStateFromFlinkJobState("CANCELED"), v1alpha1.JobState.Cancelled)
+	assert.Equal(t, getJobStateFromFlinkJobState("SUSPENDED"), "")
+}
+
+func TestSetCheckpointStaleCondition(t *testing.T) {
+	var tc = &TimeConverter{}
+	var now = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	var threshold int32 = 60
+	var jobStatus = v1alpha1.JobStatus{
+		StartTime: tc.ToString(now.Add(-5 * time.Minute)),
+	}
+
+	// No checkpoint has completed since the job started.
+	setCheckpointStaleCondition(&jobStatus, &threshold, now)
+	assert.Equal(t, len(jobStatus.Conditions), 1)
+	var condition = jobStatus.Conditions[0]
+	assert.Equal(t, condition.Type, v1alpha1.JobConditionType.CheckpointStale)
+	assert.Equal(t, condition.Status, corev1.ConditionTrue)
+	assert.Equal(t, condition.Reason, "NoRecentCheckpoint")
+	assert.Equal(t, condition.LastTransitionTime, tc.ToString(now))
+
+	// A checkpoint completes.
+	var later = now.Add(time.Minute)
+	jobStatus.Checkpoints = &v1alpha1.CheckpointStatus{
+		LatestCompleted: &v1alpha1.CompletedCheckpoint{
+			ID:   1,
+			Time: tc.ToString(later.Add(-10 * time.Second)),
+		},
+		CompletedCount: 1,
+	}
+	setCheckpointStaleCondition(&jobStatus, &threshold, later)
+	assert.Equal(t, len(jobStatus.Conditions), 1)
+	condition = jobStatus.Conditions[0]
+	assert.Equal(t, condition.Status, corev1.ConditionFalse)
+	assert.Equal(t, condition.LastTransitionTime, tc.ToString(later))
+
+	// The transition time does not change while the status is the same.
+	setCheckpointStaleCondition(&jobStatus, &threshold, later.Add(time.Second))
+	assert.Equal(
+		t, jobStatus.Conditions[0].LastTransitionTime, tc.ToString(later))
+
+	// The condition is removed without a threshold.
+	setCheckpointStaleCondition(&jobStatus, nil, later)
+	assert.Equal(t, len(jobStatus.Conditions), 0)
+}
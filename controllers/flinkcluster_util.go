@@ -17,18 +17,500 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-logr/logr"
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"github.com/googlecloudplatform/flink-operator/controllers/jarstorage"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func getFlinkAPIBaseURL(cluster *v1alpha1.FlinkCluster) string {
-	return fmt.Sprintf(
-		"http://%s.%s.svc.cluster.local:%d",
-		getJobManagerServiceName(cluster.ObjectMeta.Name),
-		cluster.ObjectMeta.Namespace,
-		*cluster.Spec.JobManager.Ports.UI)
+const (
+	// The finalizer which makes sure the final savepoint of the job is taken
+	// before the cluster is deleted.
+	finalSavepointFinalizer = "flinkoperator.k8s.io/final-savepoint"
+
+	// Setting the annotation to "true" makes the operator stop the job without
+	// taking the final savepoint, e.g., when the job is in an unhealthy state.
+	skipFinalSavepointAnnotation = "flinkoperator.k8s.io/skip-final-savepoint"
+
+	// The default timeout of the final savepoint.
+	defaultFinalSavepointTimeoutSeconds = 300
+
+	// The number of savepoints in the history if the retention is not enabled.
+	defaultSavepointHistoryLength = 10
+
+	// The time after which a savepoint is considered failed if its status
+	// cannot be checked, e.g., the trigger is lost after JobManager restarts.
+	savepointStatusTimeout = 10 * time.Minute
+
+	// The maximum length of the failure reason of a job in its status and
+	// events.
+	maxFailureReasonLength = 1024
+
+	// The deadline of a reconcile request, which bounds the time spent on the
+	// Flink API requests when the JobManager is unresponsive.
+	reconcileTimeout = 2 * time.Minute
+
+	// The default maximum number of restarts of a failed job with the
+	// FromSavepointOnFailure restart policy.
+	defaultMaxJobRestarts = 3
+
+	// The backoff before the first restart of a failed job, it doubles with
+	// each restart up to the max.
+	jobRestartBackoffBase = 10 * time.Second
+	jobRestartBackoffMax  = 5 * time.Minute
+
+	// The finalizer which makes sure the job of a FlinkSessionJob is cancelled
+	// before the resource is deleted.
+	sessionJobFinalizer = "flinkoperator.k8s.io/cancel-session-job"
+
+	// The key of the CA certificate in the secret of the REST TLS.
+	restCACertKey = "ca.crt"
+
+	// The default domain suffix of the cluster DNS names.
+	defaultClusterDomain = "cluster.local"
+)
+
+// FlinkAPIAccessMode defines how the operator reaches the Flink REST API of
+// the JobManagers.
+var FlinkAPIAccessMode = struct {
+	DNS       string
+	ClusterIP string
+	Ingress   string
+	Proxy     string
+}{
+	DNS:       "DNS",
+	ClusterIP: "ClusterIP",
+	Ingress:   "Ingress",
+	Proxy:     "Proxy",
+}
+
+// FlinkAPIAccess defines how the operator reaches the Flink REST API of the
+// JobManagers. The zero value reaches them through the cluster DNS, which
+// works when the operator runs in the Kubernetes cluster.
+type FlinkAPIAccess struct {
+	// One of FlinkAPIAccessMode: the JobManager service through the cluster
+	// DNS, its cluster IP, the URL of the JobManager ingress, or the service
+	// proxy of the Kubernetes API server, default: DNS.
+	Mode string
+
+	// The domain suffix of the cluster DNS names, default: "cluster.local".
+	ClusterDomain string
+
+	// The config of the Kubernetes API server, required by the Proxy mode.
+	KubeConfig *rest.Config
+
+	// The timeout of each attempt of a Flink API request, default: 10s.
+	Timeout time.Duration
+
+	// The maximum number of retries of a failed Flink API GET request,
+	// default: 2, negative for no retries.
+	MaxRetries int
+}
+
+// Validate checks the access mode and its config.
+func (access FlinkAPIAccess) Validate() error {
+	if access.Timeout < 0 {
+		return fmt.Errorf("invalid Flink API timeout: %v", access.Timeout)
+	}
+	switch access.Mode {
+	case "", FlinkAPIAccessMode.DNS, FlinkAPIAccessMode.ClusterIP,
+		FlinkAPIAccessMode.Ingress:
+		return nil
+	case FlinkAPIAccessMode.Proxy:
+		if access.KubeConfig == nil {
+			return fmt.Errorf("Kubernetes API server config is required by Proxy mode")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid Flink API access mode: %v", access.Mode)
+}
+
+// Creates a client of the Flink REST API with the timeout and the retries of
+// the access, it is configured for a cluster by configureFlinkClient.
+func (access FlinkAPIAccess) newFlinkClient(
+	log logr.Logger) flinkclient.FlinkClient {
+	return &flinkclient.RESTClient{
+		Log: log,
+		HTTPClient: flinkclient.HTTPClient{
+			Log:        log,
+			Timeout:    access.Timeout,
+			MaxRetries: access.MaxRetries,
+		},
+	}
+}
+
+// Submits a job through the Flink REST API: reads the JAR file from the JAR
+// storage, uploads it to the cluster and runs it with the request. The
+// uploaded JAR is deleted once the job has been submitted. Returns the ID of
+// the Flink job.
+func submitJar(
+	ctx context.Context,
+	flinkClient flinkclient.FlinkClient,
+	jarStorage *jarstorage.Registry,
+	apiBaseURL string,
+	jarFile string,
+	request flinkclient.JarRunRequest,
+	log logr.Logger) (string, error) {
+	var jar, err = jarStorage.ReadJar(ctx, jarFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read JAR file %v: %v", jarFile, err)
+	}
+	log.Info("Uploading JAR file", "jarFile", jarFile)
+	jarID, err := flinkClient.UploadJar(
+		ctx, apiBaseURL, getJarFileName(jarFile), jar)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload JAR file: %v", err)
+	}
+	defer func() {
+		var err = flinkClient.DeleteJar(ctx, apiBaseURL, jarID)
+		if err != nil {
+			log.Info("Failed to delete JAR file", "jarID", jarID, "error", err)
+		}
+	}()
+	log.Info("Running JAR file", "jarID", jarID, "request", request)
+	jobID, err := flinkClient.RunJar(ctx, apiBaseURL, jarID, request)
+	if err != nil {
+		return "", fmt.Errorf("failed to run JAR file: %v", err)
+	}
+	return jobID, nil
+}
+
+// The result of a savepoint, which is shared by the controllers which take
+// savepoints, so that they record the same failure reasons.
+type savepointResult struct {
+	// The savepoint has completed, it succeeded with the location, or failed
+	// with the reason.
+	completed     bool
+	location      string
+	failureReason string
+}
+
+func (result savepointResult) failed() bool {
+	return result.completed && len(result.location) == 0
+}
+
+// Gets the result of the savepoint which cannot be triggered.
+func getSavepointTriggerFailure(err error) savepointResult {
+	return savepointResult{
+		completed:     true,
+		failureReason: fmt.Sprintf("Failed to trigger savepoint: %v", err),
+	}
+}
+
+// Triggers a savepoint of the job to the dir, the job is cancelled after the
+// savepoint succeeds if cancel is true. Returns the trigger ID, or the failed
+// result if the savepoint cannot be triggered.
+func triggerSavepoint(
+	ctx context.Context,
+	flinkClient flinkclient.FlinkClient,
+	apiBaseURL string,
+	jobID string,
+	dir string,
+	cancel bool,
+	log logr.Logger) (string, savepointResult) {
+	log.Info("Triggering savepoint", "jobID", jobID, "cancel", cancel)
+	var triggerID, err = flinkClient.TriggerSavepoint(
+		ctx, apiBaseURL, jobID, dir, cancel)
+	if err != nil {
+		log.Info("Failed to trigger savepoint", "error", err)
+		return "", getSavepointTriggerFailure(err)
+	}
+	return triggerID.RequestID, savepointResult{}
+}
+
+// Checks the status of the savepoint in progress. The savepoint fails if its
+// operation is not found, e.g., the JobManager has restarted, or its status
+// cannot be checked until the timeout after it was triggered. Returns the
+// error of the check which is to be retried.
+func checkSavepointStatus(
+	ctx context.Context,
+	flinkClient flinkclient.FlinkClient,
+	apiBaseURL string,
+	jobID string,
+	triggerID string,
+	triggerTime string,
+	log logr.Logger) (savepointResult, error) {
+	var tc = &TimeConverter{}
+	var status, err = flinkClient.GetSavepointStatus(
+		ctx, apiBaseURL, jobID, triggerID)
+	log.Info("Savepoint status.", "status", status, "error", err)
+	if flinkclient.IsNotFound(err) {
+		return savepointResult{
+			completed:     true,
+			failureReason: fmt.Sprintf("Savepoint operation not found: %v", err),
+		}, nil
+	}
+	if err != nil {
+		if time.Now().After(
+			tc.FromString(triggerTime).Add(savepointStatusTimeout)) {
+			return savepointResult{
+				completed: true,
+				failureReason: fmt.Sprintf(
+					"Failed to check savepoint status: %v", err),
+			}, nil
+		}
+		return savepointResult{}, err
+	}
+	if !status.Completed {
+		return savepointResult{}, nil
+	}
+	if len(status.Location) == 0 {
+		return savepointResult{
+			completed:     true,
+			failureReason: getSavepointFailureReason(status.FailureCause),
+		}, nil
+	}
+	return savepointResult{completed: true, location: status.Location}, nil
+}
+
+// Gets the base URL of the Flink REST API of the cluster which the operator
+// reaches it with. It fails when the address is not available yet, e.g., the
+// service has no cluster IP or the ingress has no URL.
+func getFlinkAPIBaseURL(
+	ctx context.Context,
+	k8sClient client.Client,
+	cluster *v1alpha1.FlinkCluster,
+	access FlinkAPIAccess) (string, error) {
+	var scheme = "http"
+	if isRESTTLSEnabled(cluster) {
+		scheme = "https"
+	}
+	if cluster.Spec.JobManager.Ports.UI == nil {
+		return "", fmt.Errorf("JobManager UI port is unspecified")
+	}
+	var namespace = cluster.ObjectMeta.Namespace
+	var serviceName = getJobManagerServiceName(cluster.ObjectMeta.Name)
+	var port = *cluster.Spec.JobManager.Ports.UI
+
+	switch access.Mode {
+	case "", FlinkAPIAccessMode.DNS:
+		var domain = access.ClusterDomain
+		if len(domain) == 0 {
+			domain = defaultClusterDomain
+		}
+		return fmt.Sprintf(
+			"%s://%s.%s.svc.%s:%d", scheme, serviceName, namespace, domain, port), nil
+	case FlinkAPIAccessMode.ClusterIP:
+		var service = &corev1.Service{}
+		var err = k8sClient.Get(
+			ctx,
+			types.NamespacedName{Namespace: namespace, Name: serviceName},
+			service)
+		if err != nil {
+			return "", fmt.Errorf("failed to get JobManager service: %v", err)
+		}
+		var clusterIP = service.Spec.ClusterIP
+		if len(clusterIP) == 0 || clusterIP == corev1.ClusterIPNone {
+			return "", fmt.Errorf("JobManager service has no cluster IP")
+		}
+		return fmt.Sprintf("%s://%s:%d", scheme, clusterIP, port), nil
+	case FlinkAPIAccessMode.Ingress:
+		var ingressStatus = cluster.Status.Components.JobManagerIngress
+		if ingressStatus == nil || len(ingressStatus.URLs) == 0 {
+			return "", fmt.Errorf("JobManager ingress has no URL")
+		}
+		return strings.TrimSuffix(ingressStatus.URLs[0], "/"), nil
+	case FlinkAPIAccessMode.Proxy:
+		var host = strings.TrimSuffix(access.KubeConfig.Host, "/")
+		if !strings.Contains(host, "://") {
+			host = "https://" + host
+		}
+		return fmt.Sprintf(
+			"%s/api/v1/namespaces/%s/services/%s:%s:%d/proxy",
+			host, namespace, scheme, serviceName, port), nil
+	}
+	return "", fmt.Errorf("invalid Flink API access mode: %v", access.Mode)
+}
+
+func isRESTTLSEnabled(cluster *v1alpha1.FlinkCluster) bool {
+	return cluster.Spec.RESTSecurity != nil &&
+		cluster.Spec.RESTSecurity.TLS != nil
+}
+
+// Checks whether the TaskManagers run as a StatefulSet, i.e., they have
+// persistent volumes for the local state.
+func isTaskManagerStatefulSet(cluster *v1alpha1.FlinkCluster) bool {
+	return len(cluster.Spec.TaskManager.VolumeClaimTemplates) > 0
+}
+
+// Checks whether the JobManager HA uses the Kubernetes HA services.
+func isKubernetesHAEnabled(cluster *v1alpha1.FlinkCluster) bool {
+	var haSpec = cluster.Spec.HighAvailability
+	return haSpec != nil && haSpec.Mode == v1alpha1.HighAvailabilityMode.Kubernetes
+}
+
+// Configures the client of the Flink REST API of the cluster with the TLS
+// certificates and the auth headers of the REST security spec, which are read
+// from the secrets in the namespace of the cluster. Clients other than the
+// REST client, e.g., fakes, are not configured.
+//
+// Through the service proxy of the Kubernetes API server, the requests are
+// authenticated by the credentials of the operator instead of the client
+// certificate, and the proxy connects to the REST API.
+func configureFlinkClient(
+	ctx context.Context,
+	k8sClient client.Client,
+	cluster *v1alpha1.FlinkCluster,
+	flinkClient flinkclient.FlinkClient,
+	access FlinkAPIAccess) error {
+	var restClient, ok = flinkClient.(*flinkclient.RESTClient)
+	if !ok {
+		return nil
+	}
+	if access.Mode == FlinkAPIAccessMode.Proxy {
+		var transport, err = rest.TransportFor(access.KubeConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create Kubernetes API transport: %v", err)
+		}
+		restClient.HTTPClient.Transport = transport
+	}
+	var securitySpec = cluster.Spec.RESTSecurity
+	if securitySpec == nil {
+		return nil
+	}
+	var getSecretData = func(name string) (map[string][]byte, error) {
+		var secret = &corev1.Secret{}
+		var err = k8sClient.Get(
+			ctx,
+			types.NamespacedName{
+				Namespace: cluster.ObjectMeta.Namespace,
+				Name:      name,
+			},
+			secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret %v: %v", name, err)
+		}
+		return secret.Data, nil
+	}
+
+	if securitySpec.TLS != nil && access.Mode != FlinkAPIAccessMode.Proxy {
+		var caData, err = getSecretData(securitySpec.TLS.CASecret)
+		if err != nil {
+			return err
+		}
+		var clientCert, clientKey []byte
+		if securitySpec.TLS.ClientCertSecret != nil {
+			certData, err := getSecretData(*securitySpec.TLS.ClientCertSecret)
+			if err != nil {
+				return err
+			}
+			clientCert = certData[corev1.TLSCertKey]
+			clientKey = certData[corev1.TLSPrivateKeyKey]
+		}
+		transport, err := flinkclient.GetTLSTransport(
+			caData[restCACertKey], clientCert, clientKey)
+		if err != nil {
+			return fmt.Errorf("invalid REST TLS certificates: %v", err)
+		}
+		restClient.HTTPClient.Transport = transport
+	}
+
+	if securitySpec.AuthHeadersSecret != nil {
+		var headerData, err = getSecretData(*securitySpec.AuthHeadersSecret)
+		if err != nil {
+			return err
+		}
+		var headers = map[string]string{}
+		for name, value := range headerData {
+			headers[name] = string(value)
+		}
+		restClient.HTTPClient.Headers = headers
+	}
+	return nil
+}
+
+// Gets the savepoints dir of the job, the one recorded in the job status if the
+// job has been removed from the spec. It falls back to the default savepoints
+// dir in the Flink properties.
+func getSavepointsDir(cluster *v1alpha1.FlinkCluster) string {
+	var jobSpec = cluster.Spec.Job
+	var jobStatus = cluster.Status.Components.Job
+	if jobSpec != nil && jobSpec.SavepointsDir != nil {
+		return *jobSpec.SavepointsDir
+	}
+	// The job has been removed from the spec.
+	if jobSpec == nil && jobStatus != nil && len(jobStatus.SavepointsDir) > 0 {
+		return jobStatus.SavepointsDir
+	}
+	return cluster.Spec.FlinkProperties["state.savepoints.dir"]
+}
+
+// Gets the timeout of the final savepoint of the job, the one recorded in the
+// job status if the job has been removed from the spec.
+func getFinalSavepointTimeoutSeconds(cluster *v1alpha1.FlinkCluster) int32 {
+	var jobSpec = cluster.Spec.Job
+	var jobStatus = cluster.Status.Components.Job
+	if jobSpec != nil && jobSpec.FinalSavepointTimeoutSeconds != nil {
+		return *jobSpec.FinalSavepointTimeoutSeconds
+	}
+	if jobSpec == nil && jobStatus != nil &&
+		jobStatus.FinalSavepointTimeoutSeconds != nil {
+		return *jobStatus.FinalSavepointTimeoutSeconds
+	}
+	return defaultFinalSavepointTimeoutSeconds
+}
+
+func getMaxJobRestarts(cluster *v1alpha1.FlinkCluster) int32 {
+	var jobSpec = cluster.Spec.Job
+	if jobSpec != nil && jobSpec.MaxRestarts != nil {
+		return *jobSpec.MaxRestarts
+	}
+	return defaultMaxJobRestarts
+}
+
+// Checks whether the operator should restart the job when it fails, i.e., the
+// restart policy is FromSavepointOnFailure and it has restarts left.
+func canRestartJob(cluster *v1alpha1.FlinkCluster) bool {
+	var jobSpec = cluster.Spec.Job
+	var jobStatus = cluster.Status.Components.Job
+	if jobSpec == nil || jobSpec.RestartPolicy == nil ||
+		string(*jobSpec.RestartPolicy) !=
+			v1alpha1.JobRestartPolicy.FromSavepointOnFailure {
+		return false
+	}
+	return jobStatus == nil || jobStatus.RestartCount < getMaxJobRestarts(cluster)
+}
+
+// Gets the backoff before restarting the job which has been restarted for the
+// given number of times.
+func getJobRestartBackoff(restartCount int32) time.Duration {
+	var backoff = jobRestartBackoffBase
+	for i := int32(0); i < restartCount; i++ {
+		backoff *= 2
+		if backoff >= jobRestartBackoffMax {
+			return jobRestartBackoffMax
+		}
+	}
+	return backoff
+}
+
+// Gets the number of task slots of each TaskManager, 1 if it is not set in the
+// Flink properties like the default of Flink.
+func getTaskSlotsPerTaskManager(cluster *v1alpha1.FlinkCluster) int32 {
+	var slots, err = strconv.ParseInt(
+		cluster.Spec.FlinkProperties["taskmanager.numberOfTaskSlots"], 10, 32)
+	if err != nil || slots < 1 {
+		return 1
+	}
+	return int32(slots)
+}
+
+// Checks whether the Flink rescale API works in the Flink version. It was
+// introduced in 1.5 and has been disabled since 1.9, see FLINK-12312.
+func isRescaleAPISupported(flinkVersion string) bool {
+	var major, minor int
+	var _, err = fmt.Sscanf(flinkVersion, "%d.%d", &major, &minor)
+	return err == nil && major == 1 && minor >= 5 && minor < 9
 }
 
 // Gets JobManager ingress name
@@ -41,6 +523,16 @@ func getJobManagerDeploymentName(clusterName string) string {
 	return clusterName + "-jobmanager"
 }
 
+// Gets JobManager StatefulSet name
+func getJobManagerStatefulSetName(clusterName string) string {
+	return clusterName + "-jobmanager"
+}
+
+// Gets the name of the headless service of the JobManager StatefulSet
+func getJobManagerHeadlessServiceName(clusterName string) string {
+	return clusterName + "-jobmanager-headless"
+}
+
 // Gets JobManager service name
 func getJobManagerServiceName(clusterName string) string {
 	return clusterName + "-jobmanager"
@@ -56,6 +548,22 @@ func getTaskManagerDeploymentName(clusterName string) string {
 	return clusterName + "-taskmanager"
 }
 
+// Gets the name of the service account, role and role binding of the
+// Kubernetes HA services
+func getHAServiceAccountName(clusterName string) string {
+	return clusterName + "-ha"
+}
+
+// Gets TaskManager StatefulSet name
+func getTaskManagerStatefulSetName(clusterName string) string {
+	return clusterName + "-taskmanager"
+}
+
+// Gets the name of the headless service of the TaskManager StatefulSet
+func getTaskManagerHeadlessServiceName(clusterName string) string {
+	return clusterName + "-taskmanager"
+}
+
 // Gets Job name
 func getJobName(clusterName string) string {
 	return clusterName + "-job"
@@ -78,3 +586,31 @@ func (tc *TimeConverter) FromString(timeStr string) time.Time {
 func (tc *TimeConverter) ToString(timestamp time.Time) string {
 	return timestamp.Format(time.RFC3339)
 }
+
+// Checks whether the finalizer is in the list.
+func hasFinalizer(finalizers []string, finalizer string) bool {
+	for _, f := range finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the finalizer from the list.
+func removeFinalizer(finalizers []string, finalizer string) []string {
+	var result = []string{}
+	for _, f := range finalizers {
+		if f != finalizer {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// Checks whether the FlinkSavepoint has succeeded.
+func isSavepointSucceeded(savepoint *v1alpha1.FlinkSavepoint) bool {
+	return savepoint != nil &&
+		savepoint.Status.State == v1alpha1.FlinkSavepointState.Succeeded &&
+		len(savepoint.Status.Location) > 0
+}
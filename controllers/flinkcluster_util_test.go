@@ -17,9 +17,24 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient/fake"
 	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	k8sfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 func TestTimeConverter(t *testing.T) {
@@ -35,3 +50,329 @@ func TestTimeConverter(t *testing.T) {
 	var str4 = tc.ToString(tm2)
 	assert.Assert(t, str3 == str4)
 }
+
+func TestFinalizers(t *testing.T) {
+	var finalizers = []string{"foo", finalSavepointFinalizer}
+	assert.Assert(t, hasFinalizer(finalizers, finalSavepointFinalizer))
+
+	finalizers = removeFinalizer(finalizers, finalSavepointFinalizer)
+	assert.DeepEqual(t, finalizers, []string{"foo"})
+	assert.Assert(t, !hasFinalizer(finalizers, finalSavepointFinalizer))
+}
+
+func TestGetSavepointsDir(t *testing.T) {
+	var savepointsDir = "gs://my-bucket/savepoints"
+	var cluster = v1alpha1.FlinkCluster{
+		Spec: v1alpha1.FlinkClusterSpec{
+			Job: &v1alpha1.JobSpec{SavepointsDir: &savepointsDir},
+			FlinkProperties: map[string]string{
+				"state.savepoints.dir": "gs://my-bucket/default"},
+		},
+	}
+	assert.Equal(t, getSavepointsDir(&cluster), "gs://my-bucket/savepoints")
+
+	cluster.Spec.Job = nil
+	assert.Equal(t, getSavepointsDir(&cluster), "gs://my-bucket/default")
+
+	// The job has been removed from the spec.
+	cluster.Status.Components.Job = &v1alpha1.JobStatus{
+		SavepointsDir: "gs://my-bucket/savepoints"}
+	assert.Equal(t, getSavepointsDir(&cluster), "gs://my-bucket/savepoints")
+}
+
+func TestGetFinalSavepointTimeoutSeconds(t *testing.T) {
+	var timeout int32 = 60
+	var cluster = v1alpha1.FlinkCluster{
+		Spec: v1alpha1.FlinkClusterSpec{
+			Job: &v1alpha1.JobSpec{FinalSavepointTimeoutSeconds: &timeout},
+		},
+	}
+	assert.Equal(t, getFinalSavepointTimeoutSeconds(&cluster), int32(60))
+
+	cluster.Spec.Job = nil
+	assert.Equal(
+		t,
+		getFinalSavepointTimeoutSeconds(&cluster),
+		int32(defaultFinalSavepointTimeoutSeconds))
+
+	// The job has been removed from the spec.
+	cluster.Status.Components.Job = &v1alpha1.JobStatus{
+		FinalSavepointTimeoutSeconds: &timeout}
+	assert.Equal(t, getFinalSavepointTimeoutSeconds(&cluster), int32(60))
+}
+
+func TestCanRestartJob(t *testing.T) {
+	var restartPolicy = corev1.RestartPolicy(
+		v1alpha1.JobRestartPolicy.FromSavepointOnFailure)
+	var maxRestarts int32 = 2
+	var cluster = v1alpha1.FlinkCluster{
+		Spec: v1alpha1.FlinkClusterSpec{
+			Job: &v1alpha1.JobSpec{
+				RestartPolicy: &restartPolicy,
+				MaxRestarts:   &maxRestarts,
+			},
+		},
+		Status: v1alpha1.FlinkClusterStatus{
+			Components: v1alpha1.FlinkClusterComponentsStatus{
+				Job: &v1alpha1.JobStatus{RestartCount: 1},
+			},
+		},
+	}
+	assert.Assert(t, canRestartJob(&cluster))
+
+	cluster.Status.Components.Job.RestartCount = 2
+	assert.Assert(t, !canRestartJob(&cluster))
+
+	restartPolicy = corev1.RestartPolicyOnFailure
+	cluster.Status.Components.Job.RestartCount = 0
+	assert.Assert(t, !canRestartJob(&cluster))
+}
+
+func TestGetJobRestartBackoff(t *testing.T) {
+	assert.Equal(t, getJobRestartBackoff(0), 10*time.Second)
+	assert.Equal(t, getJobRestartBackoff(1), 20*time.Second)
+	assert.Equal(t, getJobRestartBackoff(3), 80*time.Second)
+	assert.Equal(t, getJobRestartBackoff(10), 5*time.Minute)
+}
+
+func TestGetTaskSlotsPerTaskManager(t *testing.T) {
+	var cluster = v1alpha1.FlinkCluster{}
+	assert.Equal(t, getTaskSlotsPerTaskManager(&cluster), int32(1))
+
+	cluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "4"}
+	assert.Equal(t, getTaskSlotsPerTaskManager(&cluster), int32(4))
+
+	cluster.Spec.FlinkProperties["taskmanager.numberOfTaskSlots"] = "many"
+	assert.Equal(t, getTaskSlotsPerTaskManager(&cluster), int32(1))
+}
+
+func TestIsRescaleAPISupported(t *testing.T) {
+	assert.Assert(t, isRescaleAPISupported("1.5.0"))
+	assert.Assert(t, isRescaleAPISupported("1.8.3"))
+	assert.Assert(t, !isRescaleAPISupported("1.4.2"))
+	assert.Assert(t, !isRescaleAPISupported("1.9.1"))
+	assert.Assert(t, !isRescaleAPISupported("1.11.2"))
+	assert.Assert(t, !isRescaleAPISupported("<unknown>"))
+}
+
+func TestConfigureFlinkClient(t *testing.T) {
+	var server = httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer my-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"jobs": [{"id": "job-1", "status": "RUNNING"}]}`))
+		}))
+	defer server.Close()
+	var caCert = pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	var authHeadersSecret = "rest-auth"
+	var cluster = getTestJobCluster()
+	cluster.Spec.RESTSecurity = &v1alpha1.RESTSecuritySpec{
+		TLS: &v1alpha1.RESTTLSSpec{
+			KeystoreSecret: "rest-keystore",
+			CASecret:       "rest-ca",
+		},
+		AuthHeadersSecret: &authHeadersSecret,
+	}
+	var k8sClient = k8sfake.NewFakeClientWithScheme(
+		scheme.Scheme,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "rest-ca"},
+			Data:       map[string][]byte{"ca.crt": caCert},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "rest-auth"},
+			Data: map[string][]byte{
+				"Authorization": []byte("Bearer my-token"),
+			},
+		})
+	var access = FlinkAPIAccess{MaxRetries: -1}
+	var flinkClient = access.newFlinkClient(log.Log)
+	var ctx = context.Background()
+
+	// The server is not trusted without the CA certificate.
+	var jobStatusList flinkclient.JobStatusList
+	var err = flinkClient.GetJobStatusList(ctx, server.URL, &jobStatusList)
+	assert.ErrorContains(t, err, "certificate")
+
+	err = configureFlinkClient(ctx, k8sClient, cluster, flinkClient, access)
+	assert.NilError(t, err)
+	err = flinkClient.GetJobStatusList(ctx, server.URL, &jobStatusList)
+	assert.NilError(t, err)
+	assert.Equal(t, jobStatusList.Jobs[0].ID, "job-1")
+
+	// The secrets must exist.
+	cluster.Spec.RESTSecurity.TLS.CASecret = "unknown"
+	err = configureFlinkClient(ctx, k8sClient, cluster, flinkClient, access)
+	assert.ErrorContains(t, err, "failed to get secret unknown")
+}
+
+func TestGetFlinkAPIBaseURL(t *testing.T) {
+	var cluster = getTestJobCluster()
+	cluster.Default()
+	var k8sClient = k8sfake.NewFakeClientWithScheme(
+		scheme.Scheme,
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "mycluster-jobmanager",
+			},
+			Spec: corev1.ServiceSpec{ClusterIP: "10.0.0.1"},
+		})
+	var getURL = func(access FlinkAPIAccess) string {
+		var url, err = getFlinkAPIBaseURL(
+			context.Background(), k8sClient, cluster, access)
+		assert.NilError(t, err)
+		return url
+	}
+
+	assert.Equal(
+		t,
+		getURL(FlinkAPIAccess{}),
+		"http://mycluster-jobmanager.default.svc.cluster.local:8081")
+	assert.Equal(
+		t,
+		getURL(FlinkAPIAccess{
+			Mode: FlinkAPIAccessMode.DNS, ClusterDomain: "example.com"}),
+		"http://mycluster-jobmanager.default.svc.example.com:8081")
+	assert.Equal(
+		t,
+		getURL(FlinkAPIAccess{Mode: FlinkAPIAccessMode.ClusterIP}),
+		"http://10.0.0.1:8081")
+	assert.Equal(
+		t,
+		getURL(FlinkAPIAccess{
+			Mode:       FlinkAPIAccessMode.Proxy,
+			KubeConfig: &rest.Config{Host: "https://35.1.2.3"},
+		}),
+		"https://35.1.2.3/api/v1/namespaces/default/services/"+
+			"http:mycluster-jobmanager:8081/proxy")
+
+	// The ingress has no URL until its load balancer is ready.
+	var _, err = getFlinkAPIBaseURL(
+		context.Background(),
+		k8sClient,
+		cluster,
+		FlinkAPIAccess{Mode: FlinkAPIAccessMode.Ingress})
+	assert.ErrorContains(t, err, "JobManager ingress has no URL")
+	cluster.Status.Components.JobManagerIngress = &v1alpha1.JobManagerIngressStatus{
+		URLs: []string{"https://mycluster.example.com/"},
+	}
+	assert.Equal(
+		t,
+		getURL(FlinkAPIAccess{Mode: FlinkAPIAccessMode.Ingress}),
+		"https://mycluster.example.com")
+
+	cluster.Spec.RESTSecurity = &v1alpha1.RESTSecuritySpec{
+		TLS: &v1alpha1.RESTTLSSpec{
+			KeystoreSecret: "rest-keystore",
+			CASecret:       "rest-ca",
+		},
+	}
+	assert.Equal(
+		t,
+		getURL(FlinkAPIAccess{}),
+		"https://mycluster-jobmanager.default.svc.cluster.local:8081")
+	assert.Equal(
+		t,
+		getURL(FlinkAPIAccess{
+			Mode:       FlinkAPIAccessMode.Proxy,
+			KubeConfig: &rest.Config{Host: "35.1.2.3"},
+		}),
+		"https://35.1.2.3/api/v1/namespaces/default/services/"+
+			"https:mycluster-jobmanager:8081/proxy")
+}
+
+func TestValidateFlinkAPIAccess(t *testing.T) {
+	assert.NilError(t, FlinkAPIAccess{}.Validate())
+	assert.NilError(t, FlinkAPIAccess{Mode: FlinkAPIAccessMode.Ingress}.Validate())
+	assert.ErrorContains(
+		t,
+		FlinkAPIAccess{Mode: FlinkAPIAccessMode.Proxy}.Validate(),
+		"Kubernetes API server config is required by Proxy mode")
+	assert.ErrorContains(
+		t,
+		FlinkAPIAccess{Mode: "XXX"}.Validate(),
+		"invalid Flink API access mode: XXX")
+	assert.ErrorContains(
+		t,
+		FlinkAPIAccess{Timeout: -time.Second}.Validate(),
+		"invalid Flink API timeout: -1s")
+}
+
+func TestCheckSavepointStatus(t *testing.T) {
+	var ctx = context.Background()
+	var flinkServer = fake.NewServer()
+	defer flinkServer.Close()
+	flinkServer.SetJob("job-1", fake.JobStateRunning)
+	var flinkClient = flinkServer.Client()
+	var apiBaseURL = flinkServer.URL()
+	var tc = &TimeConverter{}
+	var now = tc.ToString(time.Now())
+
+	var triggerID, result = triggerSavepoint(
+		ctx, flinkClient, apiBaseURL, "job-1", "gs://my-bucket/savepoints",
+		false /* cancel */, log.Log)
+	assert.Assert(t, !result.failed())
+	result, err := checkSavepointStatus(
+		ctx, flinkClient, apiBaseURL, "job-1", triggerID, now, log.Log)
+	assert.NilError(t, err)
+	assert.Assert(t, !result.completed)
+	result, err = checkSavepointStatus(
+		ctx, flinkClient, apiBaseURL, "job-1", triggerID, now, log.Log)
+	assert.NilError(t, err)
+	assert.Assert(t, result.completed && !result.failed())
+	assert.Equal(
+		t, result.location, "gs://my-bucket/savepoints/savepoint-"+triggerID)
+
+	// The savepoint operation is lost.
+	result, err = checkSavepointStatus(
+		ctx, flinkClient, apiBaseURL, "job-1", "trigger-lost", now, log.Log)
+	assert.NilError(t, err)
+	assert.Assert(t, result.failed())
+	assert.Assert(t, strings.HasPrefix(
+		result.failureReason, "Savepoint operation not found"))
+
+	// The savepoint fails.
+	flinkServer.FailSavepoints = true
+	triggerID, _ = triggerSavepoint(
+		ctx, flinkClient, apiBaseURL, "job-1", "gs://my-bucket/savepoints",
+		false /* cancel */, log.Log)
+	for i := 0; i < 2; i++ {
+		result, err = checkSavepointStatus(
+			ctx, flinkClient, apiBaseURL, "job-1", triggerID, now, log.Log)
+	}
+	assert.NilError(t, err)
+	assert.Assert(t, result.failed())
+	assert.Equal(
+		t,
+		result.failureReason,
+		"java.util.concurrent.CompletionException: savepoint failed")
+
+	// The status cannot be checked, the savepoint fails after the timeout.
+	flinkServer.Close()
+	result, err = checkSavepointStatus(
+		ctx, flinkClient, apiBaseURL, "job-1", triggerID, now, log.Log)
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !result.completed)
+	var triggerTime = tc.ToString(
+		time.Now().Add(-savepointStatusTimeout - time.Minute))
+	result, err = checkSavepointStatus(
+		ctx, flinkClient, apiBaseURL, "job-1", triggerID, triggerTime, log.Log)
+	assert.NilError(t, err)
+	assert.Assert(t, result.failed())
+	assert.Assert(t, strings.HasPrefix(
+		result.failureReason, "Failed to check savepoint status"))
+
+	// The savepoint cannot be triggered.
+	_, result = triggerSavepoint(
+		ctx, flinkClient, apiBaseURL, "job-1", "gs://my-bucket/savepoints",
+		false /* cancel */, log.Log)
+	assert.Assert(t, result.failed())
+	assert.Assert(t, strings.HasPrefix(
+		result.failureReason, "Failed to trigger savepoint"))
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FlinkSavepointReconciler reconciles a FlinkSavepoint object
+type FlinkSavepointReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+	Mgr    ctrl.Manager
+	// Flink API client, a client of the Flink REST API is created for each
+	// request if it is nil.
+	FlinkClient flinkclient.FlinkClient
+	// How the Flink API of the clusters is reached.
+	FlinkAPIAccess FlinkAPIAccess
+}
+
+// +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinksavepoints,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinksavepoints/status,verbs=get;update;patch
+
+// Reconcile takes the savepoint of a FlinkSavepoint custom resource and tracks
+// it until it completes.
+func (reconciler *FlinkSavepointReconciler) Reconcile(
+	request ctrl.Request) (ctrl.Result, error) {
+	var log = reconciler.Log.WithValues(
+		"savepoint", request.NamespacedName)
+	var flinkClient = reconciler.FlinkClient
+	if flinkClient == nil {
+		flinkClient = reconciler.FlinkAPIAccess.newFlinkClient(log)
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+	var handler = FlinkSavepointHandler{
+		k8sClient:      reconciler.Client,
+		flinkClient:    flinkClient,
+		flinkAPIAccess: reconciler.FlinkAPIAccess,
+		request:        request,
+		context:        ctx,
+		log:            log,
+		recorder:       reconciler.Mgr.GetEventRecorderFor("FlinkOperator"),
+	}
+	return handler.reconcile()
+}
+
+// SetupWithManager registers this reconciler with the controller manager and
+// starts watching FlinkSavepoint.
+func (reconciler *FlinkSavepointReconciler) SetupWithManager(
+	mgr ctrl.Manager) error {
+	reconciler.Mgr = mgr
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.FlinkSavepoint{}).
+		Complete(reconciler)
+}
+
+// FlinkSavepointHandler holds the context and state for a
+// reconcile request.
+type FlinkSavepointHandler struct {
+	k8sClient      client.Client
+	flinkClient    flinkclient.FlinkClient
+	flinkAPIAccess FlinkAPIAccess
+	request        ctrl.Request
+	context        context.Context
+	log            logr.Logger
+	recorder       record.EventRecorder
+	// The base URL of the Flink API of the cluster, resolved when the cluster
+	// is got.
+	flinkAPIBaseURL string
+}
+
+func (handler *FlinkSavepointHandler) reconcile() (ctrl.Result, error) {
+	var log = handler.log
+
+	var savepoint = new(v1alpha1.FlinkSavepoint)
+	var err = handler.k8sClient.Get(
+		handler.context, handler.request.NamespacedName, savepoint)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get the savepoint resource")
+			return ctrl.Result{}, err
+		}
+		log.Info("The savepoint has been deleted, no action to take")
+		return ctrl.Result{}, nil
+	}
+	log.Info("Observed savepoint", "savepoint", *savepoint)
+
+	switch savepoint.Status.State {
+	case v1alpha1.FlinkSavepointState.Succeeded,
+		v1alpha1.FlinkSavepointState.Failed:
+		log.Info("The savepoint has completed, no action to take")
+		return ctrl.Result{}, nil
+	case v1alpha1.FlinkSavepointState.InProgress:
+		return handler.checkSavepoint(savepoint)
+	default:
+		return handler.triggerSavepoint(savepoint)
+	}
+}
+
+// Triggers the savepoint when the job of the cluster is running.
+func (handler *FlinkSavepointHandler) triggerSavepoint(
+	savepoint *v1alpha1.FlinkSavepoint) (ctrl.Result, error) {
+	var log = handler.log
+	var requeueResult = ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}
+	var status = savepoint.Status.DeepCopy()
+
+	var cluster, err = handler.getCluster(savepoint)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		status.State = v1alpha1.FlinkSavepointState.Pending
+		status.Reason = fmt.Sprintf(
+			"FlinkCluster %v is not found", savepoint.Spec.ClusterName)
+		return requeueResult, handler.updateStatus(savepoint, status)
+	}
+
+	if cluster.Spec.Job == nil {
+		status.State = v1alpha1.FlinkSavepointState.Failed
+		status.Reason = fmt.Sprintf(
+			"FlinkCluster %v is not a job cluster", savepoint.Spec.ClusterName)
+		return ctrl.Result{}, handler.updateStatus(savepoint, status)
+	}
+
+	var savepointsDir = getSavepointsDir(cluster)
+	if savepoint.Spec.SavepointsDir != nil {
+		savepointsDir = *savepoint.Spec.SavepointsDir
+	}
+	if len(savepointsDir) == 0 {
+		status.State = v1alpha1.FlinkSavepointState.Failed
+		status.Reason = "savepointsDir is not specified"
+		return ctrl.Result{}, handler.updateStatus(savepoint, status)
+	}
+
+	var jobStatus = cluster.Status.Components.Job
+	if jobStatus == nil || len(jobStatus.ID) == 0 ||
+		jobStatus.State != v1alpha1.JobState.Running {
+		status.State = v1alpha1.FlinkSavepointState.Pending
+		status.Reason = "The job is not running"
+		return requeueResult, handler.updateStatus(savepoint, status)
+	}
+
+	var triggerID, result = triggerSavepoint(
+		handler.context,
+		handler.flinkClient,
+		handler.flinkAPIBaseURL,
+		jobStatus.ID,
+		savepointsDir,
+		false, /* cancel */
+		log)
+	// The savepoint is triggered again later.
+	if result.failed() {
+		status.State = v1alpha1.FlinkSavepointState.Pending
+		status.Reason = result.failureReason
+		return requeueResult, handler.updateStatus(savepoint, status)
+	}
+
+	var tc = &TimeConverter{}
+	status.State = v1alpha1.FlinkSavepointState.InProgress
+	status.JobID = jobStatus.ID
+	status.TriggerID = triggerID
+	status.TriggerTime = tc.ToString(time.Now())
+	status.Reason = ""
+	return ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true},
+		handler.updateStatus(savepoint, status)
+}
+
+// Checks the savepoint in progress, records the result when it completes.
+func (handler *FlinkSavepointHandler) checkSavepoint(
+	savepoint *v1alpha1.FlinkSavepoint) (ctrl.Result, error) {
+	var requeueResult = ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}
+	var status = savepoint.Status.DeepCopy()
+
+	var _, err = handler.getCluster(savepoint)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		status.State = v1alpha1.FlinkSavepointState.Failed
+		status.Reason = fmt.Sprintf(
+			"FlinkCluster %v has been deleted", savepoint.Spec.ClusterName)
+		return ctrl.Result{}, handler.updateStatus(savepoint, status)
+	}
+
+	result, err := checkSavepointStatus(
+		handler.context,
+		handler.flinkClient,
+		handler.flinkAPIBaseURL,
+		status.JobID,
+		status.TriggerID,
+		status.TriggerTime,
+		handler.log)
+	if err != nil || !result.completed {
+		return requeueResult, nil
+	}
+
+	if result.failed() {
+		status.State = v1alpha1.FlinkSavepointState.Failed
+		status.Reason = result.failureReason
+	} else {
+		status.State = v1alpha1.FlinkSavepointState.Succeeded
+		status.Location = result.location
+	}
+	return ctrl.Result{}, handler.updateStatus(savepoint, status)
+}
+
+func (handler *FlinkSavepointHandler) getCluster(
+	savepoint *v1alpha1.FlinkSavepoint) (*v1alpha1.FlinkCluster, error) {
+	var cluster = new(v1alpha1.FlinkCluster)
+	var err = handler.k8sClient.Get(
+		handler.context,
+		types.NamespacedName{
+			Namespace: savepoint.ObjectMeta.Namespace,
+			Name:      savepoint.Spec.ClusterName,
+		},
+		cluster)
+	if err != nil {
+		return cluster, err
+	}
+	// The requests to the Flink API fail if it cannot be set up, e.g., the
+	// JobManager service has no cluster IP yet.
+	handler.flinkAPIBaseURL, err = getFlinkAPIBaseURL(
+		handler.context, handler.k8sClient, cluster, handler.flinkAPIAccess)
+	if err != nil {
+		handler.log.Info("Failed to get Flink API base URL", "error", err)
+		return cluster, nil
+	}
+	err = configureFlinkClient(
+		handler.context,
+		handler.k8sClient,
+		cluster,
+		handler.flinkClient,
+		handler.flinkAPIAccess)
+	if err != nil {
+		handler.log.Error(err, "Failed to configure Flink API client")
+	}
+	return cluster, nil
+}
+
+// Updates the status of the savepoint if it is changed.
+func (handler *FlinkSavepointHandler) updateStatus(
+	savepoint *v1alpha1.FlinkSavepoint,
+	status *v1alpha1.FlinkSavepointStatus) error {
+	var oldStatus = savepoint.Status
+	if oldStatus.State == status.State && oldStatus.Reason == status.Reason {
+		return nil
+	}
+
+	handler.log.Info("Status changed", "old", oldStatus, "new", *status)
+	var message = fmt.Sprintf("Savepoint status: %v", status.State)
+	if len(oldStatus.State) > 0 {
+		message = fmt.Sprintf(
+			"Savepoint status changed: %v -> %v", oldStatus.State, status.State)
+	}
+	if len(status.Reason) > 0 {
+		message = fmt.Sprintf("%v, %v", message, status.Reason)
+	}
+	var eventType = "Normal"
+	if status.State == v1alpha1.FlinkSavepointState.Failed {
+		eventType = "Warning"
+	}
+	handler.recorder.Event(savepoint, eventType, "StatusUpdate", message)
+
+	var tc = &TimeConverter{}
+	var newSavepoint = savepoint.DeepCopy()
+	newSavepoint.Status = *status
+	newSavepoint.Status.LastUpdateTime = tc.ToString(time.Now())
+	return handler.k8sClient.Update(handler.context, newSavepoint)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newTestSavepointHandler(objs ...runtime.Object) *FlinkSavepointHandler {
+	var scheme = runtime.NewScheme()
+	v1alpha1.AddToScheme(scheme)
+	return &FlinkSavepointHandler{
+		k8sClient: fake.NewFakeClientWithScheme(scheme, objs...),
+		request: ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: "default", Name: "mysavepoint"},
+		},
+		context:  context.Background(),
+		log:      log.Log,
+		recorder: record.NewFakeRecorder(10),
+	}
+}
+
+func getTestSavepointStatus(
+	t *testing.T, handler *FlinkSavepointHandler) v1alpha1.FlinkSavepointStatus {
+	var savepoint = v1alpha1.FlinkSavepoint{}
+	var err = handler.k8sClient.Get(
+		handler.context, handler.request.NamespacedName, &savepoint)
+	assert.NilError(t, err)
+	return savepoint.Status
+}
+
+func TestSavepointClusterNotFound(t *testing.T) {
+	var savepoint = &v1alpha1.FlinkSavepoint{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mysavepoint"},
+		Spec:       v1alpha1.FlinkSavepointSpec{ClusterName: "mycluster"},
+	}
+	var handler = newTestSavepointHandler(savepoint)
+
+	var result, err = handler.reconcile()
+	assert.NilError(t, err)
+	assert.Assert(t, result.Requeue)
+
+	var status = getTestSavepointStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.FlinkSavepointState.Pending)
+	assert.Equal(t, status.Reason, "FlinkCluster mycluster is not found")
+}
+
+func TestSavepointSessionCluster(t *testing.T) {
+	var savepoint = &v1alpha1.FlinkSavepoint{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mysavepoint"},
+		Spec:       v1alpha1.FlinkSavepointSpec{ClusterName: "mycluster"},
+	}
+	var cluster = &v1alpha1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+	}
+	var handler = newTestSavepointHandler(savepoint, cluster)
+
+	var result, err = handler.reconcile()
+	assert.NilError(t, err)
+	assert.Assert(t, !result.Requeue)
+
+	var status = getTestSavepointStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.FlinkSavepointState.Failed)
+	assert.Equal(t, status.Reason, "FlinkCluster mycluster is not a job cluster")
+}
+
+func TestSavepointJobNotRunning(t *testing.T) {
+	var savepointsDir = "/tmp/savepoints"
+	var savepoint = &v1alpha1.FlinkSavepoint{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mysavepoint"},
+		Spec:       v1alpha1.FlinkSavepointSpec{ClusterName: "mycluster"},
+	}
+	var cluster = &v1alpha1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+		Spec: v1alpha1.FlinkClusterSpec{
+			Job: &v1alpha1.JobSpec{SavepointsDir: &savepointsDir},
+		},
+		Status: v1alpha1.FlinkClusterStatus{
+			Components: v1alpha1.FlinkClusterComponentsStatus{
+				Job: &v1alpha1.JobStatus{
+					State: v1alpha1.JobState.Pending,
+				},
+			},
+		},
+	}
+	var handler = newTestSavepointHandler(savepoint, cluster)
+
+	var result, err = handler.reconcile()
+	assert.NilError(t, err)
+	assert.Assert(t, result.Requeue)
+
+	var status = getTestSavepointStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.FlinkSavepointState.Pending)
+	assert.Equal(t, status.Reason, "The job is not running")
+}
+
+func TestSavepointCompleted(t *testing.T) {
+	var savepoint = &v1alpha1.FlinkSavepoint{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mysavepoint"},
+		Spec:       v1alpha1.FlinkSavepointSpec{ClusterName: "mycluster"},
+		Status: v1alpha1.FlinkSavepointStatus{
+			State:    v1alpha1.FlinkSavepointState.Succeeded,
+			Location: "file:/tmp/savepoint-1",
+		},
+	}
+	var handler = newTestSavepointHandler(savepoint)
+
+	var result, err = handler.reconcile()
+	assert.NilError(t, err)
+	assert.Assert(t, !result.Requeue)
+
+	var status = getTestSavepointStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.FlinkSavepointState.Succeeded)
+	assert.Equal(t, status.Location, "file:/tmp/savepoint-1")
+}
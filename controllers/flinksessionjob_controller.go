@@ -0,0 +1,542 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"github.com/googlecloudplatform/flink-operator/controllers/jarstorage"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FlinkSessionJobReconciler reconciles a FlinkSessionJob object
+type FlinkSessionJobReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+	Mgr    ctrl.Manager
+	// Flink API client, a client of the Flink REST API is created for each
+	// request if it is nil.
+	FlinkClient flinkclient.FlinkClient
+	// How the Flink API of the clusters is reached.
+	FlinkAPIAccess FlinkAPIAccess
+	// Storages where the JAR files of the jobs are read from, the default
+	// storages are used if it is nil.
+	JarStorage *jarstorage.Registry
+}
+
+// +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinksessionjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinksessionjobs/status,verbs=get;update;patch
+
+// Reconcile submits the job of a FlinkSessionJob custom resource to its
+// session cluster, then tracks it until it finishes or the resource is
+// deleted.
+func (reconciler *FlinkSessionJobReconciler) Reconcile(
+	request ctrl.Request) (ctrl.Result, error) {
+	var log = reconciler.Log.WithValues(
+		"sessionjob", request.NamespacedName)
+	var flinkClient = reconciler.FlinkClient
+	if flinkClient == nil {
+		flinkClient = reconciler.FlinkAPIAccess.newFlinkClient(log)
+	}
+	var ctx, cancel = context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+	var handler = FlinkSessionJobHandler{
+		k8sClient:      reconciler.Client,
+		flinkClient:    flinkClient,
+		jarStorage:     reconciler.JarStorage,
+		flinkAPIAccess: reconciler.FlinkAPIAccess,
+		request:        request,
+		context:        ctx,
+		log:            log,
+		recorder:       reconciler.Mgr.GetEventRecorderFor("FlinkOperator"),
+	}
+	return handler.reconcile()
+}
+
+// SetupWithManager registers this reconciler with the controller manager and
+// starts watching FlinkSessionJob.
+func (reconciler *FlinkSessionJobReconciler) SetupWithManager(
+	mgr ctrl.Manager) error {
+	reconciler.Mgr = mgr
+	if reconciler.JarStorage == nil {
+		reconciler.JarStorage = jarstorage.NewRegistry(jarstorage.DefaultMaxJarSize)
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.FlinkSessionJob{}).
+		Complete(reconciler)
+}
+
+// FlinkSessionJobHandler holds the context and state for a
+// reconcile request.
+type FlinkSessionJobHandler struct {
+	k8sClient      client.Client
+	flinkClient    flinkclient.FlinkClient
+	jarStorage     *jarstorage.Registry
+	flinkAPIAccess FlinkAPIAccess
+	request        ctrl.Request
+	context        context.Context
+	log            logr.Logger
+	recorder       record.EventRecorder
+	// The base URL of the Flink API of the cluster, resolved when the cluster
+	// is got.
+	flinkAPIBaseURL string
+}
+
+func (handler *FlinkSessionJobHandler) reconcile() (ctrl.Result, error) {
+	var log = handler.log
+	var requeueResult = ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}
+
+	var sessionJob = new(v1alpha1.FlinkSessionJob)
+	var err = handler.k8sClient.Get(
+		handler.context, handler.request.NamespacedName, sessionJob)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get the session job resource")
+			return ctrl.Result{}, err
+		}
+		log.Info("The session job has been deleted, no action to take")
+		return ctrl.Result{}, nil
+	}
+	log.Info("Observed session job", "sessionjob", *sessionJob)
+
+	if !sessionJob.ObjectMeta.DeletionTimestamp.IsZero() {
+		return handler.reconcileDeletion(sessionJob)
+	}
+	if isJobStateFinal(sessionJob.Status.State) {
+		log.Info("The job has finished, no action to take")
+		return ctrl.Result{}, nil
+	}
+	if !hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer) {
+		var newSessionJob = sessionJob.DeepCopy()
+		newSessionJob.ObjectMeta.Finalizers = append(
+			newSessionJob.ObjectMeta.Finalizers, sessionJobFinalizer)
+		log.Info("Adding finalizer", "finalizer", sessionJobFinalizer)
+		return ctrl.Result{Requeue: true},
+			handler.k8sClient.Update(handler.context, newSessionJob)
+	}
+
+	var status = sessionJob.Status.DeepCopy()
+	var cluster *v1alpha1.FlinkCluster
+	cluster, err = handler.getCluster(sessionJob)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		if len(status.ID) > 0 {
+			status.State = v1alpha1.JobState.Failed
+			status.Reason = fmt.Sprintf(
+				"FlinkCluster %v has been deleted", sessionJob.Spec.ClusterName)
+			return ctrl.Result{}, handler.updateStatus(sessionJob, status)
+		}
+		status.State = v1alpha1.JobState.Pending
+		status.Reason = fmt.Sprintf(
+			"FlinkCluster %v is not found", sessionJob.Spec.ClusterName)
+		return requeueResult, handler.updateStatus(sessionJob, status)
+	}
+	if cluster.Spec.Job != nil {
+		status.State = v1alpha1.JobState.Failed
+		status.Reason = fmt.Sprintf(
+			"FlinkCluster %v is not a session cluster",
+			sessionJob.Spec.ClusterName)
+		return ctrl.Result{}, handler.updateStatus(sessionJob, status)
+	}
+	// The uploaded JAR file and the savepoints of the job are only known to
+	// the JobManager which handled them, the requests may reach a standby.
+	if cluster.Spec.JobManager.Replicas != nil &&
+		*cluster.Spec.JobManager.Replicas > 1 {
+		status.State = v1alpha1.JobState.Failed
+		status.Reason = fmt.Sprintf(
+			"FlinkCluster %v has standby JobManagers, session jobs are only "+
+				"supported with a single JobManager",
+			sessionJob.Spec.ClusterName)
+		return ctrl.Result{}, handler.updateStatus(sessionJob, status)
+	}
+
+	if len(status.SubmitTime) == 0 {
+		return handler.submitJob(sessionJob, cluster, status)
+	}
+	if len(status.ID) == 0 {
+		// The job may have been submitted, but its ID was not recorded, e.g.,
+		// the operator restarted during the submission.
+		status.State = v1alpha1.JobState.Failed
+		status.Reason = "The job submission was interrupted, " +
+			"the ID of the submitted job is unknown"
+		return ctrl.Result{}, handler.updateStatus(sessionJob, status)
+	}
+	handler.observeJob(cluster, status)
+	handler.reconcileSavepoint(sessionJob, cluster, status)
+	if isJobStateFinal(status.State) {
+		return ctrl.Result{}, handler.updateStatus(sessionJob, status)
+	}
+	return requeueResult, handler.updateStatus(sessionJob, status)
+}
+
+// Submits the job through the Flink REST API when the cluster is running.
+// The submission is recorded in the status before the job is run, so that
+// the job is submitted at most once: a job submitted to a session cluster
+// cannot be told apart from the other jobs of the cluster, except by the ID
+// returned by the submission.
+func (handler *FlinkSessionJobHandler) submitJob(
+	sessionJob *v1alpha1.FlinkSessionJob,
+	cluster *v1alpha1.FlinkCluster,
+	status *v1alpha1.FlinkSessionJobStatus) (ctrl.Result, error) {
+	var log = handler.log
+	var requeueResult = ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}
+	var spec = sessionJob.Spec
+
+	status.State = v1alpha1.JobState.Pending
+	if cluster.Status.State != v1alpha1.ClusterState.Running ||
+		len(handler.flinkAPIBaseURL) == 0 {
+		status.Reason = fmt.Sprintf(
+			"FlinkCluster %v is not running", spec.ClusterName)
+		return requeueResult, handler.updateStatus(sessionJob, status)
+	}
+
+	var tc = &TimeConverter{}
+	status.Reason = ""
+	status.SubmitTime = tc.ToString(time.Now())
+	var err = handler.updateStatus(sessionJob, status)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var jobSpec = &v1alpha1.JobSpec{
+		ClassName:             spec.ClassName,
+		Args:                  spec.Args,
+		AllowNonRestoredState: spec.AllowNonRestoredState,
+		Parallelism:           spec.Parallelism,
+	}
+	var fromSavepoint string
+	if spec.Savepoint != nil {
+		fromSavepoint = *spec.Savepoint
+	}
+	jobID, err := submitJar(
+		handler.context,
+		handler.flinkClient,
+		handler.jarStorage,
+		handler.flinkAPIBaseURL,
+		spec.JarFile,
+		getJarRunRequest(jobSpec, fromSavepoint),
+		log)
+	if err != nil {
+		log.Info("Failed to submit job", "error", err)
+		status.State = v1alpha1.JobState.Failed
+		status.Reason = truncateFailureReason(
+			fmt.Sprintf("Failed to submit job: %v", err))
+		return ctrl.Result{}, handler.updateStatus(sessionJob, status)
+	}
+	log.Info("Job submitted", "jobID", jobID)
+	handler.recorder.Event(
+		sessionJob,
+		"Normal",
+		"JobSubmit",
+		fmt.Sprintf("Job %v submitted", jobID))
+	status.ID = jobID
+	return requeueResult, handler.updateStatus(sessionJob, status)
+}
+
+// Observes the state of the Flink job.
+func (handler *FlinkSessionJobHandler) observeJob(
+	cluster *v1alpha1.FlinkCluster, status *v1alpha1.FlinkSessionJobStatus) {
+	var details, err = handler.flinkClient.GetJobDetails(
+		handler.context, handler.flinkAPIBaseURL, status.ID)
+	if err != nil {
+		handler.log.Info("Failed to get Flink job details.", "error", err)
+		return
+	}
+
+	var tc = &TimeConverter{}
+	status.FlinkJobState = details.State
+	if details.StartTime > 0 {
+		status.StartTime = tc.ToString(
+			time.Unix(0, details.StartTime*int64(time.Millisecond)))
+	}
+	var state = getJobStateFromFlinkJobState(details.State)
+	if len(state) > 0 {
+		status.State = state
+		status.Reason = ""
+	}
+}
+
+// Takes a savepoint on demand when the savepoint generation of the spec is
+// increased, then tracks it until it completes.
+func (handler *FlinkSessionJobHandler) reconcileSavepoint(
+	sessionJob *v1alpha1.FlinkSessionJob,
+	cluster *v1alpha1.FlinkCluster,
+	status *v1alpha1.FlinkSessionJobStatus) {
+	if status.LastSavepointState == v1alpha1.SavepointState.InProgress {
+		handler.checkSavepoint(sessionJob, cluster, status)
+		return
+	}
+	if sessionJob.Spec.SavepointGeneration <= status.SavepointGeneration ||
+		sessionJob.Spec.SavepointsDir == nil ||
+		status.State != v1alpha1.JobState.Running {
+		return
+	}
+	status.SavepointGeneration = sessionJob.Spec.SavepointGeneration
+	handler.triggerSavepoint(
+		sessionJob, cluster, status, false /* cancel */)
+}
+
+func (handler *FlinkSessionJobHandler) triggerSavepoint(
+	sessionJob *v1alpha1.FlinkSessionJob,
+	cluster *v1alpha1.FlinkCluster,
+	status *v1alpha1.FlinkSessionJobStatus,
+	cancel bool) {
+	var tc = &TimeConverter{}
+	var triggerID, result = triggerSavepoint(
+		handler.context,
+		handler.flinkClient,
+		handler.flinkAPIBaseURL,
+		status.ID,
+		*sessionJob.Spec.SavepointsDir,
+		cancel,
+		handler.log)
+	status.LastSavepointTriggerTime = tc.ToString(time.Now())
+	status.LastSavepointCancelsJob = cancel
+	if result.failed() {
+		handler.setSavepointFailed(sessionJob, status, result.failureReason)
+		return
+	}
+	status.LastSavepointTriggerID = triggerID
+	status.LastSavepointState = v1alpha1.SavepointState.InProgress
+	status.LastSavepointFailureReason = ""
+}
+
+func (handler *FlinkSessionJobHandler) checkSavepoint(
+	sessionJob *v1alpha1.FlinkSessionJob,
+	cluster *v1alpha1.FlinkCluster,
+	status *v1alpha1.FlinkSessionJobStatus) {
+	var tc = &TimeConverter{}
+	var result, err = checkSavepointStatus(
+		handler.context,
+		handler.flinkClient,
+		handler.flinkAPIBaseURL,
+		status.ID,
+		status.LastSavepointTriggerID,
+		status.LastSavepointTriggerTime,
+		handler.log)
+	if err != nil || !result.completed {
+		return
+	}
+	if result.failed() {
+		handler.setSavepointFailed(sessionJob, status, result.failureReason)
+		return
+	}
+	status.LastSavepointState = v1alpha1.SavepointState.Succeeded
+	status.LastSavepointTime = tc.ToString(time.Now())
+	status.SavepointLocation = result.location
+	handler.recorder.Event(
+		sessionJob,
+		"Normal",
+		"SavepointCreated",
+		fmt.Sprintf("Savepoint created: %v", result.location))
+}
+
+// Records the failure of the last savepoint in the status.
+func (handler *FlinkSessionJobHandler) setSavepointFailed(
+	sessionJob *v1alpha1.FlinkSessionJob,
+	status *v1alpha1.FlinkSessionJobStatus,
+	reason string) {
+	var tc = &TimeConverter{}
+	handler.log.Info("Savepoint failed", "reason", reason)
+	handler.recorder.Event(sessionJob, "Warning", "SavepointFailed", reason)
+	status.LastSavepointState = v1alpha1.SavepointState.Failed
+	status.LastSavepointFailureReason = reason
+	status.LastSavepointTime = tc.ToString(time.Now())
+}
+
+// Cancels the running job before the resource is deleted, with a final
+// savepoint if the savepoints dir is specified. The job is cancelled without
+// the savepoint if it fails or times out, and the cancellation is retried
+// until the timeout, after which the resource is deleted anyway.
+func (handler *FlinkSessionJobHandler) reconcileDeletion(
+	sessionJob *v1alpha1.FlinkSessionJob) (ctrl.Result, error) {
+	var log = handler.log
+	var requeueResult = ctrl.Result{RequeueAfter: 5 * time.Second, Requeue: true}
+	var status = sessionJob.Status.DeepCopy()
+
+	if !hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	var deletionTime = sessionJob.ObjectMeta.DeletionTimestamp.Time
+	var timeoutSeconds int32 = defaultFinalSavepointTimeoutSeconds
+	if sessionJob.Spec.FinalSavepointTimeoutSeconds != nil {
+		timeoutSeconds = *sessionJob.Spec.FinalSavepointTimeoutSeconds
+	}
+	var timeout = time.Duration(timeoutSeconds) * time.Second
+	var timedOut = time.Now().After(deletionTime.Add(timeout))
+	var savepointTriggered = status.LastSavepointCancelsJob
+
+	var cluster, err = handler.getCluster(sessionJob)
+	if err != nil && client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	if err == nil && len(status.ID) > 0 {
+		handler.observeJob(cluster, status)
+		// The job may end before the savepoint which cancels it completes.
+		if status.LastSavepointState == v1alpha1.SavepointState.InProgress &&
+			!timedOut {
+			handler.checkSavepoint(sessionJob, cluster, status)
+			return requeueResult, handler.updateStatus(sessionJob, status)
+		}
+	}
+	if err != nil || len(status.ID) == 0 || isJobStateFinal(status.State) {
+		return ctrl.Result{}, handler.removeFinalizer(sessionJob, status)
+	}
+
+	if sessionJob.Spec.SavepointsDir != nil && !savepointTriggered &&
+		!timedOut {
+		handler.triggerSavepoint(sessionJob, cluster, status, true /* cancel */)
+		return requeueResult, handler.updateStatus(sessionJob, status)
+	}
+	if savepointTriggered &&
+		status.LastSavepointState == v1alpha1.SavepointState.Succeeded {
+		// Waiting for the job to be cancelled after the savepoint.
+		if !timedOut {
+			return requeueResult, handler.updateStatus(sessionJob, status)
+		}
+	}
+
+	log.Info("Cancelling job", "jobID", status.ID)
+	if len(handler.flinkAPIBaseURL) == 0 {
+		err = fmt.Errorf(
+			"Flink API of FlinkCluster %v is not available",
+			sessionJob.Spec.ClusterName)
+	} else {
+		err = handler.flinkClient.CancelJob(
+			handler.context, handler.flinkAPIBaseURL, status.ID)
+	}
+	if err != nil {
+		log.Info("Failed to cancel job", "error", err)
+		if !timedOut {
+			return requeueResult, handler.updateStatus(sessionJob, status)
+		}
+		// The job may be left running in the cluster.
+		handler.recorder.Event(
+			sessionJob,
+			"Warning",
+			"JobCancel",
+			fmt.Sprintf(
+				"Failed to cancel job %v before the timeout, removing the "+
+					"finalizer: %v",
+				status.ID,
+				err))
+		return ctrl.Result{}, handler.removeFinalizer(sessionJob, status)
+	}
+	handler.recorder.Event(
+		sessionJob,
+		"Normal",
+		"JobCancel",
+		fmt.Sprintf("Cancelled job %v", status.ID))
+	status.State = v1alpha1.JobState.Cancelled
+	return ctrl.Result{}, handler.removeFinalizer(sessionJob, status)
+}
+
+func (handler *FlinkSessionJobHandler) removeFinalizer(
+	sessionJob *v1alpha1.FlinkSessionJob,
+	status *v1alpha1.FlinkSessionJobStatus) error {
+	var newSessionJob = sessionJob.DeepCopy()
+	newSessionJob.Status = *status
+	newSessionJob.ObjectMeta.Finalizers = removeFinalizer(
+		newSessionJob.ObjectMeta.Finalizers, sessionJobFinalizer)
+	handler.log.Info("Removing finalizer", "finalizer", sessionJobFinalizer)
+	return handler.k8sClient.Update(handler.context, newSessionJob)
+}
+
+func (handler *FlinkSessionJobHandler) getCluster(
+	sessionJob *v1alpha1.FlinkSessionJob) (*v1alpha1.FlinkCluster, error) {
+	var cluster = new(v1alpha1.FlinkCluster)
+	var err = handler.k8sClient.Get(
+		handler.context,
+		types.NamespacedName{
+			Namespace: sessionJob.ObjectMeta.Namespace,
+			Name:      sessionJob.Spec.ClusterName,
+		},
+		cluster)
+	if err != nil {
+		return cluster, err
+	}
+	// The requests to the Flink API fail if it cannot be set up, e.g., the
+	// JobManager service has no cluster IP yet.
+	handler.flinkAPIBaseURL, err = getFlinkAPIBaseURL(
+		handler.context, handler.k8sClient, cluster, handler.flinkAPIAccess)
+	if err != nil {
+		handler.log.Info("Failed to get Flink API base URL", "error", err)
+		return cluster, nil
+	}
+	err = configureFlinkClient(
+		handler.context,
+		handler.k8sClient,
+		cluster,
+		handler.flinkClient,
+		handler.flinkAPIAccess)
+	if err != nil {
+		handler.log.Error(err, "Failed to configure Flink API client")
+	}
+	return cluster, nil
+}
+
+// Updates the status of the session job if it is changed. The session job is
+// updated in place, so that its status can be updated again in the same
+// reconcile.
+func (handler *FlinkSessionJobHandler) updateStatus(
+	sessionJob *v1alpha1.FlinkSessionJob,
+	status *v1alpha1.FlinkSessionJobStatus) error {
+	var oldStatus = sessionJob.Status
+	if reflect.DeepEqual(oldStatus, *status) {
+		return nil
+	}
+
+	handler.log.Info("Status changed", "old", oldStatus, "new", *status)
+	if oldStatus.State != status.State || oldStatus.Reason != status.Reason {
+		var message = fmt.Sprintf("Job status: %v", status.State)
+		if len(oldStatus.State) > 0 && oldStatus.State != status.State {
+			message = fmt.Sprintf(
+				"Job status changed: %v -> %v", oldStatus.State, status.State)
+		}
+		if len(status.Reason) > 0 {
+			message = fmt.Sprintf("%v, %v", message, status.Reason)
+		}
+		var eventType = "Normal"
+		if status.State == v1alpha1.JobState.Failed {
+			eventType = "Warning"
+		}
+		handler.recorder.Event(sessionJob, eventType, "StatusUpdate", message)
+	}
+
+	var tc = &TimeConverter{}
+	var newSessionJob = sessionJob.DeepCopy()
+	newSessionJob.Status = *status
+	newSessionJob.Status.LastUpdateTime = tc.ToString(time.Now())
+	var err = handler.k8sClient.Update(handler.context, newSessionJob)
+	if err != nil {
+		return err
+	}
+	newSessionJob.DeepCopyInto(sessionJob)
+	return nil
+}
@@ -0,0 +1,370 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient/fake"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	k8sfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newTestSessionJobHandler(
+	flinkServer *fake.Server, objs ...runtime.Object) *FlinkSessionJobHandler {
+	var clientScheme = runtime.NewScheme()
+	scheme.AddToScheme(clientScheme)
+	v1alpha1.AddToScheme(clientScheme)
+	var handler = &FlinkSessionJobHandler{
+		k8sClient:  k8sfake.NewFakeClientWithScheme(clientScheme, objs...),
+		jarStorage: getTestJarStorage(),
+		request: ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: "default", Name: "mysessionjob"},
+		},
+		context:  context.Background(),
+		log:      log.Log,
+		recorder: record.NewFakeRecorder(100),
+	}
+	if flinkServer != nil {
+		handler.flinkClient = flinkServer.Client()
+	}
+	return handler
+}
+
+func getTestSessionJob(name string) *v1alpha1.FlinkSessionJob {
+	var className = "org.apache.flink.examples.java.wordcount.WordCount"
+	var savepointsDir = "gs://my-bucket/savepoints"
+	return &v1alpha1.FlinkSessionJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: v1alpha1.FlinkSessionJobSpec{
+			ClusterName:   "mycluster",
+			JarFile:       "./examples/streaming/WordCount.jar",
+			ClassName:     &className,
+			SavepointsDir: &savepointsDir,
+		},
+	}
+}
+
+// Gets a session job whose JAR file is a temporary file, which is removed by
+// the returned function.
+func getTestSessionJobWithJar(
+	t *testing.T, name string) (*v1alpha1.FlinkSessionJob, func()) {
+	var jarFile, err = ioutil.TempFile("", "WordCount*.jar")
+	assert.NilError(t, err)
+	_, err = jarFile.Write([]byte("jar"))
+	assert.NilError(t, err)
+	assert.NilError(t, jarFile.Close())
+
+	var sessionJob = getTestSessionJob(name)
+	sessionJob.Spec.JarFile = "file://" + jarFile.Name()
+	return sessionJob, func() { os.Remove(jarFile.Name()) }
+}
+
+func getTestSessionCluster() *v1alpha1.FlinkCluster {
+	var cluster = getTestJobCluster()
+	cluster.Spec.Job = nil
+	cluster.Default()
+	cluster.Status.State = v1alpha1.ClusterState.Running
+	return cluster
+}
+
+func getTestSessionJobStatus(
+	t *testing.T,
+	handler *FlinkSessionJobHandler) v1alpha1.FlinkSessionJobStatus {
+	var sessionJob = getTestSessionJobResource(t, handler)
+	return sessionJob.Status
+}
+
+func getTestSessionJobResource(
+	t *testing.T, handler *FlinkSessionJobHandler) *v1alpha1.FlinkSessionJob {
+	var sessionJob = &v1alpha1.FlinkSessionJob{}
+	var err = handler.k8sClient.Get(
+		handler.context, handler.request.NamespacedName, sessionJob)
+	assert.NilError(t, err)
+	return sessionJob
+}
+
+// Reconciles the session job and checks there is no error.
+func reconcileTestSessionJob(
+	t *testing.T, handler *FlinkSessionJobHandler) ctrl.Result {
+	var result, err = handler.reconcile()
+	assert.NilError(t, err)
+	return result
+}
+
+func TestSessionJobClusterNotFound(t *testing.T) {
+	var sessionJob = getTestSessionJob("mysessionjob")
+	sessionJob.ObjectMeta.Finalizers = []string{sessionJobFinalizer}
+	var handler = newTestSessionJobHandler(nil, sessionJob)
+
+	var result = reconcileTestSessionJob(t, handler)
+	assert.Assert(t, result.Requeue)
+
+	var status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.JobState.Pending)
+	assert.Equal(t, status.Reason, "FlinkCluster mycluster is not found")
+}
+
+func TestSessionJobJobCluster(t *testing.T) {
+	var sessionJob = getTestSessionJob("mysessionjob")
+	sessionJob.ObjectMeta.Finalizers = []string{sessionJobFinalizer}
+	var handler = newTestSessionJobHandler(nil, sessionJob, getTestJobCluster())
+
+	var result = reconcileTestSessionJob(t, handler)
+	assert.Assert(t, !result.Requeue)
+
+	var status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.JobState.Failed)
+	assert.Equal(t, status.Reason, "FlinkCluster mycluster is not a session cluster")
+}
+
+func TestSessionJobStandbyJobManagers(t *testing.T) {
+	var sessionJob = getTestSessionJob("mysessionjob")
+	sessionJob.ObjectMeta.Finalizers = []string{sessionJobFinalizer}
+	var cluster = getTestSessionCluster()
+	var jmReplicas int32 = 2
+	cluster.Spec.JobManager.Replicas = &jmReplicas
+	var handler = newTestSessionJobHandler(nil, sessionJob, cluster)
+
+	var result = reconcileTestSessionJob(t, handler)
+	assert.Assert(t, !result.Requeue)
+
+	var status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.JobState.Failed)
+	assert.Equal(
+		t,
+		status.Reason,
+		"FlinkCluster mycluster has standby JobManagers, session jobs are only "+
+			"supported with a single JobManager")
+}
+
+func TestSessionJobSubmissionFailure(t *testing.T) {
+	var flinkServer = fake.NewServer()
+	defer flinkServer.Close()
+	flinkServer.JarRunError = "The main method caused an error."
+
+	var sessionJob, removeJar = getTestSessionJobWithJar(t, "mysessionjob")
+	defer removeJar()
+	sessionJob.ObjectMeta.Finalizers = []string{sessionJobFinalizer}
+	var handler = newTestSessionJobHandler(
+		flinkServer, sessionJob, getTestSessionCluster())
+
+	var result = reconcileTestSessionJob(t, handler)
+	assert.Assert(t, !result.Requeue)
+
+	var status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.JobState.Failed)
+	assert.Assert(t, len(status.SubmitTime) > 0)
+	assert.Assert(t, strings.HasPrefix(
+		status.Reason, "Failed to submit job: failed to run JAR file"))
+	assert.Assert(t, strings.Contains(
+		status.Reason, "The main method caused an error."))
+	assert.Equal(t, len(flinkServer.GetJars()), 0)
+}
+
+func TestSessionJobInterruptedSubmission(t *testing.T) {
+	var flinkServer = fake.NewServer()
+	defer flinkServer.Close()
+
+	// The job was being submitted, but its ID was not recorded.
+	var sessionJob = getTestSessionJob("mysessionjob")
+	sessionJob.ObjectMeta.Finalizers = []string{sessionJobFinalizer}
+	sessionJob.Status = v1alpha1.FlinkSessionJobStatus{
+		State:      v1alpha1.JobState.Pending,
+		SubmitTime: "2019-10-11T00:00:00Z",
+	}
+	var handler = newTestSessionJobHandler(
+		flinkServer, sessionJob, getTestSessionCluster())
+
+	var result = reconcileTestSessionJob(t, handler)
+	assert.Assert(t, !result.Requeue)
+
+	var status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.JobState.Failed)
+	assert.Equal(
+		t,
+		status.Reason,
+		"The job submission was interrupted, the ID of the submitted job is unknown")
+	assert.Equal(t, len(flinkServer.GetJarRuns()), 0)
+}
+
+func TestSessionJobLifecycle(t *testing.T) {
+	var flinkServer = fake.NewServer()
+	defer flinkServer.Close()
+
+	// A job of the cluster which is not submitted by the session job.
+	flinkServer.SetJob("job-1", fake.JobStateRunning)
+
+	var sessionJob, removeJar = getTestSessionJobWithJar(t, "mysessionjob")
+	defer removeJar()
+	var handler = newTestSessionJobHandler(
+		flinkServer, sessionJob, getTestSessionCluster())
+
+	reconcileTestSessionJob(t, handler)
+	sessionJob = getTestSessionJobResource(t, handler)
+	assert.Assert(
+		t, hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer))
+
+	// Submit the job, its ID is returned by the submission.
+	reconcileTestSessionJob(t, handler)
+	var status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.JobState.Pending)
+	assert.Equal(t, status.ID, "jar-job-1")
+	assert.Assert(t, len(status.SubmitTime) > 0)
+	var jarRuns = flinkServer.GetJarRuns()
+	assert.Equal(t, len(jarRuns), 1)
+	assert.Equal(t, jarRuns[0].EntryClass, *sessionJob.Spec.ClassName)
+	assert.Equal(t, len(flinkServer.GetJars()), 0)
+
+	reconcileTestSessionJob(t, handler)
+	status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.State, v1alpha1.JobState.Running)
+	assert.Equal(t, status.FlinkJobState, fake.JobStateRunning)
+	assert.Equal(t, len(flinkServer.GetJarRuns()), 1)
+
+	// Take a savepoint on demand.
+	sessionJob = getTestSessionJobResource(t, handler)
+	sessionJob.Spec.SavepointGeneration = 1
+	assert.NilError(t, handler.k8sClient.Update(handler.context, sessionJob))
+	reconcileTestSessionJob(t, handler)
+	status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.SavepointGeneration, int32(1))
+	assert.Equal(t, status.LastSavepointState, v1alpha1.SavepointState.InProgress)
+
+	reconcileTestSessionJob(t, handler)
+	reconcileTestSessionJob(t, handler)
+	status = getTestSessionJobStatus(t, handler)
+	assert.Equal(t, status.LastSavepointState, v1alpha1.SavepointState.Succeeded)
+	assert.Equal(
+		t,
+		status.SavepointLocation,
+		"gs://my-bucket/savepoints/savepoint-trigger-1")
+
+	// Cancel the job with a savepoint when the resource is deleted.
+	sessionJob = getTestSessionJobResource(t, handler)
+	var now = metav1.Now()
+	sessionJob.ObjectMeta.DeletionTimestamp = &now
+	assert.NilError(t, handler.k8sClient.Update(handler.context, sessionJob))
+	for i := 0; i < 5; i++ {
+		reconcileTestSessionJob(t, handler)
+		sessionJob = getTestSessionJobResource(t, handler)
+		if !hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer) {
+			break
+		}
+	}
+	assert.Assert(
+		t, !hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer))
+	assert.Equal(t, sessionJob.Status.State, v1alpha1.JobState.Cancelled)
+	assert.Equal(
+		t,
+		sessionJob.Status.SavepointLocation,
+		"gs://my-bucket/savepoints/savepoint-trigger-2")
+	assert.Equal(t, flinkServer.GetJob("job-1"), fake.JobStateRunning)
+	assert.Equal(t, flinkServer.GetJob("jar-job-1"), fake.JobStateCanceled)
+}
+
+func TestSessionJobDeletionSavepointFailed(t *testing.T) {
+	var flinkServer = fake.NewServer()
+	defer flinkServer.Close()
+	flinkServer.SetJob("job-1", fake.JobStateRunning)
+	flinkServer.FailSavepoints = true
+
+	var sessionJob = getTestSessionJob("mysessionjob")
+	var now = metav1.Now()
+	sessionJob.ObjectMeta.Finalizers = []string{sessionJobFinalizer}
+	sessionJob.ObjectMeta.DeletionTimestamp = &now
+	sessionJob.Status = v1alpha1.FlinkSessionJobStatus{
+		State: v1alpha1.JobState.Running,
+		ID:    "job-1",
+	}
+	var handler = newTestSessionJobHandler(
+		flinkServer, sessionJob, getTestSessionCluster())
+
+	for i := 0; i < 5; i++ {
+		reconcileTestSessionJob(t, handler)
+		sessionJob = getTestSessionJobResource(t, handler)
+		if !hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer) {
+			break
+		}
+	}
+	assert.Assert(
+		t, !hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer))
+	assert.Equal(t, sessionJob.Status.LastSavepointState, v1alpha1.SavepointState.Failed)
+	assert.Equal(
+		t,
+		sessionJob.Status.LastSavepointFailureReason,
+		"java.util.concurrent.CompletionException: savepoint failed")
+	assert.Equal(t, sessionJob.Status.State, v1alpha1.JobState.Cancelled)
+	assert.Equal(t, flinkServer.GetJob("job-1"), fake.JobStateCanceled)
+}
+
+func TestSessionJobDeletionCancelFailed(t *testing.T) {
+	// The Flink API is unreachable, so the job cannot be cancelled.
+	var flinkServer = fake.NewServer()
+	flinkServer.Close()
+
+	var sessionJob = getTestSessionJob("mysessionjob")
+	var now = metav1.Now()
+	var timeout int32 = 60
+	sessionJob.Spec.SavepointsDir = nil
+	sessionJob.Spec.FinalSavepointTimeoutSeconds = &timeout
+	sessionJob.ObjectMeta.Finalizers = []string{sessionJobFinalizer}
+	sessionJob.ObjectMeta.DeletionTimestamp = &now
+	sessionJob.Status = v1alpha1.FlinkSessionJobStatus{
+		State: v1alpha1.JobState.Running,
+		ID:    "job-1",
+	}
+	var handler = newTestSessionJobHandler(
+		flinkServer, sessionJob, getTestSessionCluster())
+
+	// The cancellation is retried until the timeout.
+	var result = reconcileTestSessionJob(t, handler)
+	assert.Assert(t, result.Requeue)
+	sessionJob = getTestSessionJobResource(t, handler)
+	assert.Assert(
+		t, hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer))
+
+	var deletionTime = metav1.NewTime(now.Add(-61 * time.Second))
+	sessionJob.ObjectMeta.DeletionTimestamp = &deletionTime
+	assert.NilError(t, handler.k8sClient.Update(handler.context, sessionJob))
+	result = reconcileTestSessionJob(t, handler)
+	assert.Assert(t, !result.Requeue)
+	sessionJob = getTestSessionJobResource(t, handler)
+	assert.Assert(
+		t, !hasFinalizer(sessionJob.ObjectMeta.Finalizers, sessionJobFinalizer))
+	assert.Equal(t, sessionJob.Status.State, v1alpha1.JobState.Running)
+	var recorder = handler.recorder.(*record.FakeRecorder)
+	var event = <-recorder.Events
+	assert.Assert(t, strings.HasPrefix(
+		event,
+		"Warning JobCancel Failed to cancel job job-1 before the timeout, "+
+			"removing the finalizer"))
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jarstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// HTTPStorage is the storage of JAR files served over HTTP(S).
+type HTTPStorage struct {
+	// The maximum size of a JAR file in bytes, a larger file is not
+	// downloaded, default: DefaultMaxJarSize.
+	MaxSize int64
+}
+
+// ReadJar downloads the JAR file from the URL of the location.
+func (s *HTTPStorage) ReadJar(
+	ctx context.Context, location string) ([]byte, error) {
+	var httpClient = &http.Client{Timeout: 5 * time.Minute}
+	var req, err = http.NewRequest("GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"failed to download JAR file %v: %v", location, resp.Status)
+	}
+	var maxSize = s.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxJarSize
+	}
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf(
+			"JAR file %v is larger than the max size %v bytes", location, maxSize)
+	}
+	// Reads one more byte than the max to tell whether the file is larger.
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf(
+			"JAR file %v is larger than the max size %v bytes", location, maxSize)
+	}
+	return content, nil
+}
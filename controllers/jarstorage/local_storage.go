@@ -0,0 +1,66 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jarstorage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage is the storage of JAR files in a dir of the local filesystem
+// of the operator, e.g., a volume mounted into the operator pod, whose
+// locations are file URLs. Only the files in the dir can be read, so that the
+// jobs cannot read the other files of the operator, e.g., its service account
+// token.
+type LocalStorage struct {
+	// The dir of the JAR files.
+	Dir string
+}
+
+// ReadJar reads the JAR file at the path of the location.
+func (s *LocalStorage) ReadJar(
+	ctx context.Context, location string) ([]byte, error) {
+	var locationURL, err = url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	path, err := s.resolvePath(locationURL.Path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+// Resolves the path with its symlinks, it fails if the path is not in the dir.
+func (s *LocalStorage) resolvePath(path string) (string, error) {
+	var dir, err = filepath.EvalSymlinks(s.Dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(resolved, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("JAR file %v is not in dir %v", path, s.Dir)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jarstorage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Storage is the storage where the operator reads the JAR files of jobs from,
+// when the jobs are submitted through the Flink REST API.
+type Storage interface {
+	// ReadJar reads the content of the JAR file at the location, it is
+	// cancelled with the context.
+	ReadJar(ctx context.Context, location string) ([]byte, error)
+}
+
+// Registry finds the storage of a JAR file by the scheme of its location,
+// e.g., `https` for `https://example.com/jobs/WordCount.jar`.
+type Registry struct {
+	storages map[string]Storage
+}
+
+// The default maximum size of a JAR file downloaded over HTTP(S).
+const DefaultMaxJarSize = 256 * 1024 * 1024
+
+// NewRegistry creates a registry with the storages supported by default, which
+// download JAR files over HTTP(S) up to the max size in bytes. A location
+// without a scheme is not supported, as it is ambiguous whether it is a path
+// in the Flink image or in the filesystem of the operator. The filesystem of
+// the operator is not registered by default, because it holds the credentials
+// of the operator, register LocalStorage explicitly for a dir of JAR files.
+func NewRegistry(maxJarSize int64) *Registry {
+	var registry = &Registry{storages: map[string]Storage{}}
+	var httpStorage = &HTTPStorage{MaxSize: maxJarSize}
+	registry.Register("http", httpStorage)
+	registry.Register("https", httpStorage)
+	return registry
+}
+
+// Register registers the storage for the scheme.
+func (r *Registry) Register(scheme string, storage Storage) {
+	r.storages[scheme] = storage
+}
+
+// GetStorage gets the storage of the JAR location.
+func (r *Registry) GetStorage(location string) (Storage, error) {
+	var locationURL, err = url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if len(locationURL.Scheme) == 0 {
+		return nil, fmt.Errorf(
+			"JAR file %v is not a URL, e.g., https://example.com/myjob.jar",
+			location)
+	}
+	var storage, ok = r.storages[locationURL.Scheme]
+	if !ok {
+		return nil, fmt.Errorf(
+			"unsupported JAR storage scheme: %v", locationURL.Scheme)
+	}
+	return storage, nil
+}
+
+// ReadJar reads the JAR file from the storage of its location.
+func (r *Registry) ReadJar(
+	ctx context.Context, location string) ([]byte, error) {
+	var storage, err = r.GetStorage(location)
+	if err != nil {
+		return nil, err
+	}
+	return storage.ReadJar(ctx, location)
+}
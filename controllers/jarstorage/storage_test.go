@@ -0,0 +1,101 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jarstorage
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestReadLocalJar(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "jars")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	var jarDir = filepath.Join(dir, "jars")
+	assert.NilError(t, os.Mkdir(jarDir, 0755))
+	var jarPath = filepath.Join(jarDir, "WordCount.jar")
+	assert.NilError(t, ioutil.WriteFile(jarPath, []byte("jar content"), 0644))
+	var secretPath = filepath.Join(dir, "token")
+	assert.NilError(t, ioutil.WriteFile(secretPath, []byte("secret"), 0644))
+	var linkPath = filepath.Join(jarDir, "Link.jar")
+	assert.NilError(t, os.Symlink(secretPath, linkPath))
+
+	// The local filesystem is not registered by default.
+	var registry = NewRegistry(DefaultMaxJarSize)
+	_, err = registry.ReadJar(context.Background(), "file://"+jarPath)
+	assert.Error(t, err, "unsupported JAR storage scheme: file")
+
+	registry.Register("file", &LocalStorage{Dir: jarDir})
+	content, err := registry.ReadJar(context.Background(), "file://"+jarPath)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "jar content")
+
+	// Only the files in the dir can be read.
+	_, err = registry.ReadJar(context.Background(), "file://"+secretPath)
+	assert.ErrorContains(t, err, "is not in dir")
+	_, err = registry.ReadJar(
+		context.Background(), "file://"+jarDir+"/../token")
+	assert.ErrorContains(t, err, "is not in dir")
+	_, err = registry.ReadJar(context.Background(), "file://"+linkPath)
+	assert.ErrorContains(t, err, "is not in dir")
+
+	// A plain path could be a path in the Flink image.
+	_, err = registry.ReadJar(context.Background(), jarPath)
+	assert.ErrorContains(t, err, "is not a URL")
+}
+
+func TestReadHTTPJar(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/jobs/WordCount.jar" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte("jar content"))
+		}))
+	defer server.Close()
+
+	var registry = NewRegistry(DefaultMaxJarSize)
+	var content, err = registry.ReadJar(
+		context.Background(), server.URL+"/jobs/WordCount.jar")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "jar content")
+
+	_, err = registry.ReadJar(context.Background(), server.URL+"/jobs/Missing.jar")
+	assert.ErrorContains(t, err, "404 Not Found")
+
+	// A file larger than the max size is not downloaded.
+	registry = NewRegistry(int64(len("jar content")) - 1)
+	_, err = registry.ReadJar(
+		context.Background(), server.URL+"/jobs/WordCount.jar")
+	assert.ErrorContains(t, err, "is larger than the max size 10 bytes")
+}
+
+func TestUnsupportedStorage(t *testing.T) {
+	var registry = NewRegistry(DefaultMaxJarSize)
+	var _, err = registry.ReadJar(
+		context.Background(), "gs://my-bucket/WordCount.jar")
+	assert.Error(t, err, "unsupported JAR storage scheme: gs")
+}
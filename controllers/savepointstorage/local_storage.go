@@ -0,0 +1,71 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package savepointstorage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage is the storage of savepoints in a dir of the local filesystem,
+// e.g., a volume shared by the operator and the Flink cluster. Only the
+// savepoints in the dir can be deleted, so that the jobs cannot make the
+// operator delete its other files through their savepoints dir.
+type LocalStorage struct {
+	// The dir of the savepoints.
+	Dir string
+}
+
+// DeleteSavepoint deletes the savepoint directory, which must exist, otherwise
+// the filesystem is likely not shared with the Flink cluster.
+func (s *LocalStorage) DeleteSavepoint(location string) error {
+	var locationURL, err = url.Parse(location)
+	if err != nil {
+		return err
+	}
+	var path = filepath.Clean(locationURL.Path)
+	if !filepath.IsAbs(path) || path == "/" {
+		return fmt.Errorf("invalid savepoint location: %v", location)
+	}
+	if _, err = os.Stat(path); err != nil {
+		return err
+	}
+	path, err = s.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+// Resolves the path with its symlinks, it fails if the path is not in the dir.
+func (s *LocalStorage) resolvePath(path string) (string, error) {
+	var dir, err = filepath.EvalSymlinks(s.Dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(resolved, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("savepoint %v is not in dir %v", path, s.Dir)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package savepointstorage
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Storage is the storage where savepoints are stored.
+type Storage interface {
+	// DeleteSavepoint deletes the savepoint at the location.
+	DeleteSavepoint(location string) error
+}
+
+// Registry finds the storage of a savepoint by the scheme of its location,
+// e.g., `file` for `file:///savepoints/savepoint-1234`.
+type Registry struct {
+	storages map[string]Storage
+}
+
+// NewRegistry creates a registry without any storage. The local filesystem of
+// the operator is not registered by default, because it is usually not shared
+// with the Flink cluster, register LocalStorage explicitly for a shared volume.
+func NewRegistry() *Registry {
+	return &Registry{storages: map[string]Storage{}}
+}
+
+// Register registers the storage for the scheme.
+func (r *Registry) Register(scheme string, storage Storage) {
+	r.storages[scheme] = storage
+}
+
+// GetStorage gets the storage of the savepoint location.
+func (r *Registry) GetStorage(location string) (Storage, error) {
+	var locationURL, err = url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	var storage, ok = r.storages[locationURL.Scheme]
+	if !ok {
+		return nil, fmt.Errorf(
+			"unsupported savepoint storage of location %v", location)
+	}
+	return storage, nil
+}
+
+// IsSupported checks whether a storage is registered for the savepoint
+// location.
+func (r *Registry) IsSupported(location string) bool {
+	var _, err = r.GetStorage(location)
+	return err == nil
+}
+
+// DeleteSavepoint deletes the savepoint from the storage of its location.
+func (r *Registry) DeleteSavepoint(location string) error {
+	var storage, err = r.GetStorage(location)
+	if err != nil {
+		return err
+	}
+	return storage.DeleteSavepoint(location)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package savepointstorage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestDeleteLocalSavepoint(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "savepoints")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	var savepointDir = filepath.Join(dir, "savepoint-1234")
+	assert.NilError(t, os.Mkdir(savepointDir, 0755))
+	assert.NilError(t, ioutil.WriteFile(
+		filepath.Join(savepointDir, "_metadata"), []byte("metadata"), 0644))
+
+	var registry = newLocalRegistry(dir)
+	assert.NilError(t, registry.DeleteSavepoint("file://"+savepointDir))
+	_, err = os.Stat(savepointDir)
+	assert.Assert(t, os.IsNotExist(err))
+
+	// The savepoint is not in the filesystem of the operator.
+	err = registry.DeleteSavepoint(savepointDir)
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestDeleteLocalSavepointOutsideDir(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "savepoints")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	otherDir, err := ioutil.TempDir("", "other")
+	assert.NilError(t, err)
+	defer os.RemoveAll(otherDir)
+
+	var registry = newLocalRegistry(dir)
+	err = registry.DeleteSavepoint("file://" + otherDir)
+	assert.ErrorContains(t, err, "is not in dir")
+	_, err = os.Stat(otherDir)
+	assert.NilError(t, err)
+
+	// The dir itself is not a savepoint.
+	err = registry.DeleteSavepoint("file://" + dir)
+	assert.ErrorContains(t, err, "is not in dir")
+
+	// A symlink in the dir to another dir.
+	var link = filepath.Join(dir, "savepoint-1234")
+	assert.NilError(t, os.Symlink(otherDir, link))
+	err = registry.DeleteSavepoint("file://" + link)
+	assert.ErrorContains(t, err, "is not in dir")
+	_, err = os.Stat(otherDir)
+	assert.NilError(t, err)
+}
+
+func TestDeleteInvalidLocalSavepoint(t *testing.T) {
+	var registry = newLocalRegistry(os.TempDir())
+	var err = registry.DeleteSavepoint("file:///")
+	assert.Error(t, err, "invalid savepoint location: file:///")
+
+	err = registry.DeleteSavepoint("savepoints/savepoint-1234")
+	assert.Error(
+		t, err, "invalid savepoint location: savepoints/savepoint-1234")
+}
+
+func TestUnsupportedStorage(t *testing.T) {
+	var registry = NewRegistry()
+	assert.Assert(t, !registry.IsSupported("gs://my-bucket/savepoint-1234"))
+	var err = registry.DeleteSavepoint("gs://my-bucket/savepoint-1234")
+	assert.Error(
+		t,
+		err,
+		"unsupported savepoint storage of location gs://my-bucket/savepoint-1234")
+
+	// The local filesystem is not registered by default.
+	err = registry.DeleteSavepoint("file:///savepoints/savepoint-1234")
+	assert.Error(
+		t,
+		err,
+		"unsupported savepoint storage of location file:///savepoints/savepoint-1234")
+	err = registry.DeleteSavepoint("/savepoints/savepoint-1234")
+	assert.Error(
+		t,
+		err,
+		"unsupported savepoint storage of location /savepoints/savepoint-1234")
+}
+
+func newLocalRegistry(dir string) *Registry {
+	var registry = NewRegistry()
+	var localStorage = &LocalStorage{Dir: dir}
+	registry.Register("", localStorage)
+	registry.Register("file", localStorage)
+	return registry
+}
@@ -19,9 +19,12 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	v1alpha1 "github.com/googlecloudplatform/flink-operator/api/v1alpha1"
 	"github.com/googlecloudplatform/flink-operator/controllers"
+	"github.com/googlecloudplatform/flink-operator/controllers/jarstorage"
+	"github.com/googlecloudplatform/flink-operator/controllers/savepointstorage"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -50,14 +53,60 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var flinkAPIAccess controllers.FlinkAPIAccess
+	var flinkAPIMaxRetries int
+	var localJarDir string
+	var maxJarSize int64
+	var localSavepointDir string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&flinkAPIAccess.Mode, "flink-api-access", controllers.FlinkAPIAccessMode.DNS,
+		"How to reach the Flink REST API of the JobManagers: DNS (the cluster DNS name of the JobManager service), "+
+			"ClusterIP (the cluster IP of the JobManager service), Ingress (the URL of the JobManager ingress) "+
+			"or Proxy (the service proxy of the Kubernetes API server, e.g., when the operator runs outside the cluster).")
+	flag.StringVar(&flinkAPIAccess.ClusterDomain, "cluster-domain", "cluster.local",
+		"The domain suffix of the cluster DNS names, used with --flink-api-access=DNS.")
+	flag.DurationVar(&flinkAPIAccess.Timeout, "flink-api-timeout", 10*time.Second,
+		"The timeout of each attempt of a Flink REST API request.")
+	flag.IntVar(&flinkAPIMaxRetries, "flink-api-max-retries", 2,
+		"The maximum number of retries of a failed Flink REST API GET request, 0 for no retries.")
+	flag.StringVar(&localJarDir, "local-jar-dir", "",
+		"A dir of the operator, e.g., a mounted volume, whose JAR files can be submitted through the Flink REST API "+
+			"with file:// URLs. Local JAR files are not supported if it is empty.")
+	flag.Int64Var(&maxJarSize, "max-jar-size", jarstorage.DefaultMaxJarSize,
+		"The maximum size in bytes of a JAR file which the operator downloads to submit through the Flink REST API.")
+	flag.StringVar(&localSavepointDir, "local-savepoint-dir", "",
+		"A dir of the operator shared with the Flink clusters, e.g., a mounted volume, where the expired savepoints "+
+			"of the jobs with maxSavepointsToKeep are deleted from with file:// locations. Local savepoints are not "+
+			"deleted if it is empty.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.Logger(true))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	var config = ctrl.GetConfigOrDie()
+	flinkAPIAccess.KubeConfig = config
+	flinkAPIAccess.MaxRetries = flinkAPIMaxRetries
+	if flinkAPIMaxRetries == 0 {
+		flinkAPIAccess.MaxRetries = -1
+	}
+	if err := flinkAPIAccess.Validate(); err != nil {
+		setupLog.Error(err, "Invalid Flink API access")
+		os.Exit(1)
+	}
+
+	var jarStorage = jarstorage.NewRegistry(maxJarSize)
+	if len(localJarDir) > 0 {
+		jarStorage.Register("file", &jarstorage.LocalStorage{Dir: localJarDir})
+	}
+
+	var savepointStorage = savepointstorage.NewRegistry()
+	if len(localSavepointDir) > 0 {
+		savepointStorage.Register(
+			"file", &savepointstorage.LocalStorage{Dir: localSavepointDir})
+	}
+
+	mgr, err := ctrl.NewManager(config, ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		LeaderElection:     enableLeaderElection,
@@ -68,14 +117,38 @@ func main() {
 	}
 
 	err = (&controllers.FlinkClusterReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("FlinkCluster"),
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("FlinkCluster"),
+		FlinkAPIAccess:   flinkAPIAccess,
+		JarStorage:       jarStorage,
+		SavepointStorage: savepointStorage,
 	}).SetupWithManager(mgr)
 	if err != nil {
 		setupLog.Error(err, "Unable to create controller", "controller", "FlinkCluster")
 		os.Exit(1)
 	}
 
+	err = (&controllers.FlinkSavepointReconciler{
+		Client:         mgr.GetClient(),
+		Log:            ctrl.Log.WithName("controllers").WithName("FlinkSavepoint"),
+		FlinkAPIAccess: flinkAPIAccess,
+	}).SetupWithManager(mgr)
+	if err != nil {
+		setupLog.Error(err, "Unable to create controller", "controller", "FlinkSavepoint")
+		os.Exit(1)
+	}
+
+	err = (&controllers.FlinkSessionJobReconciler{
+		Client:         mgr.GetClient(),
+		Log:            ctrl.Log.WithName("controllers").WithName("FlinkSessionJob"),
+		FlinkAPIAccess: flinkAPIAccess,
+		JarStorage:     jarStorage,
+	}).SetupWithManager(mgr)
+	if err != nil {
+		setupLog.Error(err, "Unable to create controller", "controller", "FlinkSessionJob")
+		os.Exit(1)
+	}
+
 	// Set up webhooks for the custom resource.
 	// Disable it with `FLINK_OPERATOR_ENABLE_WEBHOOKS=false` when we run locally.
 	if os.Getenv("FLINK_OPERATOR_ENABLE_WEBHOOKS") != "false" {